@@ -0,0 +1,51 @@
+"""Service authentication for calls coming from the bot."""
+
+import hmac
+import os
+from dataclasses import dataclass
+
+from fastapi import Header, HTTPException
+
+BACKEND_API_TOKEN = os.getenv("BACKEND_API_TOKEN", "")
+# Local development only: serve without a token instead of refusing to start.
+BACKEND_AUTH_DISABLED = os.getenv("BACKEND_AUTH_DISABLED", "false").lower() in {"1", "true", "yes"}
+
+
+def check_auth_config() -> None:
+    """Refuse to start without a service token unless auth is explicitly disabled."""
+    if not BACKEND_API_TOKEN and not BACKEND_AUTH_DISABLED:
+        raise RuntimeError("BACKEND_API_TOKEN is not set; set BACKEND_AUTH_DISABLED=true to run without auth in development")
+
+
+async def require_service_token(authorization: str | None = Header(default=None)) -> None:
+    """Reject requests without the shared bot token. Skipped only when auth is disabled and no token is set."""
+    if not BACKEND_API_TOKEN and BACKEND_AUTH_DISABLED:
+        return
+    if not authorization or not authorization.startswith("Bearer "):
+        raise HTTPException(status_code=401, detail="Missing service token")
+    if not hmac.compare_digest(authorization[len("Bearer "):], BACKEND_API_TOKEN):
+        raise HTTPException(status_code=401, detail="Invalid service token")
+
+
+@dataclass
+class Actor:
+    user_id: int | None
+    role: str | None
+    email: str | None
+
+
+async def get_actor(
+    x_acting_user_id: int | None = Header(default=None),
+    x_acting_user_role: str | None = Header(default=None),
+    x_acting_user_email: str | None = Header(default=None),
+) -> Actor:
+    """Identity of the bot user on whose behalf the request is made, if forwarded."""
+    return Actor(user_id=x_acting_user_id, role=x_acting_user_role, email=x_acting_user_email)
+
+
+def ensure_owner(actor: Actor, owner_id: int | None) -> None:
+    """Allow acting only on the caller's own records; the caller must identify a user."""
+    if actor.user_id is None:
+        raise HTTPException(status_code=401, detail="Missing acting user")
+    if owner_id != actor.user_id:
+        raise HTTPException(status_code=403, detail="Not the owner of this resource")
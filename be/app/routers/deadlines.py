@@ -5,6 +5,7 @@ from pydantic import BaseModel, Field
 from sqlalchemy import insert, select
 from sqlalchemy.ext.asyncio import AsyncSession
 
+from ..auth import Actor, ensure_owner, get_actor
 from ..db import get_session
 from ..tables import deadlines_table, notifications_table
 
@@ -12,8 +13,13 @@ router = APIRouter(prefix="/api/v1", tags=["Deadlines & Notifications"])
 
 
 @router.get("/deadlines/{student_id}")
-async def list_deadlines(student_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def list_deadlines(
+    student_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
     """Return all current deadlines affecting the student."""
+    ensure_owner(actor, student_id)
     query = (
         select(deadlines_table)
         .where(deadlines_table.c.student_id == student_id)
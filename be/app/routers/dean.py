@@ -3,6 +3,7 @@ from pydantic import BaseModel
 from sqlalchemy import insert, select
 from sqlalchemy.ext.asyncio import AsyncSession
 
+from ..auth import Actor, ensure_owner, get_actor
 from ..db import get_session
 from ..tables import dean_requests
 
@@ -16,7 +17,12 @@ class DeanRequest(BaseModel):
 
 
 @router.post("/requests")
-async def create_dean_request(payload: DeanRequest, session: AsyncSession = Depends(get_session)) -> dict:
+async def create_dean_request(
+    payload: DeanRequest,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    ensure_owner(actor, payload.user_id)
     stmt = (
         insert(dean_requests)
         .values(user_id=payload.user_id, request_type=payload.request_type, payload=payload.payload)
@@ -1,16 +1,35 @@
-from fastapi import APIRouter, Depends, HTTPException
+from fastapi import APIRouter, Depends, HTTPException, Query
 from pydantic import BaseModel
 from sqlalchemy import insert, select
 from sqlalchemy.ext.asyncio import AsyncSession
 
+from ..auth import Actor, ensure_owner, get_actor
 from ..db import get_session
 from ..tables import dorm_payments, dorm_requests, dorm_rooms
 
 router = APIRouter(prefix="/api/v1/dorms", tags=["Dormitories"])
 
 
+@router.get("/rooms")
+async def dorm_rooms_for_students(
+    student_id: list[int] = Query(default=[]),
+    session: AsyncSession = Depends(get_session),
+) -> list[dict]:
+    """Room assignments of several students at once; students without one are left out."""
+    if not student_id:
+        return []
+    query = select(dorm_rooms).where(dorm_rooms.c.student_id.in_(student_id))
+    result = await session.execute(query)
+    return [dict(row) for row in result.mappings().all()]
+
+
 @router.get("/rooms/{student_id}")
-async def dorm_room(student_id: int, session: AsyncSession = Depends(get_session)) -> dict:
+async def dorm_room(
+    student_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    ensure_owner(actor, student_id)
     query = select(dorm_rooms).where(dorm_rooms.c.student_id == student_id)
     row = (await session.execute(query)).mappings().first()
     if not row:
@@ -22,16 +41,23 @@ class MaintenancePayload(BaseModel):
     student_id: int
     request_type: str
     description: str | None = None
+    attachment_url: str | None = None
 
 
 @router.post("/maintenance")
-async def create_maintenance(payload: MaintenancePayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def create_maintenance(
+    payload: MaintenancePayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    ensure_owner(actor, payload.student_id)
     stmt = (
         insert(dorm_requests)
         .values(
             student_id=payload.student_id,
             request_type=payload.request_type,
             description=payload.description,
+            attachment_url=payload.attachment_url,
         )
         .returning(dorm_requests.c.id)
     )
@@ -56,7 +82,12 @@ class PaymentPayload(BaseModel):
 
 
 @router.post("/payments")
-async def submit_payment(payload: PaymentPayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def submit_payment(
+    payload: PaymentPayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    ensure_owner(actor, payload.student_id)
     stmt = (
         insert(dorm_payments)
         .values(student_id=payload.student_id, amount=payload.amount, reference=payload.reference)
@@ -3,6 +3,7 @@ from pydantic import BaseModel
 from sqlalchemy import delete, insert, select, update
 from sqlalchemy.ext.asyncio import AsyncSession
 
+from ..auth import Actor, ensure_owner, get_actor
 from ..db import get_session
 from ..tables import clubs_table, event_registrations, events_table, news_table
 
@@ -24,8 +25,14 @@ class RSVPRequest(BaseModel):
 
 
 @router.post("/events/{event_id}/rsvp")
-async def rsvp_event(event_id: int, payload: RSVPRequest, session: AsyncSession = Depends(get_session)) -> dict:
+async def rsvp_event(
+    event_id: int,
+    payload: RSVPRequest,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
     """Create or update participation in an event."""
+    ensure_owner(actor, payload.user_id)
     event_query = select(events_table).where(events_table.c.id == event_id)
     event_result = await session.execute(event_query)
     event_row = event_result.mappings().first()
@@ -92,8 +99,14 @@ class CancelRequest(BaseModel):
 
 
 @router.post("/events/{event_id}/cancel")
-async def cancel_rsvp(event_id: int, payload: CancelRequest, session: AsyncSession = Depends(get_session)) -> dict:
+async def cancel_rsvp(
+    event_id: int,
+    payload: CancelRequest,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
     """Cancel participation in an event."""
+    ensure_owner(actor, payload.user_id)
     # Check if registration exists
     reg_query = select(event_registrations).where(
         event_registrations.c.event_id == event_id,
@@ -123,8 +136,13 @@ async def cancel_rsvp(event_id: int, payload: CancelRequest, session: AsyncSessi
 
 
 @router.get("/events/user/{user_id}")
-async def list_user_events(user_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def list_user_events(
+    user_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
     """List events the user is registered for."""
+    ensure_owner(actor, user_id)
     query = (
         select(
             events_table,
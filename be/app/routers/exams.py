@@ -3,6 +3,7 @@ from fastapi import APIRouter, Depends
 from sqlalchemy import select
 from sqlalchemy.ext.asyncio import AsyncSession
 
+from ..auth import Actor, ensure_owner, get_actor
 from ..db import get_session
 from ..tables import course_enrollments, courses_table, exam_schedules, grade_records
 
@@ -11,8 +12,13 @@ router = APIRouter(prefix="/api/v1", tags=["Exams & Grades"])
 
 
 @router.get("/exams/{student_id}")
-async def get_exams(student_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def get_exams(
+    student_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
     """Return upcoming exams for the student's enrolled courses."""
+    ensure_owner(actor, student_id)
     query = (
         select(
             exam_schedules.c.id.label("exam_id"),
@@ -33,8 +39,13 @@ async def get_exams(student_id: int, session: AsyncSession = Depends(get_session
 
 
 @router.get("/grades/{student_id}")
-async def get_grades(student_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def get_grades(
+    student_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
     """Return recorded grades and GPA contributions."""
+    ensure_owner(actor, student_id)
     query = (
         select(
             grade_records.c.id.label("grade_id"),
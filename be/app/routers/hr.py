@@ -5,6 +5,7 @@ from pydantic import BaseModel, Field
 from sqlalchemy import insert, select
 from sqlalchemy.ext.asyncio import AsyncSession
 
+from ..auth import Actor, ensure_owner, get_actor
 from ..db import get_session
 from ..tables import (
     business_trip_requests,
@@ -17,7 +18,12 @@ router = APIRouter(prefix="/api/v1/hr", tags=["Employees"])
 
 
 @router.get("/vacations/{employee_id}")
-async def get_vacations(employee_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def get_vacations(
+    employee_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
+    ensure_owner(actor, employee_id)
     query = (
         select(vacation_requests)
         .where(vacation_requests.c.employee_id == employee_id)
@@ -35,7 +41,12 @@ class VacationPayload(BaseModel):
 
 
 @router.post("/vacations/request")
-async def request_vacation(payload: VacationPayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def request_vacation(
+    payload: VacationPayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    ensure_owner(actor, payload.employee_id)
     stmt = (
         insert(vacation_requests)
         .values(
@@ -52,7 +63,12 @@ async def request_vacation(payload: VacationPayload, session: AsyncSession = Dep
 
 
 @router.get("/business_trips/{employee_id}")
-async def get_business_trips(employee_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def get_business_trips(
+    employee_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
+    ensure_owner(actor, employee_id)
     query = (
         select(business_trip_requests)
         .where(business_trip_requests.c.employee_id == employee_id)
@@ -71,7 +87,12 @@ class BusinessTripPayload(BaseModel):
 
 
 @router.post("/business_trips/request")
-async def request_business_trip(payload: BusinessTripPayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def request_business_trip(
+    payload: BusinessTripPayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    ensure_owner(actor, payload.employee_id)
     stmt = (
         insert(business_trip_requests)
         .values(
@@ -89,7 +110,12 @@ async def request_business_trip(payload: BusinessTripPayload, session: AsyncSess
 
 
 @router.get("/certificates/{employee_id}")
-async def get_certificates(employee_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def get_certificates(
+    employee_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
+    ensure_owner(actor, employee_id)
     query = (
         select(hr_certificates)
         .where(hr_certificates.c.employee_id == employee_id)
@@ -105,7 +131,12 @@ class CertificatePayload(BaseModel):
 
 
 @router.post("/certificates/request")
-async def request_certificate(payload: CertificatePayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def request_certificate(
+    payload: CertificatePayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    ensure_owner(actor, payload.employee_id)
     stmt = (
         insert(hr_certificates)
         .values(employee_id=payload.employee_id, certificate_type=payload.certificate_type)
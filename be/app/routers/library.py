@@ -3,6 +3,7 @@ from pydantic import BaseModel
 from sqlalchemy import insert, or_, select
 from sqlalchemy.ext.asyncio import AsyncSession
 
+from ..auth import Actor, ensure_owner, get_actor
 from ..db import get_session
 from ..tables import (
     library_books,
@@ -38,7 +39,12 @@ class ReservationPayload(BaseModel):
 
 
 @router.post("/books/reserve")
-async def reserve_book(payload: ReservationPayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def reserve_book(
+    payload: ReservationPayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    ensure_owner(actor, payload.student_id)
     stmt = (
         insert(library_reservations)
         .values(book_id=payload.book_id, student_id=payload.student_id)
@@ -50,7 +56,12 @@ async def reserve_book(payload: ReservationPayload, session: AsyncSession = Depe
 
 
 @router.get("/borrowed/{student_id}")
-async def borrowed_books(student_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def borrowed_books(
+    student_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
+    ensure_owner(actor, student_id)
     query = (
         select(
             library_loans.c.id.label("loan_id"),
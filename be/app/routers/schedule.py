@@ -2,6 +2,7 @@ from fastapi import APIRouter, Depends
 from sqlalchemy import select
 from sqlalchemy.ext.asyncio import AsyncSession
 
+from ..auth import Actor, ensure_owner, get_actor
 from ..db import get_session
 from ..tables import course_enrollments, course_sessions, courses_table
 
@@ -9,8 +10,13 @@ router = APIRouter(prefix="/api/v1", tags=["Schedule & Courses"])
 
 
 @router.get("/schedule/{student_id}")
-async def get_schedule(student_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def get_schedule(
+    student_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
     """Return chronologically ordered sessions for the student."""
+    ensure_owner(actor, student_id)
     query = (
         select(
             course_sessions.c.id.label("session_id"),
@@ -33,8 +39,13 @@ async def get_schedule(student_id: int, session: AsyncSession = Depends(get_sess
 
 
 @router.get("/courses/{student_id}")
-async def get_courses(student_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def get_courses(
+    student_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
     """List all courses the student is enrolled in."""
+    ensure_owner(actor, student_id)
     query = (
         select(courses_table)
         .join(course_enrollments, course_enrollments.c.course_id == courses_table.c.id)
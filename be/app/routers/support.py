@@ -3,6 +3,7 @@ from pydantic import BaseModel
 from sqlalchemy import insert, select
 from sqlalchemy.ext.asyncio import AsyncSession
 
+from ..auth import Actor, ensure_owner, get_actor
 from ..db import get_session
 from ..tables import ai_advisor_sessions, support_queries, support_tickets
 
@@ -15,7 +16,13 @@ class SupportQueryPayload(BaseModel):
 
 
 @router.post("/support/query")
-async def support_query(payload: SupportQueryPayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def support_query(
+    payload: SupportQueryPayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    if payload.user_id is not None:
+        ensure_owner(actor, payload.user_id)
     answer = f"Our support team will respond regarding: {payload.question}"
     stmt = (
         insert(support_queries)
@@ -35,7 +42,13 @@ class SupportTicketPayload(BaseModel):
 
 
 @router.post("/support/tickets")
-async def create_ticket(payload: SupportTicketPayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def create_ticket(
+    payload: SupportTicketPayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    if payload.user_id is not None:
+        ensure_owner(actor, payload.user_id)
     stmt = (
         insert(support_tickets)
         .values(
@@ -67,7 +80,13 @@ class AdvisorPayload(BaseModel):
 
 
 @router.post("/ai/chat/advisor")
-async def advisor_chat(payload: AdvisorPayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def advisor_chat(
+    payload: AdvisorPayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    if payload.user_id is not None:
+        ensure_owner(actor, payload.user_id)
     response = f"Advisor tip for {payload.topic or 'general guidance'}"
     stmt = (
         insert(ai_advisor_sessions)
@@ -3,14 +3,28 @@ from pydantic import BaseModel
 from sqlalchemy import insert, select, update
 from sqlalchemy.ext.asyncio import AsyncSession
 
+from ..auth import Actor, ensure_owner, get_actor
 from ..db import get_session
 from ..tables import visa_applications, visa_documents
 
 router = APIRouter(prefix="/api/v1/visa", tags=["Visa Services"])
 
 
+async def _ensure_application_owner(session: AsyncSession, actor: Actor, application_id: int) -> None:
+    owner = await session.execute(select(visa_applications.c.user_id).where(visa_applications.c.id == application_id))
+    owner_id = owner.scalar_one_or_none()
+    if owner_id is None:
+        raise HTTPException(status_code=404, detail="Application not found")
+    ensure_owner(actor, owner_id)
+
+
 @router.get("/applications/{user_id}")
-async def get_visa_applications(user_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def get_visa_applications(
+    user_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
+    ensure_owner(actor, user_id)
     query = (
         select(visa_applications)
         .where(visa_applications.c.user_id == user_id)
@@ -26,7 +40,12 @@ class CreateApplicationPayload(BaseModel):
 
 
 @router.post("/applications")
-async def create_visa_application(payload: CreateApplicationPayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def create_visa_application(
+    payload: CreateApplicationPayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    ensure_owner(actor, payload.user_id)
     stmt = (
         insert(visa_applications)
         .values(
@@ -41,7 +60,12 @@ async def create_visa_application(payload: CreateApplicationPayload, session: As
 
 
 @router.post("/applications/{application_id}/withdraw")
-async def withdraw_visa_application(application_id: int, session: AsyncSession = Depends(get_session)) -> dict:
+async def withdraw_visa_application(
+    application_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    await _ensure_application_owner(session, actor, application_id)
     stmt = (
         update(visa_applications)
         .where(visa_applications.c.id == application_id)
@@ -55,7 +79,12 @@ async def withdraw_visa_application(application_id: int, session: AsyncSession =
 
 
 @router.get("/applications/{application_id}/documents")
-async def get_visa_documents(application_id: int, session: AsyncSession = Depends(get_session)) -> list[dict]:
+async def get_visa_documents(
+    application_id: int,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> list[dict]:
+    await _ensure_application_owner(session, actor, application_id)
     query = (
         select(visa_documents)
         .where(visa_documents.c.application_id == application_id)
@@ -71,7 +100,13 @@ class UploadDocumentPayload(BaseModel):
 
 
 @router.post("/applications/{application_id}/documents")
-async def upload_visa_document(application_id: int, payload: UploadDocumentPayload, session: AsyncSession = Depends(get_session)) -> dict:
+async def upload_visa_document(
+    application_id: int,
+    payload: UploadDocumentPayload,
+    session: AsyncSession = Depends(get_session),
+    actor: Actor = Depends(get_actor),
+) -> dict:
+    await _ensure_application_owner(session, actor, application_id)
     stmt = (
         insert(visa_documents)
         .values(
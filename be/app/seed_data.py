@@ -68,6 +68,7 @@ USERS = [
             "full_name_ru": "Анна Петрова",
             "full_name_en": "Anna Petrova",
             "role": "student",
+            "roles": None,
             "language": "ru",
             "is_foreign": False,
             "dorm_room": "A-201",
@@ -81,6 +82,7 @@ USERS = [
             "full_name_ru": "Борис Иванов",
             "full_name_en": "Boris Ivanov",
             "role": "student",
+            "roles": None,
             "language": "ru",
             "is_foreign": False,
             "dorm_room": "B-120",
@@ -94,6 +96,7 @@ USERS = [
             "full_name_ru": "Чэнь Ли",
             "full_name_en": "Chen Li",
             "role": "student",
+            "roles": None,
             "language": "en",
             "is_foreign": True,
             "dorm_room": "C-310",
@@ -107,6 +110,7 @@ USERS = [
             "full_name_ru": "Илья Смирнов",
             "full_name_en": "Ilya Smirnov",
             "role": "employee",
+            "roles": ["employee", "student"],
             "language": "ru",
             "faculty": "Computer Science",
             "is_foreign": False,
@@ -120,6 +124,7 @@ USERS = [
             "full_name_ru": "София Морозова",
             "full_name_en": "Sofia Morozova",
             "role": "employee",
+            "roles": None,
             "language": "ru",
             "faculty": "HR",
             "is_foreign": False,
@@ -133,6 +138,7 @@ USERS = [
             "full_name_ru": "Ректорский офис",
             "full_name_en": "Rector Office",
             "role": "leadership",
+            "roles": None,
             "language": "ru",
             "faculty": "Administration",
             "is_foreign": False,
@@ -146,6 +152,7 @@ USERS = [
             "full_name_ru": "Дарья Козлова",
             "full_name_en": "Daria Kozlova",
             "role": "student",
+            "roles": None,
             "language": "ru",
             "dorm_room": "A-305",
             "faculty": "Design",
@@ -159,6 +166,7 @@ USERS = [
             "full_name_ru": "Ольга Лебедева",
             "full_name_en": "Olga Lebedeva",
             "role": "employee",
+            "roles": None,
             "language": "ru",
             "faculty": "Library",
             "is_foreign": False,
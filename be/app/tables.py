@@ -23,6 +23,7 @@ users_table = Table(
     Column("full_name_ru", String(255)),
     Column("full_name_en", String(255)),
     Column("role", String(50), nullable=False),  # student, employee, leadership, applicant
+    Column("roles", JSON),  # all roles the user holds when more than one, e.g. ["employee", "student"]
     Column("language", String(5), default="ru"),
     Column("is_foreign", Boolean, default=False),
     Column("dorm_room", String(50)),
@@ -423,6 +424,7 @@ dorm_requests = Table(
     Column("student_id", ForeignKey("users.id"), nullable=False),
     Column("request_type", String(80), nullable=False),
     Column("description", Text),
+    Column("attachment_url", String(500)),
     Column("status", String(40), default="open"),
     Column("created_at", DateTime(timezone=True), server_default=func.now()),
 )
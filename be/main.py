@@ -1,19 +1,43 @@
 import logging
 import os
 
-from fastapi import FastAPI
+from fastapi import Depends, FastAPI
+from sqlalchemy import inspect, text
 
 from app import tables  # noqa: F401  # ensure table metadata is registered
+from app.auth import check_auth_config, require_service_token
 from app.db import engine, metadata, wait_for_db
-from app.routers import ROUTERS
+from app.routers import ROUTERS, meta
 from app.seed_data import seed_initial_data
 
 logger = logging.getLogger("server-be")
 
+check_auth_config()
+
 app = FastAPI(title="MAX Bot API", version="1.0.0")
 
 for router in ROUTERS:
-    app.include_router(router)
+    if router is meta.router:
+        app.include_router(router)
+    else:
+        app.include_router(router, dependencies=[Depends(require_service_token)])
+
+
+# Columns added after their tables were first created: (table, column, DDL type).
+_LATE_COLUMNS = [
+    ("users", "roles", "JSON"),
+    ("dorm_requests", "attachment_url", "VARCHAR(500)"),
+]
+
+
+def _add_missing_columns(sync_conn) -> None:
+    """Add columns introduced after the tables were first created."""
+    inspector = inspect(sync_conn)
+    for table, column, ddl_type in _LATE_COLUMNS:
+        columns = {col["name"] for col in inspector.get_columns(table)}
+        if column not in columns:
+            logger.info("Adding %s.%s column", table, column)
+            sync_conn.execute(text(f"ALTER TABLE {table} ADD COLUMN {column} {ddl_type}"))
 
 
 RESET_DB_ON_STARTUP = os.getenv("RESET_DB_ON_STARTUP", "true").lower() in {"1", "true", "yes"}
@@ -27,4 +51,5 @@ async def startup_event() -> None:
         if RESET_DB_ON_STARTUP:
             await conn.run_sync(metadata.drop_all)
         await conn.run_sync(metadata.create_all)
+        await conn.run_sync(_add_missing_columns)
     await seed_initial_data()
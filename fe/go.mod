@@ -4,13 +4,21 @@ go 1.24.4
 
 require (
 	github.com/caarlos0/env/v6 v6.10.1
+	github.com/jackc/pgx/v5 v5.7.1
 	github.com/max-messenger/max-bot-api-client-go v1.0.3
 	github.com/rs/zerolog v1.34.0
+	go.etcd.io/bbolt v1.3.11
 )
 
 require (
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
-	golang.org/x/sys v0.12.0 // indirect
+	golang.org/x/crypto v0.27.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
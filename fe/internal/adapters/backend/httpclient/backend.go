@@ -4,12 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -18,28 +23,77 @@ import (
 	"github.com/escalopa/inno-vkode/internal/ports"
 )
 
+var stats = expvar.NewMap("backend_client")
+
+// Policy controls how the client rides out backend outages.
+type Policy struct {
+	// MaxRetries applies to GET requests only; writes are not idempotent and
+	// are never repeated.
+	MaxRetries   int
+	RetryBackoff time.Duration
+	MaxBackoff   time.Duration
+	// BreakerThreshold consecutive failures open an endpoint's breaker for
+	// BreakerCooldown; zero disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
 type Backend struct {
 	baseURL string
+	token   string
 	client  *http.Client
 	log     zerolog.Logger
+	policy  Policy
+	now     func() time.Time
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+
+	retries  *expvar.Int
+	failures *expvar.Int
+	opened   *expvar.Int
+	rejected *expvar.Int
 }
 
 var _ ports.Backend = (*Backend)(nil)
 
-func New(baseURL string, timeout time.Duration, log zerolog.Logger) *Backend {
+func New(baseURL, token string, timeout time.Duration, policy Policy, log zerolog.Logger) *Backend {
 	trimmed := strings.TrimRight(baseURL, "/")
 	if trimmed == "" {
 		trimmed = "http://localhost:8001"
 	}
+	if policy.RetryBackoff <= 0 {
+		policy.RetryBackoff = 200 * time.Millisecond
+	}
+	if policy.MaxBackoff < policy.RetryBackoff {
+		policy.MaxBackoff = policy.RetryBackoff
+	}
 	return &Backend{
 		baseURL: trimmed,
+		token:   token,
 		client: &http.Client{
 			Timeout: timeout,
 		},
-		log: log,
+		log:      log,
+		policy:   policy,
+		now:      time.Now,
+		breakers: make(map[string]*breaker),
+		retries:  counter("retries"),
+		failures: counter("failures"),
+		opened:   counter("breaker_opened"),
+		rejected: counter("breaker_rejected"),
 	}
 }
 
+func counter(key string) *expvar.Int {
+	if v, ok := stats.Get(key).(*expvar.Int); ok {
+		return v
+	}
+	v := new(expvar.Int)
+	stats.Set(key, v)
+	return v
+}
+
 func (b *Backend) buildURL(p string, query url.Values) string {
 	full := b.baseURL
 	if !strings.HasPrefix(p, "/") {
@@ -52,30 +106,96 @@ func (b *Backend) buildURL(p string, query url.Values) string {
 	return full
 }
 
+// doRequest sends a request through the endpoint's circuit breaker, retrying
+// GETs on network errors and 5xx responses. When the backend stays down the
+// error is a *domain.UnavailableError naming the subsystem.
 func (b *Backend) doRequest(ctx context.Context, method, p string, query url.Values, payload any, out any) error {
-	ctx, cancel := context.WithTimeout(ctx, b.client.Timeout)
-	defer cancel()
-
-	var body io.Reader
+	var body []byte
 	if payload != nil {
 		buf := &bytes.Buffer{}
 		if err := json.NewEncoder(buf).Encode(payload); err != nil {
 			return fmt.Errorf("encode payload: %w", err)
 		}
-		body = buf
+		body = buf.Bytes()
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, b.buildURL(p, query), body)
+	endpoint := endpointKey(method, p)
+	br := b.breaker(endpoint)
+	if !br.allow(b.now()) {
+		b.rejected.Add(1)
+		return &domain.UnavailableError{Subsystem: subsystem(p), Err: fmt.Errorf("backend %s: %w", endpoint, errCircuitOpen)}
+	}
+
+	attempts := 1
+	if method == http.MethodGet {
+		attempts += max(b.policy.MaxRetries, 0)
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = b.attempt(ctx, method, p, query, body, out)
+		if err == nil || !errors.Is(err, domain.ErrTemporary) || ctx.Err() != nil || attempt >= attempts {
+			break
+		}
+		delay := b.backoff(attempt)
+		b.retries.Add(1)
+		b.log.Warn().
+			Err(err).
+			Str("endpoint", endpoint).
+			Int("attempt", attempt).
+			Dur("retry_in", delay).
+			Msg("backend request failed, retrying")
+		if !sleep(ctx, delay) {
+			break
+		}
+	}
+
+	switch {
+	case err == nil:
+		br.success()
+		return nil
+	case ctx.Err() != nil:
+		br.release()
+		return err
+	case errors.Is(err, domain.ErrTemporary):
+		b.failures.Add(1)
+		if br.failure(b.now()) {
+			b.opened.Add(1)
+			b.log.Warn().
+				Str("endpoint", endpoint).
+				Dur("cooldown", b.policy.BreakerCooldown).
+				Msg("backend circuit breaker opened")
+		}
+		return &domain.UnavailableError{Subsystem: subsystem(p), Err: err}
+	default:
+		// The backend answered, so the endpoint is up even if the request
+		// was rejected.
+		br.success()
+		return err
+	}
+}
+
+// attempt makes a single request. Network errors and 5xx or 429 responses
+// are marked with domain.ErrTemporary.
+func (b *Backend) attempt(ctx context.Context, method, p string, query url.Values, body []byte, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, b.client.Timeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, b.buildURL(p, query), reader)
 	if err != nil {
 		return fmt.Errorf("create request: %w", err)
 	}
-	if payload != nil {
+	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	b.authorize(ctx, req)
 
 	resp, err := b.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("do request: %w", err)
+		return fmt.Errorf("do request: %w: %w", err, domain.ErrTemporary)
 	}
 	defer func() {
 		if cerr := resp.Body.Close(); cerr != nil {
@@ -85,6 +205,21 @@ func (b *Backend) doRequest(ctx context.Context, method, p string, query url.Val
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		raw, _ := io.ReadAll(resp.Body)
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("backend %s %s returned %d: %s: %w", method, p, resp.StatusCode, string(raw), domain.ErrNotFound)
+		case http.StatusUnauthorized:
+			return fmt.Errorf("backend %s %s returned %d: %s: %w", method, p, resp.StatusCode, string(raw), domain.ErrUnauthorized)
+		case http.StatusForbidden:
+			return fmt.Errorf("backend %s %s returned %d: %s: %w", method, p, resp.StatusCode, string(raw), domain.ErrForbidden)
+		case http.StatusConflict:
+			return fmt.Errorf("backend %s %s returned %d: %s: %w", method, p, resp.StatusCode, string(raw), domain.ErrConflict)
+		case http.StatusTooManyRequests:
+			return fmt.Errorf("backend %s %s returned %d: %s: %w", method, p, resp.StatusCode, string(raw), domain.ErrTemporary)
+		}
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("backend %s %s returned %d: %s: %w", method, p, resp.StatusCode, string(raw), domain.ErrTemporary)
+		}
 		return fmt.Errorf("backend %s %s returned %d: %s", method, p, resp.StatusCode, string(raw))
 	}
 
@@ -102,6 +237,48 @@ func (b *Backend) doRequest(ctx context.Context, method, p string, query url.Val
 	return nil
 }
 
+// backoff is exponential with equal jitter, like message delivery.
+func (b *Backend) backoff(attempt int) time.Duration {
+	d := b.policy.RetryBackoff << min(attempt-1, 16)
+	if d <= 0 || d > b.policy.MaxBackoff {
+		d = b.policy.MaxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (b *Backend) authorize(ctx context.Context, req *http.Request) {
+	if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	actor, ok := domain.ActorFrom(ctx)
+	if !ok {
+		return
+	}
+	if actor.UserID != 0 {
+		req.Header.Set("X-Acting-User-Id", strconv.FormatInt(actor.UserID, 10))
+	}
+	if actor.Role != "" {
+		req.Header.Set("X-Acting-User-Role", string(actor.Role))
+	}
+	if actor.Email != "" {
+		req.Header.Set("X-Acting-User-Email", actor.Email)
+	}
+	if actor.ChatID != 0 {
+		req.Header.Set("X-Acting-Chat-Id", strconv.FormatInt(actor.ChatID, 10))
+	}
+}
+
 func (b *Backend) get(ctx context.Context, p string, query url.Values, out any) error {
 	return b.doRequest(ctx, http.MethodGet, p, query, nil, out)
 }
@@ -351,12 +528,27 @@ func (b *Backend) GetDormRoom(ctx context.Context, studentID int64) (*domain.Dor
 	return &result, nil
 }
 
-func (b *Backend) CreateDormMaintenance(ctx context.Context, studentID int64, requestType, description string) (int64, error) {
+func (b *Backend) ListDormRooms(ctx context.Context, studentIDs []int64) ([]domain.DormRoom, error) {
+	q := url.Values{}
+	for _, id := range studentIDs {
+		q.Add("student_id", strconv.FormatInt(id, 10))
+	}
+	var result []domain.DormRoom
+	if err := b.get(ctx, "/api/v1/dorms/rooms", q, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (b *Backend) CreateDormMaintenance(ctx context.Context, studentID int64, requestType, description, attachmentURL string) (int64, error) {
 	payload := map[string]any{
 		"student_id":   studentID,
 		"request_type": requestType,
 		"description":  description,
 	}
+	if attachmentURL != "" {
+		payload["attachment_url"] = attachmentURL
+	}
 	var resp struct {
 		RequestID int64 `json:"request_id"`
 	}
@@ -0,0 +1,202 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// clock is a settable time source for breaker cooldowns.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestBackend points a client at handler and counts the requests that
+// reach it.
+func newTestBackend(t *testing.T, policy Policy, handler http.HandlerFunc) (*Backend, *atomic.Int32, *clock) {
+	t.Helper()
+	hits := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	if policy.RetryBackoff == 0 {
+		policy.RetryBackoff = time.Millisecond
+	}
+	b := New(srv.URL, "", 5*time.Second, policy, zerolog.Nop())
+	clk := &clock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	b.now = clk.Now
+	return b, hits, clk
+}
+
+func status(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte("{}"))
+	}
+}
+
+func TestDoRequestRetriesOnlyReads(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		status    int
+		wantCalls int32
+	}{
+		{"get server error", http.MethodGet, http.StatusBadGateway, 3},
+		{"get rate limited", http.MethodGet, http.StatusTooManyRequests, 3},
+		{"get not found", http.MethodGet, http.StatusNotFound, 1},
+		{"get bad request", http.MethodGet, http.StatusBadRequest, 1},
+		{"post server error", http.MethodPost, http.StatusBadGateway, 1},
+		{"put server error", http.MethodPut, http.StatusBadGateway, 1},
+		{"get ok", http.MethodGet, http.StatusOK, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, hits, _ := newTestBackend(t, Policy{MaxRetries: 2}, status(tt.status))
+			_ = b.doRequest(context.Background(), tt.method, "/api/v1/events/7/rsvp", nil, map[string]any{"user_id": 1}, nil)
+			if got := hits.Load(); got != tt.wantCalls {
+				t.Fatalf("requests = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestBreakerCountsOnlyBackendFailures(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		wantErr     error
+		wantBlocked bool
+	}{
+		{"server error", http.StatusInternalServerError, domain.ErrTemporary, true},
+		{"bad request", http.StatusBadRequest, nil, false},
+		{"not found", http.StatusNotFound, domain.ErrNotFound, false},
+		{"forbidden", http.StatusForbidden, domain.ErrForbidden, false},
+		{"conflict", http.StatusConflict, domain.ErrConflict, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, hits, _ := newTestBackend(t, Policy{BreakerThreshold: 2, BreakerCooldown: time.Minute}, status(tt.status))
+			for range 2 {
+				err := b.get(context.Background(), "/api/v1/schedule/7", nil, nil)
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+			}
+
+			err := b.get(context.Background(), "/api/v1/schedule/8", nil, nil)
+			if blocked := hits.Load() == 2; blocked != tt.wantBlocked {
+				t.Fatalf("third request blocked = %v, want %v (err %v)", blocked, tt.wantBlocked, err)
+			}
+			var unavailable *domain.UnavailableError
+			if errors.As(err, &unavailable) != tt.wantBlocked {
+				t.Fatalf("err = %v, want UnavailableError only when blocked", err)
+			}
+		})
+	}
+}
+
+func TestBreakerRejectsWhileOpen(t *testing.T) {
+	b, hits, clk := newTestBackend(t, Policy{BreakerThreshold: 1, BreakerCooldown: time.Minute}, status(http.StatusServiceUnavailable))
+	if err := b.get(context.Background(), "/api/v1/schedule/7", nil, nil); err == nil {
+		t.Fatal("first request succeeded")
+	}
+
+	clk.Advance(59 * time.Second)
+	err := b.get(context.Background(), "/api/v1/schedule/7", nil, nil)
+	var unavailable *domain.UnavailableError
+	if !errors.As(err, &unavailable) || !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("err = %v, want UnavailableError wrapping errCircuitOpen", err)
+	}
+	if unavailable.Subsystem != "schedule" {
+		t.Fatalf("subsystem = %q, want schedule", unavailable.Subsystem)
+	}
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("requests = %d, want 1: open breaker let a call through", got)
+	}
+	if err := b.get(context.Background(), "/api/v1/news", nil, nil); errors.Is(err, errCircuitOpen) {
+		t.Fatalf("other endpoint rejected: %v", err)
+	}
+}
+
+func TestBreakerHalfOpenLetsOneProbeThrough(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	probing := make(chan struct{})
+	release := make(chan struct{})
+	b, hits, clk := newTestBackend(t, Policy{BreakerThreshold: 1, BreakerCooldown: time.Minute}, func(w http.ResponseWriter, _ *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		close(probing)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+	_ = b.get(context.Background(), "/api/v1/schedule/7", nil, nil)
+	failing.Store(false)
+	clk.Advance(time.Minute)
+
+	probe := make(chan error, 1)
+	go func() { probe <- b.get(context.Background(), "/api/v1/schedule/7", nil, nil) }()
+	<-probing
+
+	for range 3 {
+		if err := b.get(context.Background(), "/api/v1/schedule/7", nil, nil); !errors.Is(err, errCircuitOpen) {
+			t.Fatalf("call during probe: err = %v, want errCircuitOpen", err)
+		}
+	}
+	close(release)
+	if err := <-probe; err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("requests = %d, want 2", got)
+	}
+
+	failing.Store(true)
+	if err := b.get(context.Background(), "/api/v1/schedule/7", nil, nil); errors.Is(err, errCircuitOpen) {
+		t.Fatalf("breaker still open after a successful probe: %v", err)
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	b, hits, clk := newTestBackend(t, Policy{BreakerThreshold: 3, BreakerCooldown: time.Minute}, status(http.StatusBadGateway))
+	for range 3 {
+		_ = b.get(context.Background(), "/api/v1/schedule/7", nil, nil)
+	}
+	clk.Advance(time.Minute)
+	if err := b.get(context.Background(), "/api/v1/schedule/7", nil, nil); errors.Is(err, errCircuitOpen) {
+		t.Fatalf("probe rejected: %v", err)
+	}
+	if err := b.get(context.Background(), "/api/v1/schedule/7", nil, nil); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("after failed probe: err = %v, want errCircuitOpen", err)
+	}
+	if got := hits.Load(); got != 4 {
+		t.Fatalf("requests = %d, want 4", got)
+	}
+}
@@ -0,0 +1,124 @@
+package httpclient
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errCircuitOpen = errors.New("circuit breaker open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker guards one backend endpoint. It opens after threshold consecutive
+// failures and rejects calls until cooldown passes, then lets a single probe
+// through: success closes it again, failure reopens it.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow reports whether a call may go out. Every allowed call must be
+// followed by success, failure or release.
+func (br *breaker) allow(now time.Time) bool {
+	if br.threshold <= 0 {
+		return true
+	}
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	switch br.state {
+	case breakerOpen:
+		if now.Sub(br.openedAt) < br.cooldown {
+			return false
+		}
+		br.state = breakerHalfOpen
+	case breakerClosed:
+		return true
+	}
+	if br.probing {
+		return false
+	}
+	br.probing = true
+	return true
+}
+
+func (br *breaker) success() {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.state = breakerClosed
+	br.failures = 0
+	br.probing = false
+}
+
+// failure records a failed call and reports whether it opened the breaker.
+func (br *breaker) failure(now time.Time) bool {
+	if br.threshold <= 0 {
+		return false
+	}
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.probing = false
+	br.failures++
+	if br.state == breakerHalfOpen || br.failures >= br.threshold {
+		wasOpen := br.state == breakerOpen
+		br.state = breakerOpen
+		br.openedAt = now
+		return !wasOpen
+	}
+	return false
+}
+
+// release ends a call that told nothing about the endpoint's health, e.g.
+// one cancelled by the caller.
+func (br *breaker) release() {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	br.probing = false
+}
+
+func (b *Backend) breaker(endpoint string) *breaker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.breakers[endpoint]
+	if !ok {
+		br = &breaker{threshold: b.policy.BreakerThreshold, cooldown: b.policy.BreakerCooldown}
+		b.breakers[endpoint] = br
+	}
+	return br
+}
+
+// endpointKey names an endpoint with IDs replaced by a placeholder, so
+// /api/v1/schedule/7 and /api/v1/schedule/8 share one breaker.
+func endpointKey(method, p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		if _, err := strconv.ParseInt(seg, 10, 64); err == nil {
+			segments[i] = ":id"
+		}
+	}
+	return method + " " + strings.Join(segments, "/")
+}
+
+// subsystem returns the API section of a path: "schedule" for
+// /api/v1/schedule/7.
+func subsystem(p string) string {
+	rest := strings.TrimPrefix(strings.TrimPrefix(p, "/"), "api/v1/")
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest
+}
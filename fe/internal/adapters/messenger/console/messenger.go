@@ -0,0 +1,206 @@
+package console
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+	"github.com/escalopa/inno-vkode/internal/ports"
+)
+
+// The console plays a single private chat.
+const (
+	chatID = 1
+	userID = 1
+)
+
+const help = `Type a message and press Enter. Enter a button number to tap it.
+  :start [payload]  press Start, optionally through a deep link
+  :contact <phone>  share a contact
+  :file <name>      send a file attachment
+  :help             show this help
+  :quit             exit`
+
+// Messenger is a terminal REPL standing in for a real messenger, so the bot
+// can be tried without a platform token. Keyboards are printed as numbered
+// lists and typing a number taps the button.
+type Messenger struct {
+	in  io.Reader
+	out io.Writer
+	log zerolog.Logger
+
+	mu      sync.Mutex
+	buttons []domain.KeyboardButton
+	lastID  int
+}
+
+var _ ports.Messenger = (*Messenger)(nil)
+
+func New(in io.Reader, out io.Writer, log zerolog.Logger) *Messenger {
+	return &Messenger{in: in, out: out, log: log}
+}
+
+func (m *Messenger) Start(ctx context.Context, handler func(context.Context, domain.Update) (domain.CallbackAnswer, error)) error {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(m.in)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	m.printf("%s\n\n", help)
+	// Kick off the conversation the way a user opening the bot would.
+	m.handle(ctx, handler, domain.Update{Type: domain.UpdateTypeStarted})
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case line, ok := <-lines:
+			if !ok {
+				return nil
+			}
+			line = strings.TrimSpace(line)
+			if line == ":quit" {
+				return nil
+			}
+			upd, ok := m.parseLine(line)
+			if !ok {
+				continue
+			}
+			m.handle(ctx, handler, upd)
+		}
+	}
+}
+
+func (m *Messenger) handle(ctx context.Context, handler func(context.Context, domain.Update) (domain.CallbackAnswer, error), upd domain.Update) {
+	upd.ChatID = chatID
+	upd.UserID = userID
+	answer, err := handler(ctx, upd)
+	if err != nil {
+		m.log.Error().Err(err).Msg("bot handler error")
+	}
+	switch {
+	case answer.Alert:
+		m.printf("[alert] %s\n", answer.Text)
+	case answer.Text != "":
+		m.printf("[toast] %s\n", answer.Text)
+	}
+}
+
+func (m *Messenger) parseLine(line string) (domain.Update, bool) {
+	switch {
+	case line == "":
+		return domain.Update{}, false
+	case line == ":help":
+		m.printf("%s\n", help)
+		return domain.Update{}, false
+	case line == ":start" || strings.HasPrefix(line, ":start "):
+		return domain.Update{
+			Type:    domain.UpdateTypeStarted,
+			Payload: strings.TrimSpace(strings.TrimPrefix(line, ":start")),
+		}, true
+	case strings.HasPrefix(line, ":contact "):
+		return domain.Update{
+			Type:    domain.UpdateTypeContact,
+			Contact: &domain.Contact{Phone: strings.TrimSpace(strings.TrimPrefix(line, ":contact ")), UserID: userID},
+		}, true
+	case strings.HasPrefix(line, ":file "):
+		name := strings.TrimSpace(strings.TrimPrefix(line, ":file "))
+		return domain.Update{
+			Type: domain.UpdateTypeMessage,
+			Attachments: []domain.Attachment{{
+				Kind:     domain.AttachmentFile,
+				FileName: filepath.Base(name),
+				MIMEType: domain.MIMETypeFromName(name),
+				URL:      "file://" + name,
+			}},
+		}, true
+	}
+	if n, err := strconv.Atoi(line); err == nil {
+		if btn, ok := m.button(n); ok {
+			return m.tap(btn)
+		}
+	}
+	return domain.Update{Type: domain.UpdateTypeMessage, Text: line}, true
+}
+
+func (m *Messenger) tap(btn domain.KeyboardButton) (domain.Update, bool) {
+	switch btn.Kind {
+	case domain.ButtonKindLink:
+		m.printf("(opens %s)\n", btn.URL)
+		return domain.Update{}, false
+	case domain.ButtonKindContact:
+		m.printf("(use :contact <phone> to share a number)\n")
+		return domain.Update{}, false
+	}
+	payload := btn.Payload
+	if payload == "" {
+		payload = btn.Label
+	}
+	return domain.Update{Type: domain.UpdateTypeCallback, Payload: payload}, true
+}
+
+func (m *Messenger) button(n int) (domain.KeyboardButton, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if n < 1 || n > len(m.buttons) {
+		return domain.KeyboardButton{}, false
+	}
+	return m.buttons[n-1], true
+}
+
+func (m *Messenger) Send(ctx context.Context, chatID, userID int64, msg domain.OutgoingMessage) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	id := strconv.Itoa(m.lastID)
+	m.render("#"+id, msg)
+	return id, nil
+}
+
+func (m *Messenger) Edit(ctx context.Context, chatID int64, messageID string, msg domain.OutgoingMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.render("#"+messageID+" (edited)", msg)
+	return nil
+}
+
+func (m *Messenger) Delete(ctx context.Context, chatID int64, messageID string) error {
+	m.printf("(message #%s deleted)\n", messageID)
+	return nil
+}
+
+// render prints a message and makes its keyboard the one numbers refer to.
+// Callers hold m.mu.
+func (m *Messenger) render(header string, msg domain.OutgoingMessage) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n── bot %s ──\n%s\n", header, msg.Text)
+	if msg.Keyboard != nil && len(msg.Keyboard.Rows) > 0 {
+		m.buttons = m.buttons[:0]
+		for _, row := range msg.Keyboard.Rows {
+			for _, btn := range row {
+				m.buttons = append(m.buttons, btn)
+				fmt.Fprintf(&b, "  [%d] %s\n", len(m.buttons), btn.Label)
+			}
+		}
+	}
+	fmt.Fprint(m.out, b.String())
+}
+
+func (m *Messenger) printf(format string, args ...any) {
+	fmt.Fprintf(m.out, format, args...)
+}
@@ -0,0 +1,66 @@
+package delivery
+
+import (
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket that hands out reservations: a caller takes a
+// token right away and waits for the returned delay, so concurrent callers
+// queue up in arrival order instead of racing for the next refill.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int, now time.Time) *bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: now}
+}
+
+// reserve takes one token and returns how long the caller must wait before
+// using it. A non-positive rate disables the limit.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a token taken by reserve that was not used.
+func (b *bucket) cancel() {
+	if b.rate <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.tokens = min(b.tokens+1, b.burst)
+	b.mu.Unlock()
+}
+
+// idle reports whether the bucket is full again, i.e. it carries no state
+// worth keeping.
+func (b *bucket) idle(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(b.tokens+elapsed.Seconds()*b.rate, b.burst)
+		b.last = now
+	}
+}
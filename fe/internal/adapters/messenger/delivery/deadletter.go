@@ -0,0 +1,60 @@
+package delivery
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// deadLetter describes an outbound message the layer gave up on. The text is
+// left out, it may hold personal data; Length is its size in characters.
+type deadLetter struct {
+	Time      time.Time `json:"time"`
+	Op        string    `json:"op"`
+	ChatID    int64     `json:"chat_id"`
+	UserID    int64     `json:"user_id,omitempty"`
+	MessageID string    `json:"message_id,omitempty"`
+	Length    int       `json:"length"`
+	Attempts  int       `json:"attempts"`
+	Error     string    `json:"error"`
+}
+
+// deadLetterLog records undeliverable messages in the service log and, when a
+// path is configured, appends them as JSON lines to a file.
+type deadLetterLog struct {
+	path string
+	log  zerolog.Logger
+	mu   sync.Mutex
+}
+
+func (d *deadLetterLog) record(entry deadLetter) {
+	d.log.Error().
+		Str("op", entry.Op).
+		Int64("chat_id", entry.ChatID).
+		Str("message_id", entry.MessageID).
+		Int("attempts", entry.Attempts).
+		Str("error", entry.Error).
+		Msg("message dead-lettered")
+	if d.path == "" {
+		return
+	}
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		d.log.Error().Err(err).Msg("failed to encode dead letter")
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, err := os.OpenFile(d.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		d.log.Error().Err(err).Str("path", d.path).Msg("failed to open dead letter file")
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(raw, '\n')); err != nil {
+		d.log.Error().Err(err).Str("path", d.path).Msg("failed to write dead letter")
+	}
+}
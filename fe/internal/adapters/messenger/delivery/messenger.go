@@ -0,0 +1,256 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+	"github.com/escalopa/inno-vkode/internal/ports"
+)
+
+var stats = expvar.NewMap("message_delivery")
+
+type Config struct {
+	// GlobalRate and ChatRate are messages per second; zero disables the limit.
+	GlobalRate     float64
+	GlobalBurst    int
+	ChatRate       float64
+	ChatBurst      int
+	MaxRetries     int
+	RetryBackoff   time.Duration
+	MaxBackoff     time.Duration
+	DeadLetterPath string
+}
+
+// Messenger wraps a platform messenger with outbound rate limiting and
+// retries. Callers block while their message waits for a token, so the
+// per-chat update workers double as the delivery queue and messages to one
+// chat keep their order.
+type Messenger struct {
+	next        ports.Messenger
+	cfg         Config
+	log         zerolog.Logger
+	now         func() time.Time
+	global      *bucket
+	deadLetters *deadLetterLog
+
+	mu        sync.Mutex
+	chats     map[int64]*bucket
+	lastSweep time.Time
+
+	sent        *expvar.Int
+	edited      *expvar.Int
+	deleted     *expvar.Int
+	retries     *expvar.Int
+	rateLimited *expvar.Int
+	throttled   *expvar.Int
+	failed      *expvar.Int
+	dead        *expvar.Int
+}
+
+var _ ports.Messenger = (*Messenger)(nil)
+
+func New(next ports.Messenger, cfg Config, log zerolog.Logger) *Messenger {
+	if cfg.RetryBackoff <= 0 {
+		cfg.RetryBackoff = 500 * time.Millisecond
+	}
+	if cfg.MaxBackoff < cfg.RetryBackoff {
+		cfg.MaxBackoff = cfg.RetryBackoff
+	}
+	log = log.With().Str("component", "delivery").Logger()
+	now := time.Now()
+	return &Messenger{
+		next:        next,
+		cfg:         cfg,
+		log:         log,
+		now:         time.Now,
+		global:      newBucket(cfg.GlobalRate, cfg.GlobalBurst, now),
+		deadLetters: &deadLetterLog{path: cfg.DeadLetterPath, log: log},
+		chats:       make(map[int64]*bucket),
+		lastSweep:   now,
+		sent:        counter("sent"),
+		edited:      counter("edited"),
+		deleted:     counter("deleted"),
+		retries:     counter("retries"),
+		rateLimited: counter("rate_limited"),
+		throttled:   counter("throttled"),
+		failed:      counter("failed"),
+		dead:        counter("dead_letters"),
+	}
+}
+
+func counter(key string) *expvar.Int {
+	if v, ok := stats.Get(key).(*expvar.Int); ok {
+		return v
+	}
+	v := new(expvar.Int)
+	stats.Set(key, v)
+	return v
+}
+
+func (m *Messenger) Start(ctx context.Context, handler func(context.Context, domain.Update) (domain.CallbackAnswer, error)) error {
+	return m.next.Start(ctx, handler)
+}
+
+func (m *Messenger) Send(ctx context.Context, chatID, userID int64, msg domain.OutgoingMessage) (string, error) {
+	var messageID string
+	attempts, err := m.deliver(ctx, "send", chatID, false, func(ctx context.Context) error {
+		var err error
+		messageID, err = m.next.Send(ctx, chatID, userID, msg)
+		return err
+	})
+	if err != nil {
+		m.failed.Add(1)
+		if ctx.Err() == nil {
+			m.dead.Add(1)
+			m.deadLetters.record(deadLetter{
+				Time:     m.now(),
+				Op:       "send",
+				ChatID:   chatID,
+				UserID:   userID,
+				Length:   len([]rune(msg.Text)),
+				Attempts: attempts,
+				Error:    err.Error(),
+			})
+		}
+		return "", err
+	}
+	m.sent.Add(1)
+	return messageID, nil
+}
+
+// Edit and Delete are retried on any transient failure, since repeating them
+// is harmless, but never dead-lettered: the service falls back to sending a
+// fresh message when they fail.
+func (m *Messenger) Edit(ctx context.Context, chatID int64, messageID string, msg domain.OutgoingMessage) error {
+	_, err := m.deliver(ctx, "edit", chatID, true, func(ctx context.Context) error {
+		return m.next.Edit(ctx, chatID, messageID, msg)
+	})
+	if err != nil {
+		m.failed.Add(1)
+		return err
+	}
+	m.edited.Add(1)
+	return nil
+}
+
+func (m *Messenger) Delete(ctx context.Context, chatID int64, messageID string) error {
+	_, err := m.deliver(ctx, "delete", chatID, true, func(ctx context.Context) error {
+		return m.next.Delete(ctx, chatID, messageID)
+	})
+	if err != nil {
+		m.failed.Add(1)
+		return err
+	}
+	m.deleted.Add(1)
+	return nil
+}
+
+// deliver runs call under the rate limits and retries it while the platform
+// throttles us or fails transiently. Calls that are not idempotent are only
+// retried when the failure happened before the request reached the platform.
+// It returns the number of attempts made.
+func (m *Messenger) deliver(ctx context.Context, op string, chatID int64, idempotent bool, call func(context.Context) error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		if err := m.throttle(ctx, chatID); err != nil {
+			return attempt - 1, err
+		}
+		err := call(ctx)
+		if err == nil {
+			return attempt, nil
+		}
+		delay, retryable := m.retryDelay(err, attempt, idempotent)
+		if !retryable || attempt > m.cfg.MaxRetries {
+			return attempt, err
+		}
+		m.retries.Add(1)
+		m.log.Warn().
+			Err(err).
+			Str("op", op).
+			Int64("chat_id", chatID).
+			Int("attempt", attempt).
+			Dur("retry_in", delay).
+			Msg("message delivery failed, retrying")
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// throttle waits for both the global and the chat bucket.
+func (m *Messenger) throttle(ctx context.Context, chatID int64) error {
+	now := m.now()
+	chat := m.chatBucket(chatID, now)
+	wait := max(m.global.reserve(now), chat.reserve(now))
+	if wait <= 0 {
+		return nil
+	}
+	m.throttled.Add(1)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		m.global.cancel()
+		chat.cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (m *Messenger) chatBucket(chatID int64, now time.Time) *bucket {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now.Sub(m.lastSweep) > time.Minute {
+		for id, b := range m.chats {
+			if b.idle(now) {
+				delete(m.chats, id)
+			}
+		}
+		m.lastSweep = now
+	}
+	b, ok := m.chats[chatID]
+	if !ok {
+		b = newBucket(m.cfg.ChatRate, m.cfg.ChatBurst, now)
+		m.chats[chatID] = b
+	}
+	return b
+}
+
+// retryDelay decides whether err is worth another attempt and how long to
+// wait first. Platform hints are honoured, with jitter on top so throttled
+// chats do not retry in lockstep.
+func (m *Messenger) retryDelay(err error, attempt int, idempotent bool) (time.Duration, bool) {
+	var rateErr *domain.RateLimitError
+	switch {
+	case errors.As(err, &rateErr):
+		m.rateLimited.Add(1)
+		if rateErr.RetryAfter > 0 {
+			return rateErr.RetryAfter + rand.N(m.cfg.RetryBackoff), true
+		}
+		return m.backoff(attempt), true
+	case errors.Is(err, domain.ErrNotSent):
+		return m.backoff(attempt), true
+	case idempotent && errors.Is(err, domain.ErrTemporary):
+		return m.backoff(attempt), true
+	default:
+		return 0, false
+	}
+}
+
+// backoff is exponential with equal jitter.
+func (m *Messenger) backoff(attempt int) time.Duration {
+	d := m.cfg.RetryBackoff << min(attempt-1, 16)
+	if d <= 0 || d > m.cfg.MaxBackoff {
+		d = m.cfg.MaxBackoff
+	}
+	return d/2 + rand.N(d/2+1)
+}
@@ -0,0 +1,120 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// flakyMessenger fails the first len(errs) calls with errs in order.
+type flakyMessenger struct {
+	errs  []error
+	calls int
+}
+
+func (m *flakyMessenger) Start(context.Context, func(context.Context, domain.Update) (domain.CallbackAnswer, error)) error {
+	return nil
+}
+
+func (m *flakyMessenger) call() error {
+	m.calls++
+	if m.calls <= len(m.errs) {
+		return m.errs[m.calls-1]
+	}
+	return nil
+}
+
+func (m *flakyMessenger) Send(context.Context, int64, int64, domain.OutgoingMessage) (string, error) {
+	if err := m.call(); err != nil {
+		return "", err
+	}
+	return "msg-1", nil
+}
+
+func (m *flakyMessenger) Edit(context.Context, int64, string, domain.OutgoingMessage) error {
+	return m.call()
+}
+
+func (m *flakyMessenger) Delete(context.Context, int64, string) error {
+	return m.call()
+}
+
+func newTestMessenger(next *flakyMessenger, deadLetters string) *Messenger {
+	return New(next, Config{
+		MaxRetries:     3,
+		RetryBackoff:   time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		DeadLetterPath: deadLetters,
+	}, zerolog.Nop())
+}
+
+func TestSendRetriesOnlyFailuresBeforeTheRequest(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	tests := []struct {
+		name      string
+		err       error
+		wantCalls int
+	}{
+		{"rate limited", &domain.RateLimitError{Err: errors.New("429")}, 2},
+		{"connection refused", fmt.Errorf("%w: %w: %w", domain.ErrTemporary, domain.ErrNotSent, dialErr), 2},
+		{"timeout", fmt.Errorf("%w: %w", domain.ErrTemporary, context.DeadlineExceeded), 1},
+		{"server error", fmt.Errorf("%w: 502", domain.ErrTemporary), 1},
+		{"bad request", errors.New("400"), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := &flakyMessenger{errs: []error{tt.err}}
+			m := newTestMessenger(next, "")
+			_, _ = m.Send(context.Background(), 1, 1, domain.OutgoingMessage{Text: "hi"})
+			if next.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", next.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestEditRetriesTransientFailures(t *testing.T) {
+	next := &flakyMessenger{errs: []error{fmt.Errorf("%w: 502", domain.ErrTemporary)}}
+	m := newTestMessenger(next, "")
+	if err := m.Edit(context.Background(), 1, "msg-1", domain.OutgoingMessage{Text: "hi"}); err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	if next.calls != 2 {
+		t.Errorf("calls = %d, want 2", next.calls)
+	}
+}
+
+func TestDeadLettersLeaveOutText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	next := &flakyMessenger{errs: []error{errors.New("chat not found")}}
+	m := newTestMessenger(next, path)
+	if _, err := m.Send(context.Background(), 7, 8, domain.OutgoingMessage{Text: "код 123456"}); err == nil {
+		t.Fatalf("Send succeeded")
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read dead letters: %v", err)
+	}
+	if strings.Contains(string(raw), "123456") {
+		t.Fatalf("dead letter contains the message text: %s", raw)
+	}
+	var entry deadLetter
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		t.Fatalf("decode dead letter: %v", err)
+	}
+	if entry.ChatID != 7 || entry.Length != 10 || entry.Attempts != 1 || entry.Op != "send" {
+		t.Errorf("dead letter = %+v", entry)
+	}
+}
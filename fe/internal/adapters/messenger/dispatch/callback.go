@@ -0,0 +1,55 @@
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// callbackAnswerTimeout bounds a single answer call.
+const callbackAnswerTimeout = 5 * time.Second
+
+// AnswerCallback runs handle for a button press and answers the press with
+// its result. The answer is sent on a short-lived context of its own: by the
+// time handle returns, ctx may be past its deadline.
+//
+// Platforms keep a spinner on the button until the press is answered and give
+// up after a few seconds. If handle is still running after CallbackAckAfter, an
+// empty answer goes out right away; a press is answered only once, so the
+// handler's own answer is then dropped.
+func (p *Pool) AnswerCallback(
+	ctx context.Context,
+	handle func(context.Context) domain.CallbackAnswer,
+	answer func(context.Context, domain.CallbackAnswer),
+) {
+	var (
+		mu       sync.Mutex
+		answered bool
+	)
+	reply := func(a domain.CallbackAnswer) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if answered {
+			return false
+		}
+		answered = true
+		actx, cancel := context.WithTimeout(context.WithoutCancel(ctx), callbackAnswerTimeout)
+		defer cancel()
+		answer(actx, a)
+		return true
+	}
+
+	if p.cfg.CallbackAckAfter > 0 {
+		timer := time.AfterFunc(p.cfg.CallbackAckAfter, func() {
+			p.acks.Add(1)
+			reply(domain.CallbackAnswer{})
+		})
+		defer timer.Stop()
+	}
+	result := handle(ctx)
+	if !reply(result) && result.Text != "" {
+		p.log.Debug().Str("text", result.Text).Msg("callback already acknowledged, answer dropped")
+	}
+}
@@ -0,0 +1,83 @@
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+type answers struct {
+	mu   sync.Mutex
+	got  []domain.CallbackAnswer
+	errs []error
+}
+
+func (a *answers) record(ctx context.Context, answer domain.CallbackAnswer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.got = append(a.got, answer)
+	a.errs = append(a.errs, ctx.Err())
+}
+
+func (a *answers) snapshot() ([]domain.CallbackAnswer, []error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]domain.CallbackAnswer(nil), a.got...), append([]error(nil), a.errs...)
+}
+
+func TestAnswerCallbackSendsHandlerAnswer(t *testing.T) {
+	p := New("test", Config{CallbackAckAfter: time.Second}, zerolog.Nop())
+	var a answers
+	p.AnswerCallback(context.Background(), func(context.Context) domain.CallbackAnswer {
+		return domain.CallbackAnswer{Text: "done", Alert: true}
+	}, a.record)
+
+	got, _ := a.snapshot()
+	if len(got) != 1 || got[0].Text != "done" || !got[0].Alert {
+		t.Fatalf("answers = %+v, want the handler's answer once", got)
+	}
+}
+
+func TestAnswerCallbackOutlivesHandlerDeadline(t *testing.T) {
+	p := New("test", Config{}, zerolog.Nop())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var a answers
+	p.AnswerCallback(ctx, func(ctx context.Context) domain.CallbackAnswer {
+		<-ctx.Done()
+		return domain.CallbackAnswer{Text: "late"}
+	}, a.record)
+
+	got, errs := a.snapshot()
+	if len(got) != 1 || got[0].Text != "late" {
+		t.Fatalf("answers = %+v, want the handler's answer", got)
+	}
+	if errs[0] != nil {
+		t.Errorf("answer context already done: %v", errs[0])
+	}
+}
+
+func TestAnswerCallbackAcknowledgesSlowHandlers(t *testing.T) {
+	p := New("test", Config{CallbackAckAfter: 10 * time.Millisecond}, zerolog.Nop())
+	var a answers
+	p.AnswerCallback(context.Background(), func(context.Context) domain.CallbackAnswer {
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if got, _ := a.snapshot(); len(got) > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return domain.CallbackAnswer{Text: "too late"}
+	}, a.record)
+
+	got, _ := a.snapshot()
+	if len(got) != 1 || got[0] != (domain.CallbackAnswer{}) {
+		t.Fatalf("answers = %+v, want a single empty acknowledgement", got)
+	}
+}
@@ -0,0 +1,231 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var stats = expvar.NewMap("update_dispatch")
+
+type Config struct {
+	Workers        int
+	QueueSize      int
+	HandlerTimeout time.Duration
+	// CallbackAckAfter is how long a button press may go unanswered before
+	// AnswerCallback acknowledges it; zero waits for the handler.
+	CallbackAckAfter time.Duration
+}
+
+type job struct {
+	chatID int64
+	fn     func(context.Context)
+}
+
+// chatQueue holds the pending updates of one chat. A chat is either waiting
+// in the ready list or being run by a worker, never both, which keeps its
+// updates in order.
+type chatQueue struct {
+	jobs []job
+}
+
+// Pool runs update handlers concurrently. Every chat has its own queue and
+// any free worker takes the next job from the chat that has waited longest,
+// so chats are processed in parallel while each keeps its strict order, and
+// a slow handler holds up only its own chat rather than every chat that
+// happens to share a worker with it.
+type Pool struct {
+	name string
+	cfg  Config
+	log  zerolog.Logger
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	work    *sync.Cond
+	chats   map[int64]*chatQueue
+	ready   []int64
+	pending int
+	stopped bool
+	// space is closed and replaced whenever a job leaves a queue, waking
+	// submitters that wait for room.
+	space chan struct{}
+
+	depth     *expvar.Int
+	processed *expvar.Int
+	timeouts  *expvar.Int
+	panics    *expvar.Int
+	full      *expvar.Int
+	dropped   *expvar.Int
+	acks      *expvar.Int
+}
+
+func New(name string, cfg Config, log zerolog.Logger) *Pool {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1
+	}
+	p := &Pool{
+		name:      name,
+		cfg:       cfg,
+		log:       log.With().Str("pool", name).Logger(),
+		chats:     make(map[int64]*chatQueue),
+		space:     make(chan struct{}),
+		depth:     counter(name + ".queue_depth"),
+		processed: counter(name + ".processed"),
+		timeouts:  counter(name + ".timeouts"),
+		panics:    counter(name + ".panics"),
+		full:      counter(name + ".queue_full"),
+		dropped:   counter(name + ".dropped"),
+		acks:      counter(name + ".callback_acks"),
+	}
+	p.work = sync.NewCond(&p.mu)
+	return p
+}
+
+func counter(key string) *expvar.Int {
+	if v, ok := stats.Get(key).(*expvar.Int); ok {
+		return v
+	}
+	v := new(expvar.Int)
+	stats.Set(key, v)
+	return v
+}
+
+// Start launches the workers. They exit once ctx is cancelled, leaving queued
+// updates behind; use Wait to block until in-flight handlers have returned.
+func (p *Pool) Start(ctx context.Context) {
+	context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.stopped = true
+		p.work.Broadcast()
+	})
+	for range p.cfg.Workers {
+		p.wg.Add(1)
+		go p.worker(ctx)
+	}
+}
+
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+// Submit enqueues fn for chatID. An update for a chat that already has
+// QueueSize updates pending is dropped, so one flooding or stuck chat cannot
+// hold up intake for the others. Submit blocks only while all chats together
+// have Workers*QueueSize pending, and returns an error only when ctx is
+// cancelled first.
+func (p *Pool) Submit(ctx context.Context, chatID int64, fn func(context.Context)) error {
+	warned := false
+	for {
+		p.mu.Lock()
+		q := p.chats[chatID]
+		if q != nil && len(q.jobs) >= p.cfg.QueueSize {
+			p.mu.Unlock()
+			p.dropped.Add(1)
+			p.log.Warn().Int64("chat_id", chatID).Msg("chat update queue is full, dropping update")
+			return nil
+		}
+		if p.pending < p.cfg.Workers*p.cfg.QueueSize {
+			if q == nil {
+				q = &chatQueue{}
+				p.chats[chatID] = q
+				p.ready = append(p.ready, chatID)
+				p.work.Signal()
+			}
+			q.jobs = append(q.jobs, job{chatID: chatID, fn: fn})
+			p.pending++
+			p.mu.Unlock()
+			p.depth.Add(1)
+			return nil
+		}
+		space := p.space
+		p.mu.Unlock()
+
+		if !warned {
+			warned = true
+			p.full.Add(1)
+			p.log.Warn().Int64("chat_id", chatID).Msg("update queue is full, waiting")
+		}
+		select {
+		case <-space:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *Pool) worker(ctx context.Context) {
+	defer p.wg.Done()
+	for {
+		j, ok := p.next()
+		if !ok {
+			return
+		}
+		p.run(ctx, j)
+		p.done(j.chatID)
+	}
+}
+
+// next takes the first job of the chat that has been ready the longest. The
+// chat leaves the ready list until done puts it back.
+func (p *Pool) next() (job, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.ready) == 0 && !p.stopped {
+		p.work.Wait()
+	}
+	if p.stopped {
+		return job{}, false
+	}
+	chatID := p.ready[0]
+	p.ready = p.ready[1:]
+	q := p.chats[chatID]
+	j := q.jobs[0]
+	q.jobs = q.jobs[1:]
+	p.pending--
+	close(p.space)
+	p.space = make(chan struct{})
+	p.depth.Add(-1)
+	return j, true
+}
+
+// done puts the chat back at the end of the ready list when it has more
+// updates, so a busy chat takes turns with the others.
+func (p *Pool) done(chatID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q := p.chats[chatID]
+	if len(q.jobs) == 0 {
+		delete(p.chats, chatID)
+		return
+	}
+	p.ready = append(p.ready, chatID)
+	p.work.Signal()
+}
+
+func (p *Pool) run(ctx context.Context, j job) {
+	if p.cfg.HandlerTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.cfg.HandlerTimeout)
+		defer cancel()
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			p.panics.Add(1)
+			p.log.Error().Interface("panic", r).Int64("chat_id", j.chatID).Msg("update handler panicked")
+		}
+	}()
+	j.fn(ctx)
+	p.processed.Add(1)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		p.timeouts.Add(1)
+		p.log.Warn().Int64("chat_id", j.chatID).Dur("timeout", p.cfg.HandlerTimeout).Msg("update handler timed out")
+	}
+}
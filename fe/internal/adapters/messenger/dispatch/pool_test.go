@@ -0,0 +1,138 @@
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func startPool(t *testing.T, cfg Config) *Pool {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	p := New("test", cfg, zerolog.Nop())
+	p.Start(ctx)
+	t.Cleanup(func() {
+		cancel()
+		p.Wait()
+	})
+	return p
+}
+
+func TestPoolKeepsChatOrder(t *testing.T) {
+	p := startPool(t, Config{Workers: 4, QueueSize: 100})
+	const (
+		chats   = 5
+		updates = 50
+	)
+	var (
+		mu  sync.Mutex
+		got = map[int64][]int{}
+		wg  sync.WaitGroup
+	)
+	wg.Add(chats * updates)
+	for i := 0; i < updates; i++ {
+		for chat := int64(1); chat <= chats; chat++ {
+			err := p.Submit(context.Background(), chat, func(context.Context) {
+				defer wg.Done()
+				mu.Lock()
+				got[chat] = append(got[chat], i)
+				mu.Unlock()
+			})
+			if err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+		}
+	}
+	wg.Wait()
+	for chat, seq := range got {
+		for i, v := range seq {
+			if v != i {
+				t.Fatalf("chat %d ran update %d at position %d", chat, v, i)
+			}
+		}
+	}
+}
+
+// With hash sharding chats 1 and 3 shared a worker on a two-worker pool, so
+// one slow handler held up the other chat.
+func TestPoolSlowChatDoesNotBlockOthers(t *testing.T) {
+	p := startPool(t, Config{Workers: 2, QueueSize: 8})
+	release := make(chan struct{})
+	defer close(release)
+	for i := 0; i < 3; i++ {
+		if err := p.Submit(context.Background(), 1, func(context.Context) { <-release }); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+
+	done := make(chan struct{})
+	start := time.Now()
+	if err := p.Submit(context.Background(), 3, func(context.Context) { close(done) }); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	select {
+	case <-done:
+		t.Logf("chat 3 handled %s after submit while chat 1 was stuck", time.Since(start))
+	case <-time.After(2 * time.Second):
+		t.Fatal("chat 3 waited behind the slow chat")
+	}
+}
+
+func TestPoolDropsUpdatesOfFullChatQueue(t *testing.T) {
+	p := startPool(t, Config{Workers: 2, QueueSize: 2})
+	release := make(chan struct{})
+	defer close(release)
+	running := make(chan struct{})
+
+	if err := p.Submit(context.Background(), 1, func(context.Context) { close(running); <-release }); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	<-running
+	// Two updates fill chat 1's queue; the rest are dropped without blocking.
+	for i := 0; i < 5; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := p.Submit(ctx, 1, func(context.Context) {})
+		cancel()
+		if err != nil {
+			t.Fatalf("Submit to the full chat blocked: %v", err)
+		}
+	}
+	if got := p.dropped.Value(); got < 3 {
+		t.Errorf("dropped = %d, want at least 3", got)
+	}
+
+	done := make(chan struct{})
+	if err := p.Submit(context.Background(), 2, func(context.Context) { close(done) }); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("chat 2 did not run while chat 1's queue was full")
+	}
+}
+
+func TestPoolSubmitBlocksWhileAllQueuesAreFull(t *testing.T) {
+	p := startPool(t, Config{Workers: 1, QueueSize: 2})
+	release := make(chan struct{})
+	defer close(release)
+	running := make(chan struct{})
+
+	if err := p.Submit(context.Background(), 1, func(context.Context) { close(running); <-release }); err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	<-running
+	for chat := int64(2); chat <= 3; chat++ {
+		if err := p.Submit(context.Background(), chat, func(context.Context) {}); err != nil {
+			t.Fatalf("Submit: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Submit(ctx, 4, func(context.Context) {}); err == nil {
+		t.Fatal("Submit did not block with every queue slot taken")
+	}
+}
@@ -2,37 +2,108 @@ package max
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/configservice"
 	"github.com/max-messenger/max-bot-api-client-go/schemes"
 	"github.com/rs/zerolog"
 
+	"github.com/escalopa/inno-vkode/internal/adapters/messenger/dispatch"
 	"github.com/escalopa/inno-vkode/internal/domain"
 	"github.com/escalopa/inno-vkode/internal/ports"
 )
 
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+// Config carries the API URL and version the client library was built with
+// (see APIConfig); requests the library cannot make are sent to the same
+// endpoint.
+type Config struct {
+	Token         string
+	APIURL        string
+	APIVersion    string
+	Mode          string
+	WebhookURL    string
+	WebhookListen string
+	WebhookSecret string
+}
+
+// APIConfig configures the client library. It turns on the library's debug
+// mode, the only way to keep the raw JSON of each update: bot_started payloads
+// are not decoded otherwise.
+type APIConfig struct {
+	Token   string
+	URL     string
+	Version string
+}
+
+var _ configservice.ConfigInterface = APIConfig{}
+
+func (c APIConfig) GetHttpBotAPIUrl() string        { return c.URL }
+func (c APIConfig) GetHttpBotAPITimeOut() int       { return 0 }
+func (c APIConfig) GetHttpBotAPIVersion() string    { return c.Version }
+func (c APIConfig) BotTokenCheckInInputSteam() bool { return false }
+func (c APIConfig) BotTokenCheckString() string     { return c.Token }
+func (c APIConfig) GetDebugLogMode() bool           { return true }
+func (c APIConfig) GetDebugLogChat() int64          { return 0 }
+
 type Messenger struct {
-	api *maxbot.Api
-	log zerolog.Logger
+	api      *maxbot.Api
+	cfg      Config
+	client   *http.Client
+	log      zerolog.Logger
+	dispatch dispatch.Config
 }
 
 var _ ports.Messenger = (*Messenger)(nil)
 
-func New(api *maxbot.Api, log zerolog.Logger) *Messenger {
+func New(api *maxbot.Api, cfg Config, log zerolog.Logger, dispatchCfg dispatch.Config) *Messenger {
 	return &Messenger{
-		api: api,
-		log: log,
+		api:      api,
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		log:      log,
+		dispatch: dispatchCfg,
 	}
 }
 
-func (m *Messenger) Start(ctx context.Context, handler func(context.Context, domain.Update) error) error {
-	updates := m.api.GetUpdates(ctx)
+func (m *Messenger) Start(ctx context.Context, handler func(context.Context, domain.Update) (domain.CallbackAnswer, error)) error {
+	pool := dispatch.New("max", m.dispatch, m.log)
+	pool.Start(ctx)
+	defer pool.Wait()
+
+	var (
+		updates   <-chan schemes.UpdateInterface
+		serverErr <-chan error
+	)
+	switch m.cfg.Mode {
+	case "", ModePolling:
+		updates = m.api.GetUpdates(ctx)
+	case ModeWebhook:
+		var err error
+		updates, serverErr, err = m.startWebhook(ctx)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown max mode %q", m.cfg.Mode)
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
+		case err := <-serverErr:
+			return fmt.Errorf("max webhook server: %w", err)
 		case upd, ok := <-updates:
 			if !ok {
 				return nil
@@ -41,11 +112,25 @@ func (m *Messenger) Start(ctx context.Context, handler func(context.Context, dom
 			if !ok {
 				continue
 			}
-			if err := handler(ctx, dUpdate); err != nil {
-				m.log.Error().Err(err).Msg("bot handler error")
-			}
-			if cb, ok := upd.(*schemes.MessageCallbackUpdate); ok {
-				go m.answerCallback(ctx, cb.Callback.CallbackID)
+			err := pool.Submit(ctx, dUpdate.ChatID, func(ctx context.Context) {
+				handle := func(ctx context.Context) domain.CallbackAnswer {
+					answer, err := handler(ctx, dUpdate)
+					if err != nil {
+						m.log.Error().Err(err).Msg("bot handler error")
+					}
+					return answer
+				}
+				cb, ok := upd.(*schemes.MessageCallbackUpdate)
+				if !ok {
+					handle(ctx)
+					return
+				}
+				pool.AnswerCallback(ctx, handle, func(ctx context.Context, answer domain.CallbackAnswer) {
+					m.answerCallback(ctx, cb.Callback.CallbackID, answer)
+				})
+			})
+			if err != nil {
+				return err
 			}
 		}
 	}
@@ -54,14 +139,20 @@ func (m *Messenger) Start(ctx context.Context, handler func(context.Context, dom
 func (m *Messenger) normalizeUpdate(upd schemes.UpdateInterface) (domain.Update, bool) {
 	switch u := upd.(type) {
 	case *schemes.MessageCreatedUpdate:
-		return domain.Update{
-			Type:      domain.UpdateTypeMessage,
-			ChatID:    u.Message.Recipient.ChatId,
-			UserID:    u.Message.Sender.UserId,
-			Text:      strings.TrimSpace(u.Message.Body.Text),
-			MessageID: u.Message.Body.Mid,
-			Raw:       upd,
-		}, true
+		out := domain.Update{
+			Type:        domain.UpdateTypeMessage,
+			ChatID:      u.Message.Recipient.ChatId,
+			UserID:      u.Message.Sender.UserId,
+			Text:        strings.TrimSpace(u.Message.Body.Text),
+			MessageID:   u.Message.Body.Mid,
+			Attachments: attachmentsFromBody(u.Message.Body),
+			Raw:         upd,
+		}
+		if contact := contactFromBody(u.Message.Body); contact != nil {
+			out.Type = domain.UpdateTypeContact
+			out.Contact = contact
+		}
+		return out, true
 	case *schemes.MessageCallbackUpdate:
 		var chatID int64
 		var mid string
@@ -77,24 +168,136 @@ func (m *Messenger) normalizeUpdate(upd schemes.UpdateInterface) (domain.Update,
 			MessageID: mid,
 			Raw:       upd,
 		}, true
+	case *schemes.BotStartedUpdate:
+		return domain.Update{
+			Type:    domain.UpdateTypeStarted,
+			ChatID:  u.ChatId,
+			UserID:  u.User.UserId,
+			Payload: startPayload(u.GetDebugRaw()),
+			Raw:     upd,
+		}, true
+	case *schemes.BotAddedToChatUpdate:
+		return domain.Update{
+			Type:   domain.UpdateTypeStarted,
+			ChatID: u.ChatId,
+			UserID: u.User.UserId,
+			Raw:    upd,
+		}, true
+	case *schemes.BotRemovedFromChatUpdate:
+		return domain.Update{
+			Type:   domain.UpdateTypeStopped,
+			ChatID: u.ChatId,
+			UserID: u.User.UserId,
+			Raw:    upd,
+		}, true
 	default:
 		return domain.Update{}, false
 	}
 }
 
-func (m *Messenger) answerCallback(ctx context.Context, callbackID string) {
+// startPayload reads the deep-link parameter of a bot_started update, which
+// the client library does not decode; see APIConfig.
+func startPayload(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	var body struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.Unmarshal([]byte(raw), &body); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(body.Payload)
+}
+
+func attachmentsFromBody(body schemes.MessageBody) []domain.Attachment {
+	var out []domain.Attachment
+	for _, raw := range body.Attachments {
+		switch a := raw.(type) {
+		case *schemes.FileAttachment:
+			out = append(out, domain.Attachment{
+				Kind:     domain.AttachmentFile,
+				FileName: a.Filename,
+				MIMEType: domain.MIMETypeFromName(a.Filename),
+				Size:     a.Size,
+				Token:    a.Payload.Token,
+				URL:      a.Payload.Url,
+			})
+		case *schemes.PhotoAttachment:
+			out = append(out, domain.Attachment{
+				Kind:     domain.AttachmentImage,
+				FileName: fmt.Sprintf("photo_%d.jpg", a.Payload.PhotoId),
+				MIMEType: "image/jpeg",
+				Token:    a.Payload.Token,
+				URL:      a.Payload.Url,
+			})
+		case *schemes.AudioAttachment:
+			out = append(out, domain.Attachment{
+				Kind:  domain.AttachmentAudio,
+				Token: a.Payload.Token,
+				URL:   a.Payload.Url,
+			})
+		case *schemes.VideoAttachment:
+			out = append(out, domain.Attachment{
+				Kind:  domain.AttachmentVideo,
+				Token: a.Payload.Token,
+				URL:   a.Payload.Url,
+			})
+		}
+	}
+	return out
+}
+
+func contactFromBody(body schemes.MessageBody) *domain.Contact {
+	for _, raw := range body.Attachments {
+		a, ok := raw.(*schemes.ContactAttachment)
+		if !ok {
+			continue
+		}
+		contact := &domain.Contact{}
+		if a.Payload.TamInfo != nil {
+			contact.UserID = a.Payload.TamInfo.UserId
+			contact.Name = a.Payload.TamInfo.Name
+		}
+		// The phone number is only present in the vCard.
+		for _, line := range strings.Split(a.Payload.VcfInfo, "\n") {
+			key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+			if !ok {
+				continue
+			}
+			key = strings.ToUpper(key)
+			switch {
+			case strings.HasPrefix(key, "TEL") && contact.Phone == "":
+				contact.Phone = value
+			case key == "FN" && contact.Name == "":
+				contact.Name = value
+			}
+		}
+		return contact
+	}
+	return nil
+}
+
+// answerCallback sends the handler's answer. MAX has no modal alerts, so
+// alerts are shown as notifications, and a callback must always be answered
+// with something, hence the checkmark when the handler had nothing to say.
+func (m *Messenger) answerCallback(ctx context.Context, callbackID string, answer domain.CallbackAnswer) {
 	if callbackID == "" {
 		return
 	}
+	text := answer.Text
+	if text == "" {
+		text = "✅"
+	}
 	_, err := m.api.Messages.AnswerOnCallback(ctx, callbackID, &schemes.CallbackAnswer{
-		Notification: "✅",
+		Notification: text,
 	})
 	if err != nil {
 		m.log.Warn().Err(err).Msg("failed to answer callback")
 	}
 }
 
-func (m *Messenger) Send(ctx context.Context, chatID, userID int64, msg domain.OutgoingMessage) error {
+func (m *Messenger) Send(ctx context.Context, chatID, userID int64, msg domain.OutgoingMessage) (string, error) {
 	builder := maxbot.NewMessage().SetText(msg.Text)
 	if chatID > 0 {
 		builder.SetChat(chatID)
@@ -103,25 +306,89 @@ func (m *Messenger) Send(ctx context.Context, chatID, userID int64, msg domain.O
 	// 	builder.SetUser(userID)
 	// }
 	if chatID == 0 && userID == 0 {
-		return fmt.Errorf("no chatID/userID provided for outgoing message")
+		return "", fmt.Errorf("no chatID/userID provided for outgoing message")
 	}
 	if msg.ParseMode != "" {
 		builder.SetFormat(msg.ParseMode)
 	}
-	// if msg.Reset {
-	// 	builder.SetReset(true)
-	// }
 	if kb := m.buildKeyboard(msg.Keyboard); kb != nil {
 		builder.AddKeyboard(kb)
 	}
-	_, err := m.api.Messages.Send(ctx, builder)
+	mid, err := m.api.Messages.Send(ctx, builder)
 	if err != nil && err.Error() != "" {
 		m.log.Error().Err(err).Msg("failed to send message")
-		return err
+		return "", classifyError(err)
+	}
+	return mid, nil
+}
+
+// Edit and Delete go through raw requests because the client library only
+// accepts numeric message IDs, while MAX identifies messages by mid strings.
+func (m *Messenger) Edit(ctx context.Context, chatID int64, messageID string, msg domain.OutgoingMessage) error {
+	if messageID == "" {
+		return fmt.Errorf("no messageID provided for edit")
+	}
+	body := editMessageBody{
+		Text:        msg.Text,
+		Format:      msg.ParseMode,
+		Attachments: []interface{}{},
+	}
+	if kb := m.buildKeyboard(msg.Keyboard); kb != nil {
+		body.Attachments = append(body.Attachments, schemes.NewInlineKeyboardAttachmentRequest(kb.Build()))
+	}
+	return m.modifyMessage(ctx, http.MethodPut, messageID, body)
+}
+
+// editMessageBody mirrors schemes.NewMessageBody but always sends the
+// attachment list: an empty one drops the keyboard, a missing one keeps it.
+type editMessageBody struct {
+	Text        string        `json:"text"`
+	Format      string        `json:"format,omitempty"`
+	Attachments []interface{} `json:"attachments"`
+}
+
+func (m *Messenger) Delete(ctx context.Context, chatID int64, messageID string) error {
+	if messageID == "" {
+		return fmt.Errorf("no messageID provided for delete")
+	}
+	return m.modifyMessage(ctx, http.MethodDelete, messageID, nil)
+}
+
+func (m *Messenger) modifyMessage(ctx context.Context, method, messageID string, payload any) error {
+	var result schemes.SimpleQueryResult
+	if err := m.rawRequest(ctx, method, "messages", url.Values{"message_id": {messageID}}, payload, &result); err != nil {
+		return classifyError(err)
+	}
+	if !result.Success {
+		return fmt.Errorf("max %s message %s: %s", strings.ToLower(method), messageID, result.Message)
 	}
 	return nil
 }
 
+// classifyError marks throttling and transient failures so the delivery
+// layer knows what to retry. MAX sends no retry-after hint.
+func classifyError(err error) error {
+	var apiErr *maxbot.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == http.StatusTooManyRequests:
+			return &domain.RateLimitError{Err: err}
+		case apiErr.Code >= http.StatusInternalServerError:
+			return fmt.Errorf("%w: %w", domain.ErrTemporary, err)
+		}
+		return err
+	}
+	var netErr *maxbot.NetworkError
+	var timeoutErr *maxbot.TimeoutError
+	if errors.As(err, &netErr) || errors.As(err, &timeoutErr) {
+		if domain.DialFailed(err) {
+			return fmt.Errorf("%w: %w: %w", domain.ErrTemporary, domain.ErrNotSent, err)
+		}
+		return fmt.Errorf("%w: %w", domain.ErrTemporary, err)
+	}
+	return err
+}
+
 func (m *Messenger) buildKeyboard(kb *domain.Keyboard) *maxbot.Keyboard {
 	if kb == nil || len(kb.Rows) == 0 {
 		return nil
@@ -134,6 +401,8 @@ func (m *Messenger) buildKeyboard(kb *domain.Keyboard) *maxbot.Keyboard {
 			switch btn.Kind {
 			case domain.ButtonKindLink:
 				r.AddLink(btn.Label, intent, btn.URL)
+			case domain.ButtonKindContact:
+				r.AddContact(btn.Label)
 			default:
 				payload := btn.Payload
 				if payload == "" {
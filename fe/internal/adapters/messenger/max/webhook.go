@@ -0,0 +1,135 @@
+package max
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/max-messenger/max-bot-api-client-go/schemes"
+)
+
+const webhookBuffer = 100
+
+var webhookUpdateTypes = []string{"message_created", "message_callback", "bot_started", "bot_added", "bot_removed"}
+
+// startWebhook registers the subscription and serves incoming updates. The
+// returned error channel yields once if the HTTP server stops unexpectedly.
+func (m *Messenger) startWebhook(ctx context.Context) (<-chan schemes.UpdateInterface, <-chan error, error) {
+	if m.cfg.WebhookURL == "" {
+		return nil, nil, errors.New("max webhook mode requires a webhook URL")
+	}
+	if m.cfg.WebhookSecret == "" {
+		return nil, nil, errors.New("max webhook mode requires a webhook secret")
+	}
+	if err := m.subscribe(ctx); err != nil {
+		return nil, nil, fmt.Errorf("subscribe max webhook: %w", err)
+	}
+
+	updates := make(chan schemes.UpdateInterface, webhookBuffer)
+	srv := &http.Server{
+		Addr:              m.cfg.WebhookListen,
+		Handler:           m.verifyWebhook(m.api.GetHandler(updates)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		m.log.Info().Str("addr", m.cfg.WebhookListen).Str("url", m.cfg.WebhookURL).Msg("serving max webhook")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			m.log.Warn().Err(err).Msg("max webhook shutdown")
+		}
+	}()
+	return updates, errCh, nil
+}
+
+func (m *Messenger) verifyWebhook(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got := r.Header.Get("X-Max-Bot-Api-Secret")
+		if m.cfg.WebhookSecret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(m.cfg.WebhookSecret)) != 1 {
+			m.log.Warn().Str("remote", r.RemoteAddr).Msg("rejected max webhook with bad secret")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// subscribe calls the subscriptions endpoint directly because the client
+// library does not pass the webhook secret.
+func (m *Messenger) subscribe(ctx context.Context) error {
+	body := schemes.SubscriptionRequestBody{
+		Url:         m.cfg.WebhookURL,
+		Secret:      m.cfg.WebhookSecret,
+		UpdateTypes: webhookUpdateTypes,
+		Version:     m.cfg.APIVersion,
+	}
+	var result schemes.SimpleQueryResult
+	if err := m.rawRequest(ctx, http.MethodPost, "subscriptions", nil, body, &result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return fmt.Errorf("subscription rejected: %s", result.Message)
+	}
+	return nil
+}
+
+func (m *Messenger) rawRequest(ctx context.Context, method, path string, query url.Values, payload, out any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("access_token", m.cfg.Token)
+	query.Set("v", m.cfg.APIVersion)
+
+	var body io.Reader
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("encode %s payload: %w", path, err)
+		}
+		body = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(m.cfg.APIURL, "/")+"/"+path+"?"+query.Encode(), body)
+	if err != nil {
+		return fmt.Errorf("create %s request: %w", path, err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return &maxbot.NetworkError{Op: method + " " + path, Err: err}
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read %s response: %w", path, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &maxbot.APIError{Code: resp.StatusCode, Message: string(raw)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return fmt.Errorf("decode %s response: %w", path, err)
+	}
+	return nil
+}
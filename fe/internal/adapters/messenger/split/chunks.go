@@ -0,0 +1,182 @@
+package split
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const (
+	fence = "```"
+	bold  = "**"
+)
+
+// chunks cuts text into parts of at most limit UTF-16 code units. Cuts go on
+// paragraph breaks, then line breaks, then spaces. With markdown set no cut
+// falls inside inline code or a link, and a code block or bold span left
+// open by a cut is closed at the end of the part and reopened in the next
+// one.
+func chunks(text string, limit int, markdown bool) []string {
+	rest := []rune(text)
+	if limit <= 0 || textLength(rest) <= limit {
+		return []string{text}
+	}
+	var (
+		parts   []string
+		inFence bool
+		inBold  bool
+	)
+	for len(rest) > 0 {
+		var prefix string
+		switch {
+		case inFence:
+			prefix = fence + "\n"
+		case inBold:
+			prefix = bold
+		}
+		budget := limit - len(prefix)
+		if textLength(rest) <= budget {
+			parts = append(parts, prefix+string(rest))
+			break
+		}
+		if markdown {
+			// Room to close a code block or, outside one, a bold span the
+			// cut may leave open.
+			budget -= len("\n" + fence)
+		}
+		cut, cutBold := cutPoint(rest, max(budget, 1), markdown, inBold)
+		part := strings.TrimRightFunc(string(rest[:cut]), unicode.IsSpace)
+		rest = trimLeadingNewlines(rest[cut:])
+		if markdown && strings.Count(part, fence)%2 == 1 {
+			inFence = !inFence
+		}
+		inBold = cutBold && !inFence
+		if inBold {
+			rest = []rune(strings.TrimLeftFunc(string(rest), unicode.IsSpace))
+			if hasPrefix(rest, bold) {
+				// The span ends right at the cut: move its closing
+				// marker into this part.
+				rest = []rune(strings.TrimLeftFunc(string(rest[len(bold):]), unicode.IsSpace))
+				part += bold
+				inBold = false
+			}
+		}
+		if part == "" {
+			continue
+		}
+		switch {
+		case inFence:
+			part += "\n" + fence
+		case inBold:
+			part += bold
+		}
+		parts = append(parts, prefix+part)
+	}
+	return parts
+}
+
+// cutPoint returns where to end a part of text that fits budget: the last
+// suitable break in the second half of the window, preferring one outside
+// bold text, else the last position outside any entity, else a hard cut.
+// strong says text continues a bold span reopened by chunks; inBold reports
+// that the cut splits a bold span.
+func cutPoint(text []rune, budget int, markdown, strong bool) (cut int, inBold bool) {
+	end, size := 0, 0
+	for end < len(text) {
+		n := utf16.RuneLen(text[end])
+		if size+n > budget {
+			break
+		}
+		size += n
+		end++
+	}
+	if end == 0 {
+		return 1, strong
+	}
+
+	var open, bolded []bool
+	if markdown {
+		open, bolded = openEntities(text, end, strong)
+	} else {
+		open, bolded = make([]bool, end+1), make([]bool, end+1)
+	}
+	last := func(from int, inBold bool, ok func(i int) bool) int {
+		for i := end; i > from; i-- {
+			if !open[i] && (inBold || !bolded[i]) && ok(i) {
+				return i
+			}
+		}
+		return 0
+	}
+	breaks := []func(i int) bool{
+		func(i int) bool { return i > 1 && text[i-1] == '\n' && text[i-2] == '\n' },
+		func(i int) bool { return text[i-1] == '\n' },
+		func(i int) bool { return unicode.IsSpace(text[i-1]) },
+	}
+	for _, inBold := range []bool{false, true} {
+		for _, ok := range breaks {
+			if cut := last(end/2, inBold, ok); cut > 0 {
+				return cut, bolded[cut]
+			}
+		}
+	}
+	for _, inBold := range []bool{false, true} {
+		if cut := last(0, inBold, func(int) bool { return true }); cut > 0 {
+			return cut, bolded[cut]
+		}
+	}
+	return end, bolded[end]
+}
+
+// openEntities reports for every position up to end whether cutting there
+// would split inline code, a link or a marker, and whether it falls inside
+// bold text, which chunks can close and reopen. Entities never span lines,
+// so unbalanced markers are forgiven at the next line break. Code fences are
+// balanced by chunks instead and count as plain text here.
+func openEntities(text []rune, end int, strong bool) (open, bolded []bool) {
+	open = make([]bool, end+1)
+	bolded = make([]bool, end+1)
+	bolded[0] = strong
+	var code, link bool
+	for i := 0; i < end; {
+		n := 1
+		switch {
+		case text[i] == '\n':
+			strong, code, link = false, false, false
+		case hasPrefix(text[i:], fence):
+			n = len(fence)
+		case text[i] == '`':
+			code = !code
+		case code:
+		case hasPrefix(text[i:], bold):
+			strong = !strong
+			n = len(bold)
+		case text[i] == '[':
+			link = true
+		case text[i] == ')':
+			link = false
+		}
+		for j := i + 1; j < i+n && j <= end; j++ {
+			open[j] = true
+		}
+		i += n
+		if i <= end {
+			// A cut right after an opening marker would leave an empty
+			// span behind.
+			open[i] = code || link || strong && n == len(bold) && !bolded[i-n]
+			bolded[i] = strong
+		}
+	}
+	return open, bolded
+}
+
+func hasPrefix(text []rune, prefix string) bool {
+	return strings.HasPrefix(string(text[:min(len(text), len(prefix))]), prefix)
+}
+
+func trimLeadingNewlines(text []rune) []rune {
+	for len(text) > 0 && (text[0] == '\n' || text[0] == '\r') {
+		text = text[1:]
+	}
+	return text
+}
@@ -0,0 +1,109 @@
+package split
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		limit    int
+		markdown bool
+		want     []string
+	}{
+		{
+			name:  "fits",
+			text:  "short",
+			limit: 10,
+			want:  []string{"short"},
+		},
+		{
+			name:  "paragraphs first",
+			text:  "first line\nsecond\n\nthird paragraph",
+			limit: 24,
+			want:  []string{"first line\nsecond", "third paragraph"},
+		},
+		{
+			name:     "code block is closed and reopened",
+			text:     "intro\n\n```\n" + strings.Repeat("line\n", 6) + "```\nafter",
+			limit:    20,
+			markdown: true,
+			want: []string{
+				"intro\n\n```\nline\n```",
+				"```\nline\nline\n```",
+				"```\nline\nline\n```",
+				"```\nline\n```\nafter",
+			},
+		},
+		{
+			name:     "bold is not cut when it fits",
+			text:     "some words **bold span** tail",
+			limit:    20,
+			markdown: true,
+			want:     []string{"some words", "**bold span** tail"},
+		},
+		{
+			name:     "long bold is closed and reopened",
+			text:     "**" + strings.Repeat("word ", 6) + "end** tail",
+			limit:    20,
+			markdown: true,
+			want:     []string{"**word word**", "**word word**", "**word word**", "**end** tail"},
+		},
+		{
+			name:     "bold without spaces is hard cut",
+			text:     "**" + strings.Repeat("x", 18) + "**",
+			limit:    12,
+			markdown: true,
+			want:     []string{"**xxxxxx**", "**xxxxxx**", "**xxxxxx**"},
+		},
+		{
+			name:     "bold ending at the cut",
+			text:     "aaaa **bb cc** dd",
+			limit:    8,
+			markdown: true,
+			want:     []string{"aaaa", "**bb**", "**cc**", "dd"},
+		},
+		{
+			name:     "link is kept whole",
+			text:     "read [the docs](https://x.io) now",
+			limit:    28,
+			markdown: true,
+			want:     []string{"read", "[the docs](https://x.io) now"},
+		},
+		{
+			name:  "markers are plain text without markdown",
+			text:  "**aaa bbb ccc**",
+			limit: 10,
+			want:  []string{"**aaa bbb", "ccc**"},
+		},
+		{
+			name:  "surrogate pairs stay whole",
+			text:  strings.Repeat("😀", 5),
+			limit: 5,
+			want:  []string{"😀😀", "😀😀", "😀"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunks(tt.text, tt.limit, tt.markdown)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("chunks = %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if n := textLength([]rune(part)); n > tt.limit {
+					t.Errorf("part %q is %d units long, limit %d", part, n, tt.limit)
+				}
+				if !utf8.ValidString(part) {
+					t.Errorf("part %q is not valid UTF-8", part)
+				}
+				if tt.markdown && (strings.Count(part, fence)%2 != 0 || strings.Count(strings.ReplaceAll(part, fence, ""), bold)%2 != 0) {
+					t.Errorf("part %q has unbalanced markers", part)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package split
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf16"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+	"github.com/escalopa/inno-vkode/internal/ports"
+)
+
+// Messenger sends text longer than the platform limit as several messages.
+// It sits above the delivery layer so every part is throttled and retried on
+// its own and a retry never repeats parts that already went out.
+type Messenger struct {
+	next  ports.Messenger
+	limit int
+}
+
+var _ ports.Messenger = (*Messenger)(nil)
+
+// New wraps next with a limit in UTF-16 code units, the unit platforms count
+// message length in. A non-positive limit disables splitting.
+func New(next ports.Messenger, limit int) *Messenger {
+	return &Messenger{next: next, limit: limit}
+}
+
+func (m *Messenger) Start(ctx context.Context, handler func(context.Context, domain.Update) (domain.CallbackAnswer, error)) error {
+	return m.next.Start(ctx, handler)
+}
+
+// Send returns the ID of the last part, which carries the keyboard, so menu
+// edits land on the message with the buttons.
+func (m *Messenger) Send(ctx context.Context, chatID, userID int64, msg domain.OutgoingMessage) (string, error) {
+	parts := chunks(msg.Text, m.limit, msg.ParseMode == domain.ParseModeMarkdown)
+	if len(parts) == 1 {
+		return m.next.Send(ctx, chatID, userID, msg)
+	}
+	var messageID string
+	for i, part := range parts {
+		chunk := domain.OutgoingMessage{Text: part, ParseMode: msg.ParseMode}
+		if i == 0 {
+			chunk.Reset = msg.Reset
+		}
+		if i == len(parts)-1 {
+			chunk.Keyboard = msg.Keyboard
+		}
+		var err error
+		if messageID, err = m.next.Send(ctx, chatID, userID, chunk); err != nil {
+			return "", fmt.Errorf("send part %d of %d: %w", i+1, len(parts), err)
+		}
+	}
+	return messageID, nil
+}
+
+// Edit cannot turn one message into several, so it fails for long text and
+// the service falls back to sending a fresh message.
+func (m *Messenger) Edit(ctx context.Context, chatID int64, messageID string, msg domain.OutgoingMessage) error {
+	if m.limit > 0 && textLength([]rune(msg.Text)) > m.limit {
+		return fmt.Errorf("message %s: text exceeds %d characters, cannot edit in place", messageID, m.limit)
+	}
+	return m.next.Edit(ctx, chatID, messageID, msg)
+}
+
+func (m *Messenger) Delete(ctx context.Context, chatID int64, messageID string) error {
+	return m.next.Delete(ctx, chatID, messageID)
+}
+
+func textLength(text []rune) int {
+	n := 0
+	for _, r := range text {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
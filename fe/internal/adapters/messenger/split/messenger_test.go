@@ -0,0 +1,77 @@
+package split
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// recorder keeps every message sent through it.
+type recorder struct {
+	sent []domain.OutgoingMessage
+}
+
+func (r *recorder) Start(context.Context, func(context.Context, domain.Update) (domain.CallbackAnswer, error)) error {
+	return nil
+}
+
+func (r *recorder) Send(_ context.Context, _, _ int64, msg domain.OutgoingMessage) (string, error) {
+	r.sent = append(r.sent, msg)
+	return fmt.Sprintf("msg-%d", len(r.sent)), nil
+}
+
+func (r *recorder) Edit(context.Context, int64, string, domain.OutgoingMessage) error {
+	return nil
+}
+
+func (r *recorder) Delete(context.Context, int64, string) error {
+	return nil
+}
+
+func TestSendPutsKeyboardOnLastPart(t *testing.T) {
+	next := &recorder{}
+	m := New(next, 20)
+	keyboard := &domain.Keyboard{Rows: [][]domain.KeyboardButton{{{Label: "Menu", Payload: "menu"}}}}
+	msg := domain.OutgoingMessage{
+		Text:      strings.Repeat("line of text\n", 5),
+		ParseMode: domain.ParseModeMarkdown,
+		Keyboard:  keyboard,
+		Reset:     true,
+	}
+
+	id, err := m.Send(context.Background(), 1, 1, msg)
+	if err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if len(next.sent) < 2 {
+		t.Fatalf("sent %d messages, want the text split", len(next.sent))
+	}
+	if want := fmt.Sprintf("msg-%d", len(next.sent)); id != want {
+		t.Fatalf("id = %q, want the last part %q", id, want)
+	}
+	for i, part := range next.sent {
+		last := i == len(next.sent)-1
+		if (part.Keyboard != nil) != last {
+			t.Errorf("part %d has keyboard %v, want it only on the last part", i, part.Keyboard != nil)
+		}
+		if part.Reset != (i == 0) {
+			t.Errorf("part %d reset = %v, want it only on the first part", i, part.Reset)
+		}
+		if part.ParseMode != msg.ParseMode {
+			t.Errorf("part %d parse mode = %q, want %q", i, part.ParseMode, msg.ParseMode)
+		}
+	}
+}
+
+func TestEditRefusesLongText(t *testing.T) {
+	m := New(&recorder{}, 10)
+	if err := m.Edit(context.Background(), 1, "msg-1", domain.OutgoingMessage{Text: "short"}); err != nil {
+		t.Fatalf("edit short text: %v", err)
+	}
+	if err := m.Edit(context.Background(), 1, "msg-1", domain.OutgoingMessage{Text: strings.Repeat("😀", 6)}); err == nil {
+		t.Fatal("edit of text over the limit succeeded")
+	}
+}
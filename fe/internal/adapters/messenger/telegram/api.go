@@ -0,0 +1,226 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+const DefaultAPIURL = "https://api.telegram.org"
+
+// APIError is a non-ok response from the Bot API.
+type APIError struct {
+	Method      string
+	Code        int
+	Description string
+	RetryAfter  time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("telegram %s failed with %d: %s", e.Method, e.Code, e.Description)
+}
+
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Parameters  *struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+type tgUpdate struct {
+	UpdateID      int64            `json:"update_id"`
+	Message       *tgMessage       `json:"message"`
+	CallbackQuery *tgCallbackQuery `json:"callback_query"`
+	MyChatMember  *tgMemberUpdate  `json:"my_chat_member"`
+}
+
+type tgMessage struct {
+	MessageID int64         `json:"message_id"`
+	From      *tgUser       `json:"from"`
+	Chat      tgChat        `json:"chat"`
+	Text      string        `json:"text"`
+	Caption   string        `json:"caption"`
+	Document  *tgFile       `json:"document"`
+	Photo     []tgPhotoSize `json:"photo"`
+	Audio     *tgFile       `json:"audio"`
+	Voice     *tgFile       `json:"voice"`
+	Video     *tgFile       `json:"video"`
+	Contact   *tgContact    `json:"contact"`
+}
+
+type tgContact struct {
+	PhoneNumber string `json:"phone_number"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	UserID      int64  `json:"user_id"`
+}
+
+type tgFile struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MIMEType string `json:"mime_type"`
+	FileSize int64  `json:"file_size"`
+}
+
+type tgPhotoSize struct {
+	FileID   string `json:"file_id"`
+	FileSize int64  `json:"file_size"`
+}
+
+type tgUser struct {
+	ID           int64  `json:"id"`
+	LanguageCode string `json:"language_code"`
+}
+
+type tgChat struct {
+	ID int64 `json:"id"`
+}
+
+// tgMemberUpdate reports a change of the bot's own membership; in private
+// chats "kicked" means the user blocked the bot.
+type tgMemberUpdate struct {
+	Chat          tgChat   `json:"chat"`
+	From          tgUser   `json:"from"`
+	NewChatMember tgMember `json:"new_chat_member"`
+}
+
+type tgMember struct {
+	Status string `json:"status"`
+}
+
+type tgCallbackQuery struct {
+	ID      string     `json:"id"`
+	From    tgUser     `json:"from"`
+	Message *tgMessage `json:"message"`
+	Data    string     `json:"data"`
+}
+
+type inlineKeyboardMarkup struct {
+	InlineKeyboard [][]inlineKeyboardButton `json:"inline_keyboard"`
+}
+
+type inlineKeyboardButton struct {
+	Text         string `json:"text"`
+	CallbackData string `json:"callback_data,omitempty"`
+	URL          string `json:"url,omitempty"`
+}
+
+type replyKeyboardMarkup struct {
+	Keyboard        [][]keyboardButton `json:"keyboard"`
+	ResizeKeyboard  bool               `json:"resize_keyboard"`
+	OneTimeKeyboard bool               `json:"one_time_keyboard"`
+}
+
+type replyKeyboardRemove struct {
+	RemoveKeyboard bool `json:"remove_keyboard"`
+}
+
+type keyboardButton struct {
+	Text           string `json:"text"`
+	RequestContact bool   `json:"request_contact,omitempty"`
+}
+
+type sendMessageRequest struct {
+	ChatID      int64  `json:"chat_id"`
+	Text        string `json:"text"`
+	ParseMode   string `json:"parse_mode,omitempty"`
+	ReplyMarkup any    `json:"reply_markup,omitempty"`
+}
+
+type editMessageTextRequest struct {
+	ChatID      int64                 `json:"chat_id"`
+	MessageID   int64                 `json:"message_id"`
+	Text        string                `json:"text"`
+	ParseMode   string                `json:"parse_mode,omitempty"`
+	ReplyMarkup *inlineKeyboardMarkup `json:"reply_markup,omitempty"`
+}
+
+type deleteMessageRequest struct {
+	ChatID    int64 `json:"chat_id"`
+	MessageID int64 `json:"message_id"`
+}
+
+type getUpdatesRequest struct {
+	Offset         int64    `json:"offset,omitempty"`
+	Timeout        int      `json:"timeout"`
+	AllowedUpdates []string `json:"allowed_updates"`
+}
+
+type setWebhookRequest struct {
+	URL            string   `json:"url"`
+	SecretToken    string   `json:"secret_token,omitempty"`
+	AllowedUpdates []string `json:"allowed_updates"`
+}
+
+type answerCallbackRequest struct {
+	CallbackQueryID string `json:"callback_query_id"`
+	Text            string `json:"text,omitempty"`
+	ShowAlert       bool   `json:"show_alert,omitempty"`
+}
+
+var allowedUpdates = []string{"message", "callback_query", "my_chat_member"}
+
+func (m *Messenger) call(ctx context.Context, method string, payload, out any) error {
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(payload); err != nil {
+		return fmt.Errorf("encode %s payload: %w", method, err)
+	}
+	endpoint := fmt.Sprintf("%s/bot%s/%s", strings.TrimRight(m.cfg.APIURL, "/"), m.cfg.Token, method)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, buf)
+	if err != nil {
+		return fmt.Errorf("create %s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		if domain.DialFailed(err) {
+			return fmt.Errorf("%w: %w: do %s request: %w", domain.ErrTemporary, domain.ErrNotSent, method, err)
+		}
+		return fmt.Errorf("%w: do %s request: %w", domain.ErrTemporary, method, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read %s response: %w", method, err)
+	}
+	var envelope apiResponse
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		err = fmt.Errorf("decode %s response (status %d): %w", method, resp.StatusCode, err)
+		if resp.StatusCode >= http.StatusInternalServerError {
+			err = fmt.Errorf("%w: %w", domain.ErrTemporary, err)
+		}
+		return err
+	}
+	if !envelope.OK {
+		apiErr := &APIError{Method: method, Code: envelope.ErrorCode, Description: envelope.Description}
+		if envelope.Parameters != nil {
+			apiErr.RetryAfter = time.Duration(envelope.Parameters.RetryAfter) * time.Second
+		}
+		switch {
+		case apiErr.Code == http.StatusTooManyRequests:
+			return &domain.RateLimitError{RetryAfter: apiErr.RetryAfter, Err: apiErr}
+		case apiErr.Code >= http.StatusInternalServerError:
+			return fmt.Errorf("%w: %w", domain.ErrTemporary, apiErr)
+		}
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Result, out); err != nil {
+		return fmt.Errorf("decode %s result: %w", method, err)
+	}
+	return nil
+}
@@ -0,0 +1,509 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/adapters/messenger/dispatch"
+	"github.com/escalopa/inno-vkode/internal/domain"
+	"github.com/escalopa/inno-vkode/internal/ports"
+)
+
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+type Config struct {
+	Token         string
+	APIURL        string
+	Mode          string
+	PollTimeout   time.Duration
+	WebhookURL    string
+	WebhookListen string
+	WebhookSecret string
+}
+
+type Messenger struct {
+	cfg      Config
+	client   *http.Client
+	log      zerolog.Logger
+	dispatch dispatch.Config
+
+	// replyKeyboards holds the chats showing a contact reply keyboard. It
+	// stays on screen until a message removes it explicitly.
+	mu             sync.Mutex
+	replyKeyboards map[int64]bool
+}
+
+var _ ports.Messenger = (*Messenger)(nil)
+
+func New(cfg Config, log zerolog.Logger, dispatchCfg dispatch.Config) *Messenger {
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultAPIURL
+	}
+	if cfg.PollTimeout <= 0 {
+		cfg.PollTimeout = 30 * time.Second
+	}
+	return &Messenger{
+		cfg: cfg,
+		// Long polling holds the request open for PollTimeout, leave room on top.
+		client:         &http.Client{Timeout: cfg.PollTimeout + 10*time.Second},
+		log:            log,
+		dispatch:       dispatchCfg,
+		replyKeyboards: make(map[int64]bool),
+	}
+}
+
+func (m *Messenger) Start(ctx context.Context, handler func(context.Context, domain.Update) (domain.CallbackAnswer, error)) error {
+	pool := dispatch.New("telegram", m.dispatch, m.log)
+	pool.Start(ctx)
+	defer pool.Wait()
+
+	submit := func(upd tgUpdate) error {
+		dUpdate, ok := m.normalizeUpdate(upd)
+		if !ok {
+			return nil
+		}
+		return pool.Submit(ctx, dUpdate.ChatID, func(ctx context.Context) {
+			handle := func(ctx context.Context) domain.CallbackAnswer {
+				answer, err := handler(ctx, dUpdate)
+				if err != nil {
+					m.log.Error().Err(err).Msg("bot handler error")
+				}
+				return answer
+			}
+			if upd.CallbackQuery == nil {
+				handle(ctx)
+				return
+			}
+			pool.AnswerCallback(ctx, handle, func(ctx context.Context, answer domain.CallbackAnswer) {
+				m.answerCallback(ctx, upd.CallbackQuery.ID, answer)
+			})
+		})
+	}
+
+	switch m.cfg.Mode {
+	case "", ModePolling:
+		return m.poll(ctx, submit)
+	case ModeWebhook:
+		return m.serveWebhook(ctx, submit)
+	default:
+		return fmt.Errorf("unknown telegram mode %q", m.cfg.Mode)
+	}
+}
+
+func (m *Messenger) poll(ctx context.Context, submit func(tgUpdate) error) error {
+	// A webhook left over from an earlier deployment makes getUpdates fail.
+	if err := m.call(ctx, "deleteWebhook", struct{}{}, nil); err != nil {
+		m.log.Warn().Err(err).Msg("failed to delete telegram webhook")
+	}
+	m.log.Info().Msg("polling telegram updates")
+
+	var offset int64
+	backoff := time.Second
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var updates []tgUpdate
+		err := m.call(ctx, "getUpdates", getUpdatesRequest{
+			Offset:         offset,
+			Timeout:        int(m.cfg.PollTimeout / time.Second),
+			AllowedUpdates: allowedUpdates,
+		}, &updates)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			m.log.Warn().Err(err).Dur("retry_in", backoff).Msg("failed to get telegram updates")
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		backoff = time.Second
+		for _, upd := range updates {
+			offset = upd.UpdateID + 1
+			if err := submit(upd); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (m *Messenger) serveWebhook(ctx context.Context, submit func(tgUpdate) error) error {
+	if m.cfg.WebhookURL == "" {
+		return errors.New("telegram webhook mode requires a webhook URL")
+	}
+	if m.cfg.WebhookSecret == "" {
+		return errors.New("telegram webhook mode requires a webhook secret")
+	}
+	err := m.call(ctx, "setWebhook", setWebhookRequest{
+		URL:            m.cfg.WebhookURL,
+		SecretToken:    m.cfg.WebhookSecret,
+		AllowedUpdates: allowedUpdates,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("set telegram webhook: %w", err)
+	}
+
+	srv := &http.Server{
+		Addr:              m.cfg.WebhookListen,
+		Handler:           m.webhookHandler(submit),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		m.log.Info().Str("addr", m.cfg.WebhookListen).Msg("serving telegram webhook")
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			m.log.Warn().Err(err).Msg("telegram webhook shutdown")
+		}
+		return ctx.Err()
+	case err := <-errCh:
+		return fmt.Errorf("telegram webhook server: %w", err)
+	}
+}
+
+func (m *Messenger) webhookHandler(submit func(tgUpdate) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		got := r.Header.Get("X-Telegram-Bot-Api-Secret-Token")
+		if m.cfg.WebhookSecret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(m.cfg.WebhookSecret)) != 1 {
+			m.log.Warn().Str("remote", r.RemoteAddr).Msg("rejected telegram webhook with bad secret")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var upd tgUpdate
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&upd); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if err := submit(upd); err != nil {
+			// Telegram redelivers on non-2xx, which is what we want when the queue is shutting down.
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func (m *Messenger) normalizeUpdate(upd tgUpdate) (domain.Update, bool) {
+	switch {
+	case upd.Message != nil:
+		msg := upd.Message
+		text := msg.Text
+		if text == "" {
+			text = msg.Caption
+		}
+		out := domain.Update{
+			Type:        domain.UpdateTypeMessage,
+			ChatID:      msg.Chat.ID,
+			Text:        strings.TrimSpace(text),
+			MessageID:   strconv.FormatInt(msg.MessageID, 10),
+			Attachments: messageAttachments(msg),
+			Raw:         upd,
+		}
+		if msg.From != nil {
+			out.UserID = msg.From.ID
+			out.Language = languageFromCode(msg.From.LanguageCode)
+		}
+		if c := msg.Contact; c != nil {
+			out.Type = domain.UpdateTypeContact
+			out.Contact = &domain.Contact{
+				Phone:  c.PhoneNumber,
+				Name:   strings.TrimSpace(c.FirstName + " " + c.LastName),
+				UserID: c.UserID,
+			}
+		}
+		// Deep links arrive as "/start <payload>"; a bare /start is the
+		// user's own command and stays a message.
+		if command, payload, _ := strings.Cut(out.Text, " "); command == "/start" && payload != "" {
+			out.Type = domain.UpdateTypeStarted
+			out.Payload = strings.TrimSpace(payload)
+		}
+		return out, true
+	case upd.CallbackQuery != nil:
+		cb := upd.CallbackQuery
+		out := domain.Update{
+			Type:     domain.UpdateTypeCallback,
+			UserID:   cb.From.ID,
+			Payload:  cb.Data,
+			Language: languageFromCode(cb.From.LanguageCode),
+			Raw:      upd,
+		}
+		if cb.Message != nil {
+			out.ChatID = cb.Message.Chat.ID
+			out.MessageID = strconv.FormatInt(cb.Message.MessageID, 10)
+		}
+		return out, true
+	case upd.MyChatMember != nil:
+		member := upd.MyChatMember
+		switch member.NewChatMember.Status {
+		case "kicked", "left":
+			return domain.Update{
+				Type:   domain.UpdateTypeStopped,
+				ChatID: member.Chat.ID,
+				UserID: member.From.ID,
+				Raw:    upd,
+			}, true
+		}
+		return domain.Update{}, false
+	default:
+		return domain.Update{}, false
+	}
+}
+
+// messageAttachments keeps file IDs only: download URLs embed the bot token
+// and must not leave the process.
+func messageAttachments(msg *tgMessage) []domain.Attachment {
+	var out []domain.Attachment
+	file := func(kind domain.AttachmentKind, f *tgFile) {
+		if f == nil {
+			return
+		}
+		mimeType := f.MIMEType
+		if mimeType == "" {
+			mimeType = domain.MIMETypeFromName(f.FileName)
+		}
+		out = append(out, domain.Attachment{
+			Kind:     kind,
+			FileName: f.FileName,
+			MIMEType: mimeType,
+			Size:     f.FileSize,
+			Token:    f.FileID,
+		})
+	}
+	file(domain.AttachmentFile, msg.Document)
+	file(domain.AttachmentAudio, msg.Audio)
+	file(domain.AttachmentAudio, msg.Voice)
+	file(domain.AttachmentVideo, msg.Video)
+	if n := len(msg.Photo); n > 0 {
+		// Sizes come smallest first; the last one is the original.
+		photo := msg.Photo[n-1]
+		out = append(out, domain.Attachment{
+			Kind:     domain.AttachmentImage,
+			FileName: "photo_" + strconv.FormatInt(msg.MessageID, 10) + ".jpg",
+			MIMEType: "image/jpeg",
+			Size:     photo.FileSize,
+			Token:    photo.FileID,
+		})
+	}
+	return out
+}
+
+func languageFromCode(code string) domain.Language {
+	switch {
+	case code == "":
+		return ""
+	case strings.HasPrefix(code, "en"):
+		return domain.LanguageEN
+	default:
+		return domain.LanguageRU
+	}
+}
+
+func (m *Messenger) answerCallback(ctx context.Context, callbackID string, answer domain.CallbackAnswer) {
+	if callbackID == "" {
+		return
+	}
+	err := m.call(ctx, "answerCallbackQuery", answerCallbackRequest{
+		CallbackQueryID: callbackID,
+		Text:            answer.Text,
+		ShowAlert:       answer.Alert,
+	}, nil)
+	if err != nil {
+		m.log.Warn().Err(err).Msg("failed to answer callback")
+	}
+}
+
+func (m *Messenger) Send(ctx context.Context, chatID, userID int64, msg domain.OutgoingMessage) (string, error) {
+	if chatID == 0 {
+		// Private chats share the user's ID.
+		chatID = userID
+	}
+	if chatID == 0 {
+		return "", fmt.Errorf("no chatID/userID provided for outgoing message")
+	}
+	req := sendMessageRequest{
+		ChatID:      chatID,
+		ReplyMarkup: buildReplyMarkup(msg.Keyboard),
+	}
+	req.Text, req.ParseMode = formatText(msg)
+	_, contactKeyboard := req.ReplyMarkup.(replyKeyboardMarkup)
+	if !contactKeyboard && m.replyKeyboardShown(chatID) {
+		if req.ReplyMarkup == nil {
+			req.ReplyMarkup = replyKeyboardRemove{RemoveKeyboard: true}
+		} else {
+			m.removeReplyKeyboard(ctx, chatID)
+		}
+	}
+	var sent tgMessage
+	if err := m.call(ctx, "sendMessage", req, &sent); err != nil {
+		m.log.Error().Err(err).Msg("failed to send message")
+		return "", err
+	}
+	if _, remove := req.ReplyMarkup.(replyKeyboardRemove); contactKeyboard || remove {
+		m.setReplyKeyboard(chatID, contactKeyboard)
+	}
+	return strconv.FormatInt(sent.MessageID, 10), nil
+}
+
+func (m *Messenger) replyKeyboardShown(chatID int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.replyKeyboards[chatID]
+}
+
+func (m *Messenger) setReplyKeyboard(chatID int64, shown bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if shown {
+		m.replyKeyboards[chatID] = true
+	} else {
+		delete(m.replyKeyboards, chatID)
+	}
+}
+
+// removeReplyKeyboard clears the reply keyboard before a message with inline
+// buttons, which cannot carry the removal itself: a placeholder message
+// removes it and is deleted right away, the removal stays in effect.
+func (m *Messenger) removeReplyKeyboard(ctx context.Context, chatID int64) {
+	var sent tgMessage
+	err := m.call(ctx, "sendMessage", sendMessageRequest{
+		ChatID:      chatID,
+		Text:        "⌨️",
+		ReplyMarkup: replyKeyboardRemove{RemoveKeyboard: true},
+	}, &sent)
+	if err != nil {
+		m.log.Warn().Err(err).Int64("chat_id", chatID).Msg("failed to remove reply keyboard")
+		return
+	}
+	m.setReplyKeyboard(chatID, false)
+	if err := m.call(ctx, "deleteMessage", deleteMessageRequest{ChatID: chatID, MessageID: sent.MessageID}, nil); err != nil {
+		m.log.Debug().Err(err).Int64("chat_id", chatID).Msg("failed to delete keyboard removal message")
+	}
+}
+
+func (m *Messenger) Edit(ctx context.Context, chatID int64, messageID string, msg domain.OutgoingMessage) error {
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid telegram message id %q: %w", messageID, err)
+	}
+	req := editMessageTextRequest{
+		ChatID:      chatID,
+		MessageID:   id,
+		ReplyMarkup: buildKeyboard(msg.Keyboard),
+	}
+	req.Text, req.ParseMode = formatText(msg)
+	err = m.call(ctx, "editMessageText", req, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.Description, "message is not modified") {
+		// Tapping the button of the menu that is already shown.
+		return nil
+	}
+	return err
+}
+
+func (m *Messenger) Delete(ctx context.Context, chatID int64, messageID string) error {
+	id, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid telegram message id %q: %w", messageID, err)
+	}
+	return m.call(ctx, "deleteMessage", deleteMessageRequest{ChatID: chatID, MessageID: id}, nil)
+}
+
+func formatText(msg domain.OutgoingMessage) (text, parseMode string) {
+	if msg.ParseMode == domain.ParseModeMarkdown {
+		return markdownToHTML(msg.Text), "HTML"
+	}
+	return msg.Text, ""
+}
+
+// buildReplyMarkup returns the markup for sendMessage. Telegram only offers
+// contact sharing on reply keyboards, which cannot be combined with inline
+// buttons, so a keyboard with a contact button becomes a reply keyboard of its
+// contact buttons alone.
+func buildReplyMarkup(kb *domain.Keyboard) any {
+	if kb == nil || len(kb.Rows) == 0 {
+		return nil
+	}
+	var contactRows [][]keyboardButton
+	for _, row := range kb.Rows {
+		for _, btn := range row {
+			if btn.Kind == domain.ButtonKindContact {
+				contactRows = append(contactRows, []keyboardButton{{Text: btn.Label, RequestContact: true}})
+			}
+		}
+	}
+	if len(contactRows) > 0 {
+		return replyKeyboardMarkup{Keyboard: contactRows, ResizeKeyboard: true, OneTimeKeyboard: true}
+	}
+	return buildKeyboard(kb)
+}
+
+func buildKeyboard(kb *domain.Keyboard) *inlineKeyboardMarkup {
+	if kb == nil || len(kb.Rows) == 0 {
+		return nil
+	}
+	markup := &inlineKeyboardMarkup{}
+	for _, row := range kb.Rows {
+		var buttons []inlineKeyboardButton
+		for _, btn := range row {
+			switch btn.Kind {
+			case domain.ButtonKindLink:
+				buttons = append(buttons, inlineKeyboardButton{Text: btn.Label, URL: btn.URL})
+			default:
+				payload := btn.Payload
+				if payload == "" {
+					payload = btn.Label
+				}
+				buttons = append(buttons, inlineKeyboardButton{Text: btn.Label, CallbackData: payload})
+			}
+		}
+		markup.InlineKeyboard = append(markup.InlineKeyboard, buttons)
+	}
+	return markup
+}
+
+var (
+	mdBold = regexp.MustCompile(`\*\*(.+?)\*\*`)
+	mdCode = regexp.MustCompile("`([^`]+)`")
+	mdLink = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s]+)\)`)
+)
+
+// markdownToHTML converts the small Markdown subset used in bot texts into
+// Telegram HTML, which unlike Telegram Markdown does not choke on stray
+// underscores in emails and URLs.
+func markdownToHTML(text string) string {
+	out := html.EscapeString(text)
+	out = mdBold.ReplaceAllString(out, "<b>$1</b>")
+	out = mdCode.ReplaceAllString(out, "<code>$1</code>")
+	out = mdLink.ReplaceAllString(out, `<a href="$2">$1</a>`)
+	return out
+}
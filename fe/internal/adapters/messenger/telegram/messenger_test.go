@@ -0,0 +1,421 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/adapters/messenger/dispatch"
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+const testToken = "123:abc"
+
+type apiCall struct {
+	Method string
+	Body   map[string]any
+}
+
+// fakeAPI is an in-process Bot API. Handlers are looked up by method name;
+// methods without one succeed with an empty result.
+type fakeAPI struct {
+	t        *testing.T
+	srv      *httptest.Server
+	mu       sync.Mutex
+	calls    []apiCall
+	handlers map[string]func(body map[string]any) (status int, response string)
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	t.Helper()
+	api := &fakeAPI{t: t, handlers: map[string]func(map[string]any) (int, string){}}
+	api.srv = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.srv.Close)
+	return api
+}
+
+func (a *fakeAPI) serve(w http.ResponseWriter, r *http.Request) {
+	prefix := "/bot" + testToken + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		a.t.Errorf("request to %s does not carry the bot token", r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	method := strings.TrimPrefix(r.URL.Path, prefix)
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		a.t.Errorf("%s: decode body: %v", method, err)
+	}
+	a.mu.Lock()
+	a.calls = append(a.calls, apiCall{Method: method, Body: body})
+	handler := a.handlers[method]
+	a.mu.Unlock()
+
+	status, response := http.StatusOK, `{"ok":true,"result":true}`
+	if handler != nil {
+		status, response = handler(body)
+	}
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(response))
+}
+
+func (a *fakeAPI) handle(method string, fn func(body map[string]any) (int, string)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers[method] = fn
+}
+
+func (a *fakeAPI) callsTo(method string) []apiCall {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var out []apiCall
+	for _, c := range a.calls {
+		if c.Method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (a *fakeAPI) messenger(cfg Config) *Messenger {
+	cfg.Token = testToken
+	cfg.APIURL = a.srv.URL
+	if cfg.PollTimeout == 0 {
+		cfg.PollTimeout = time.Second
+	}
+	return New(cfg, zerolog.Nop(), dispatch.Config{Workers: 2, QueueSize: 8, HandlerTimeout: 5 * time.Second})
+}
+
+func ok(result string) (int, string) {
+	return http.StatusOK, `{"ok":true,"result":` + result + `}`
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPollingDeliversUpdatesAndAnswersCallbacks(t *testing.T) {
+	api := newFakeAPI(t)
+	var polls int
+	api.handle("getUpdates", func(body map[string]any) (int, string) {
+		polls++
+		if polls == 1 {
+			return ok(`[
+				{"update_id": 10, "message": {"message_id": 1, "from": {"id": 7, "language_code": "en"}, "chat": {"id": 7}, "text": " hello "}},
+				{"update_id": 11, "callback_query": {"id": "cb-1", "from": {"id": 7}, "message": {"message_id": 2, "chat": {"id": 7}}, "data": "nav:root"}},
+				{"update_id": 12, "message": {"message_id": 3, "from": {"id": 7}, "chat": {"id": 7}, "text": "/start promo"}},
+				{"update_id": 13, "message": {"message_id": 4, "from": {"id": 7}, "chat": {"id": 7}, "text": "/start"}},
+				{"update_id": 14, "my_chat_member": {"chat": {"id": 7}, "from": {"id": 7}, "new_chat_member": {"status": "kicked"}}}
+			]`)
+		}
+		time.Sleep(20 * time.Millisecond)
+		return ok(`[]`)
+	})
+
+	var (
+		mu      sync.Mutex
+		updates []domain.Update
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- api.messenger(Config{Mode: ModePolling}).Start(ctx, func(_ context.Context, upd domain.Update) (domain.CallbackAnswer, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			updates = append(updates, upd)
+			return domain.CallbackAnswer{Text: "done", Alert: true}, nil
+		})
+	}()
+
+	waitFor(t, "callback answer", func() bool { return len(api.callsTo("answerCallbackQuery")) == 1 })
+	waitFor(t, "second poll", func() bool { return len(api.callsTo("getUpdates")) >= 2 })
+	waitFor(t, "all updates", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(updates) == 5
+	})
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Start returned %v", err)
+	}
+
+	if len(api.callsTo("deleteWebhook")) != 1 {
+		t.Errorf("polling did not delete a stale webhook first")
+	}
+	if offset := api.callsTo("getUpdates")[1].Body["offset"]; offset != float64(15) {
+		t.Errorf("second poll offset = %v, want 15", offset)
+	}
+	answer := api.callsTo("answerCallbackQuery")[0].Body
+	if answer["callback_query_id"] != "cb-1" || answer["text"] != "done" || answer["show_alert"] != true {
+		t.Errorf("answerCallbackQuery body = %v", answer)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(updates) != 5 {
+		t.Fatalf("handler got %d updates, want 5: %+v", len(updates), updates)
+	}
+	want := []struct {
+		typ     domain.UpdateType
+		text    string
+		payload string
+	}{
+		{domain.UpdateTypeMessage, "hello", ""},
+		{domain.UpdateTypeCallback, "", "nav:root"},
+		{domain.UpdateTypeStarted, "/start promo", "promo"},
+		{domain.UpdateTypeMessage, "/start", ""},
+		{domain.UpdateTypeStopped, "", ""},
+	}
+	for i, w := range want {
+		got := updates[i]
+		if got.Type != w.typ || got.Text != w.text || got.Payload != w.payload || got.ChatID != 7 {
+			t.Errorf("update %d = %+v, want type %s text %q payload %q", i, got, w.typ, w.text, w.payload)
+		}
+	}
+	if updates[0].Language != domain.LanguageEN {
+		t.Errorf("language = %q, want en", updates[0].Language)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	api := newFakeAPI(t)
+	m := api.messenger(Config{Mode: ModeWebhook, WebhookURL: "https://bot.example/hook", WebhookSecret: "s3cret", WebhookListen: "127.0.0.1:0"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- m.Start(ctx, func(context.Context, domain.Update) (domain.CallbackAnswer, error) {
+			return domain.CallbackAnswer{}, nil
+		})
+	}()
+	waitFor(t, "setWebhook", func() bool { return len(api.callsTo("setWebhook")) == 1 })
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Start returned %v", err)
+	}
+	body := api.callsTo("setWebhook")[0].Body
+	if body["url"] != "https://bot.example/hook" || body["secret_token"] != "s3cret" {
+		t.Errorf("setWebhook body = %v", body)
+	}
+
+	var got []tgUpdate
+	var submitErr error
+	handler := m.webhookHandler(func(upd tgUpdate) error {
+		got = append(got, upd)
+		return submitErr
+	})
+	post := func(secret, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if secret != "" {
+			req.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	update := `{"update_id": 1, "message": {"message_id": 1, "chat": {"id": 5}, "text": "hi"}}`
+
+	if code := post("", update); code != http.StatusUnauthorized {
+		t.Errorf("missing secret: status %d, want 401", code)
+	}
+	if code := post("wrong", update); code != http.StatusUnauthorized {
+		t.Errorf("wrong secret: status %d, want 401", code)
+	}
+	if code := post("s3cret", "{not json"); code != http.StatusBadRequest {
+		t.Errorf("bad body: status %d, want 400", code)
+	}
+	if code := post("s3cret", update); code != http.StatusOK {
+		t.Errorf("valid update: status %d, want 200", code)
+	}
+	submitErr = errors.New("queue closed")
+	if code := post("s3cret", update); code != http.StatusServiceUnavailable {
+		t.Errorf("rejected update: status %d, want 503 so Telegram redelivers", code)
+	}
+	if len(got) != 2 || got[0].Message == nil || got[0].Message.Text != "hi" {
+		t.Errorf("submitted updates = %+v", got)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", rec.Code)
+	}
+}
+
+func TestSendMessage(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("sendMessage", func(map[string]any) (int, string) { return ok(`{"message_id": 42, "chat": {"id": 5}}`) })
+	m := api.messenger(Config{})
+
+	id, err := m.Send(context.Background(), 5, 0, domain.OutgoingMessage{
+		Text:      "**Hi** <you> `code`",
+		ParseMode: domain.ParseModeMarkdown,
+		Keyboard: &domain.Keyboard{Rows: [][]domain.KeyboardButton{{
+			{Label: "Open", Kind: domain.ButtonKindCallback, Payload: "nav:x"},
+			{Label: "Site", Kind: domain.ButtonKindLink, URL: "https://univ.ru"},
+		}}},
+	})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if id != "42" {
+		t.Errorf("message id = %q, want 42", id)
+	}
+	body := api.callsTo("sendMessage")[0].Body
+	if body["chat_id"] != float64(5) || body["parse_mode"] != "HTML" || body["text"] != "<b>Hi</b> &lt;you&gt; <code>code</code>" {
+		t.Errorf("sendMessage body = %v", body)
+	}
+	buttons := body["reply_markup"].(map[string]any)["inline_keyboard"].([]any)[0].([]any)
+	if buttons[0].(map[string]any)["callback_data"] != "nav:x" || buttons[1].(map[string]any)["url"] != "https://univ.ru" {
+		t.Errorf("inline keyboard = %v", buttons)
+	}
+
+	if _, err := m.Send(context.Background(), 0, 0, domain.OutgoingMessage{Text: "x"}); err == nil {
+		t.Errorf("Send without chat and user succeeded")
+	}
+}
+
+func TestContactKeyboardIsRemoved(t *testing.T) {
+	api := newFakeAPI(t)
+	api.handle("sendMessage", func(map[string]any) (int, string) { return ok(`{"message_id": 9, "chat": {"id": 5}}`) })
+	m := api.messenger(Config{})
+	ctx := context.Background()
+	contact := domain.OutgoingMessage{Text: "Phone?", Keyboard: &domain.Keyboard{Rows: [][]domain.KeyboardButton{{
+		{Label: "Share", Kind: domain.ButtonKindContact},
+	}}}}
+	inline := domain.OutgoingMessage{Text: "Menu", Keyboard: &domain.Keyboard{Rows: [][]domain.KeyboardButton{{
+		{Label: "Open", Kind: domain.ButtonKindCallback, Payload: "nav:x"},
+	}}}}
+
+	if _, err := m.Send(ctx, 5, 0, contact); err != nil {
+		t.Fatal(err)
+	}
+	markup := api.callsTo("sendMessage")[0].Body["reply_markup"].(map[string]any)
+	if markup["keyboard"] == nil || markup["one_time_keyboard"] != true {
+		t.Fatalf("contact keyboard markup = %v", markup)
+	}
+
+	// A plain reply carries the removal itself.
+	if _, err := m.Send(ctx, 5, 0, domain.OutgoingMessage{Text: "Thanks"}); err != nil {
+		t.Fatal(err)
+	}
+	markup = api.callsTo("sendMessage")[1].Body["reply_markup"].(map[string]any)
+	if markup["remove_keyboard"] != true {
+		t.Fatalf("reply after contact step = %v, want remove_keyboard", markup)
+	}
+	if _, err := m.Send(ctx, 5, 0, domain.OutgoingMessage{Text: "Again"}); err != nil {
+		t.Fatal(err)
+	}
+	if markup := api.callsTo("sendMessage")[2].Body["reply_markup"]; markup != nil {
+		t.Fatalf("keyboard removed twice: %v", markup)
+	}
+
+	// An inline keyboard cannot carry the removal: a placeholder does and is
+	// deleted.
+	if _, err := m.Send(ctx, 5, 0, contact); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Send(ctx, 5, 0, inline); err != nil {
+		t.Fatal(err)
+	}
+	sends := api.callsTo("sendMessage")
+	placeholder, menu := sends[4].Body, sends[5].Body
+	if placeholder["reply_markup"].(map[string]any)["remove_keyboard"] != true {
+		t.Fatalf("placeholder markup = %v", placeholder["reply_markup"])
+	}
+	if menu["text"] != "Menu" || menu["reply_markup"].(map[string]any)["inline_keyboard"] == nil {
+		t.Fatalf("menu after placeholder = %v", menu)
+	}
+	deletes := api.callsTo("deleteMessage")
+	if len(deletes) != 1 || deletes[0].Body["message_id"] != float64(9) {
+		t.Fatalf("placeholder not deleted: %v", deletes)
+	}
+}
+
+func TestEditMessageText(t *testing.T) {
+	api := newFakeAPI(t)
+	m := api.messenger(Config{})
+	ctx := context.Background()
+	msg := domain.OutgoingMessage{Text: "Menu", Keyboard: &domain.Keyboard{Rows: [][]domain.KeyboardButton{{
+		{Label: "Back", Kind: domain.ButtonKindCallback, Payload: "nav:root"},
+	}}}}
+
+	if err := m.Edit(ctx, 5, "17", msg); err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	body := api.callsTo("editMessageText")[0].Body
+	if body["chat_id"] != float64(5) || body["message_id"] != float64(17) || body["text"] != "Menu" || body["reply_markup"] == nil {
+		t.Errorf("editMessageText body = %v", body)
+	}
+
+	api.handle("editMessageText", func(map[string]any) (int, string) {
+		return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: message is not modified"}`
+	})
+	if err := m.Edit(ctx, 5, "17", msg); err != nil {
+		t.Errorf("unchanged edit returned %v", err)
+	}
+
+	api.handle("editMessageText", func(map[string]any) (int, string) {
+		return http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: message to edit not found"}`
+	})
+	var apiErr *APIError
+	if err := m.Edit(ctx, 5, "17", msg); !errors.As(err, &apiErr) || apiErr.Code != 400 {
+		t.Errorf("missing message: got %v, want APIError 400", err)
+	}
+	if err := m.Edit(ctx, 5, "not-a-number", msg); err == nil {
+		t.Errorf("Edit with a bad message id succeeded")
+	}
+}
+
+func TestAPIErrorsAreClassified(t *testing.T) {
+	api := newFakeAPI(t)
+	m := api.messenger(Config{})
+	ctx := context.Background()
+	msg := domain.OutgoingMessage{Text: "x"}
+
+	api.handle("sendMessage", func(map[string]any) (int, string) {
+		return http.StatusTooManyRequests, `{"ok":false,"error_code":429,"description":"Too Many Requests","parameters":{"retry_after":3}}`
+	})
+	var rateErr *domain.RateLimitError
+	if _, err := m.Send(ctx, 5, 0, msg); !errors.As(err, &rateErr) || rateErr.RetryAfter != 3*time.Second {
+		t.Errorf("429: got %v, want RateLimitError retrying after 3s", err)
+	}
+
+	api.handle("sendMessage", func(map[string]any) (int, string) {
+		return http.StatusBadGateway, `{"ok":false,"error_code":502,"description":"Bad Gateway"}`
+	})
+	if _, err := m.Send(ctx, 5, 0, msg); !errors.Is(err, domain.ErrTemporary) || errors.Is(err, domain.ErrNotSent) {
+		t.Errorf("502: got %v, want ErrTemporary without ErrNotSent", err)
+	}
+
+	api.handle("sendMessage", func(map[string]any) (int, string) {
+		return http.StatusForbidden, `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`
+	})
+	if _, err := m.Send(ctx, 5, 0, msg); err == nil || errors.Is(err, domain.ErrTemporary) {
+		t.Errorf("403: got %v, want a permanent error", err)
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	down := New(Config{Token: testToken, APIURL: closed.URL}, zerolog.Nop(), dispatch.Config{})
+	if _, err := down.Send(ctx, 5, 0, msg); !errors.Is(err, domain.ErrNotSent) {
+		t.Errorf("connection refused: got %v, want ErrNotSent", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/rs/zerolog"
 
+	"github.com/escalopa/inno-vkode/internal/domain"
 	"github.com/escalopa/inno-vkode/internal/ports"
 )
 
@@ -16,10 +17,11 @@ func NewLogSender(log zerolog.Logger) *LogSender {
 	return &LogSender{log: log}
 }
 
-func (s *LogSender) SendOTP(ctx context.Context, email, code string) error {
+func (s *LogSender) SendOTP(ctx context.Context, email, code string, lang domain.Language) error {
 	s.log.Info().
 		Str("email", email).
 		Str("code", code).
+		Str("lang", string(lang)).
 		Msg("OTP dispatched")
 	return nil
 }
@@ -0,0 +1,286 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+	"github.com/escalopa/inno-vkode/internal/ports"
+)
+
+//go:embed templates/*
+var templates embed.FS
+
+type SMTPConfig struct {
+	Host         string
+	Port         int
+	Username     string
+	Password     string
+	From         string
+	StartTLS     bool
+	Timeout      time.Duration
+	SendTimeout  time.Duration
+	MaxRetries   int
+	RetryBackoff time.Duration
+	CodeTTL      time.Duration
+}
+
+type SMTPSender struct {
+	cfg  SMTPConfig
+	log  zerolog.Logger
+	html *htmltemplate.Template
+	text *texttemplate.Template
+	// tlsConfig overrides the STARTTLS client config; nil verifies Host
+	// against the system roots.
+	tlsConfig *tls.Config
+}
+
+var _ ports.EmailSender = (*SMTPSender)(nil)
+
+var otpSubjects = map[domain.Language]string{
+	domain.LanguageRU: "Код подтверждения для входа",
+	domain.LanguageEN: "Your login verification code",
+}
+
+func NewSMTPSender(cfg SMTPConfig, log zerolog.Logger) (*SMTPSender, error) {
+	if cfg.Host == "" || cfg.From == "" {
+		return nil, errors.New("smtp host and from address are required")
+	}
+	html, err := htmltemplate.ParseFS(templates, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("parse html templates: %w", err)
+	}
+	text, err := texttemplate.ParseFS(templates, "templates/*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("parse text templates: %w", err)
+	}
+	return &SMTPSender{
+		cfg:  cfg,
+		log:  log,
+		html: html,
+		text: text,
+	}, nil
+}
+
+// SendOTP runs inside the update handler, so all attempts together are
+// bounded by SendTimeout and by ctx: a retry that could not start before
+// the deadline is not waited for.
+func (s *SMTPSender) SendOTP(ctx context.Context, email, code string, lang domain.Language) error {
+	msg, err := s.renderOTP(email, code, lang.Normalize())
+	if err != nil {
+		return err
+	}
+	if s.cfg.SendTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.SendTimeout)
+		defer cancel()
+	}
+
+	backoff := s.cfg.RetryBackoff
+	var lastErr error
+	for attempt := 0; attempt <= s.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+				break
+			}
+			s.log.Warn().Err(lastErr).Int("attempt", attempt).Str("email", email).Msg("retrying otp email")
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("send otp email: %w", errors.Join(ctx.Err(), lastErr))
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		lastErr = s.deliver(ctx, email, msg)
+		if lastErr == nil {
+			s.log.Info().Str("email", email).Msg("OTP dispatched")
+			return nil
+		}
+		if isPermanent(lastErr) {
+			break
+		}
+	}
+	return fmt.Errorf("send otp email: %w", lastErr)
+}
+
+func (s *SMTPSender) renderOTP(to, code string, lang domain.Language) ([]byte, error) {
+	data := struct {
+		Code             string
+		ExpiresInMinutes int
+	}{
+		Code:             code,
+		ExpiresInMinutes: int(s.cfg.CodeTTL.Minutes()),
+	}
+	var htmlBody, textBody bytes.Buffer
+	if err := s.html.ExecuteTemplate(&htmlBody, "otp_"+string(lang)+".html", data); err != nil {
+		return nil, fmt.Errorf("render html template: %w", err)
+	}
+	if err := s.text.ExecuteTemplate(&textBody, "otp_"+string(lang)+".txt", data); err != nil {
+		return nil, fmt.Errorf("render text template: %w", err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{"text/plain; charset=UTF-8", textBody.Bytes()},
+		{"text/html; charset=UTF-8", htmlBody.Bytes()},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write(part.content); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	headers := [][2]string{
+		{"From", s.cfg.From},
+		{"To", to},
+		{"Subject", mime.QEncoding.Encode("UTF-8", otpSubjects[lang])},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", s.messageID()},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(&msg, "%s: %s\r\n", h[0], h[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func (s *SMTPSender) messageID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	domainPart := s.cfg.Host
+	if at := strings.LastIndex(s.cfg.From, "@"); at >= 0 {
+		domainPart = strings.Trim(s.cfg.From[at+1:], "> ")
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domainPart + ">"
+}
+
+func (s *SMTPSender) deliver(ctx context.Context, to string, msg []byte) error {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	dialer := &net.Dialer{Timeout: s.cfg.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("dial smtp: %w", err)
+	}
+	deadline, hasDeadline := ctx.Deadline()
+	if s.cfg.Timeout > 0 && (!hasDeadline || time.Until(deadline) > s.cfg.Timeout) {
+		deadline, hasDeadline = time.Now().Add(s.cfg.Timeout), true
+	}
+	if hasDeadline {
+		_ = conn.SetDeadline(deadline)
+	}
+	// net/smtp does not take a context; unblock it on cancellation.
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("smtp handshake: %w", err)
+	}
+	defer client.Close()
+
+	if s.cfg.StartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return permanentError{errors.New("smtp server does not support STARTTLS")}
+		}
+		tlsConfig := s.tlsConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: s.cfg.Host}
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("smtp auth: %w", err)
+		}
+	}
+	if err := client.Mail(envelopeAddress(s.cfg.From)); err != nil {
+		return fmt.Errorf("smtp mail from: %w", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return fmt.Errorf("smtp rcpt to: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("smtp write body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp finish body: %w", err)
+	}
+	return client.Quit()
+}
+
+func envelopeAddress(from string) string {
+	if start := strings.LastIndex(from, "<"); start >= 0 {
+		if end := strings.LastIndex(from, ">"); end > start {
+			return from[start+1 : end]
+		}
+	}
+	return from
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// isPermanent reports whether retrying cannot help: 5xx SMTP replies (bad
+// recipient, auth rejected) and configuration problems.
+func isPermanent(err error) bool {
+	var pe permanentError
+	if errors.As(err, &pe) {
+		return true
+	}
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return tpErr.Code >= 500
+	}
+	return false
+}
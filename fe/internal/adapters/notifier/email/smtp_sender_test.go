@@ -0,0 +1,416 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// fakeSMTP is a minimal in-process SMTP server with STARTTLS and AUTH PLAIN.
+// reply, if set, may override the reply to a command on a given connection
+// (counted from 1); an empty string keeps the default. A server without
+// greeting accepts connections and never answers.
+type fakeSMTP struct {
+	t   *testing.T
+	ln  net.Listener
+	tls *tls.Config
+
+	mu       sync.Mutex
+	reply    func(conn int, command string) string
+	greeting bool
+	conns    int
+	messages []string
+	auth     []string
+	tlsUsed  []bool
+}
+
+func newFakeSMTP(t *testing.T) (*fakeSMTP, *x509.CertPool) {
+	t.Helper()
+	cert, pool := selfSignedCert(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &fakeSMTP{
+		t:        t,
+		ln:       ln,
+		tls:      &tls.Config{Certificates: []tls.Certificate{cert}},
+		greeting: true,
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	go srv.serve()
+	return srv, pool
+}
+
+func (f *fakeSMTP) port() int { return f.ln.Addr().(*net.TCPAddr).Port }
+
+func (f *fakeSMTP) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns++
+		n := f.conns
+		f.mu.Unlock()
+		go f.session(n, conn)
+	}
+}
+
+func (f *fakeSMTP) configure(greeting bool, reply func(conn int, command string) string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.greeting, f.reply = greeting, reply
+}
+
+func (f *fakeSMTP) session(n int, conn net.Conn) {
+	defer conn.Close()
+	f.mu.Lock()
+	greeting, reply := f.greeting, f.reply
+	f.mu.Unlock()
+	if !greeting {
+		_, _ = io.Copy(io.Discard, conn)
+		return
+	}
+	r, w := bufio.NewReader(conn), conn
+	secure := false
+	send := func(line string) { _, _ = io.WriteString(w, line+"\r\n") }
+	send("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		if reply != nil {
+			if override := reply(n, verb); override != "" {
+				send(override)
+				continue
+			}
+		}
+		switch verb {
+		case "EHLO", "HELO":
+			if !secure {
+				send("250-fake")
+				send("250-STARTTLS")
+			} else {
+				send("250-fake")
+			}
+			send("250 AUTH PLAIN")
+		case "STARTTLS":
+			send("220 go ahead")
+			tlsConn := tls.Server(conn, f.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			r, w, secure = bufio.NewReader(tlsConn), tlsConn, true
+		case "AUTH":
+			f.mu.Lock()
+			f.auth = append(f.auth, line)
+			f.mu.Unlock()
+			send("235 ok")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			send("250 ok")
+		case "DATA":
+			send("354 go ahead")
+			var body strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				body.WriteString(strings.TrimPrefix(l, "."))
+			}
+			f.mu.Lock()
+			f.messages = append(f.messages, body.String())
+			f.tlsUsed = append(f.tlsUsed, secure)
+			f.mu.Unlock()
+			send("250 queued")
+		case "QUIT":
+			send("221 bye")
+			return
+		default:
+			send("502 unknown command")
+		}
+	}
+}
+
+func (f *fakeSMTP) connections() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.conns
+}
+
+func (f *fakeSMTP) delivered() (messages []string, overTLS []bool, auth []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.messages, f.tlsUsed, f.auth
+}
+
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool
+}
+
+func newTestSender(t *testing.T, srv *fakeSMTP, pool *x509.CertPool, cfg SMTPConfig) *SMTPSender {
+	t.Helper()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = srv.port()
+	if cfg.From == "" {
+		cfg.From = "Inno-VKode <noreply@univ.ru>"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.CodeTTL == 0 {
+		cfg.CodeTTL = 5 * time.Minute
+	}
+	sender, err := NewSMTPSender(cfg, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.tlsConfig = &tls.Config{ServerName: "127.0.0.1", RootCAs: pool}
+	return sender
+}
+
+func TestSMTPSenderSendsMultipartOverStartTLS(t *testing.T) {
+	srv, pool := newFakeSMTP(t)
+	sender := newTestSender(t, srv, pool, SMTPConfig{StartTLS: true, Username: "bot", Password: "pw"})
+
+	if err := sender.SendOTP(context.Background(), "user@univ.ru", "123456", domain.LanguageRU); err != nil {
+		t.Fatalf("SendOTP: %v", err)
+	}
+	messages, overTLS, auth := srv.delivered()
+	if len(messages) != 1 || !overTLS[0] {
+		t.Fatalf("got %d messages (tls %v), want one sent after STARTTLS", len(messages), overTLS)
+	}
+	wantAuth := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00bot\x00pw"))
+	if len(auth) != 1 || auth[0] != wantAuth {
+		t.Errorf("auth = %v, want %q", auth, wantAuth)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(messages[0]))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != otpSubjects[domain.LanguageRU] {
+		t.Errorf("subject = %q (%v), want %q", subject, err, otpSubjects[domain.LanguageRU])
+	}
+	if msg.Header.Get("To") != "user@univ.ru" || !strings.HasSuffix(msg.Header.Get("Message-ID"), "@univ.ru>") {
+		t.Errorf("headers = %v", msg.Header)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("content type = %q (%v)", mediaType, err)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := mr.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("next part: %v", err)
+		}
+		if cte := part.Header.Get("Content-Transfer-Encoding"); cte != "quoted-printable" {
+			t.Errorf("part encoding = %q, want quoted-printable", cte)
+		}
+		raw, _ := io.ReadAll(part)
+		for _, line := range strings.Split(string(raw), "\r\n") {
+			if len(line) > 76 {
+				t.Errorf("encoded line longer than 76 characters: %q", line)
+			}
+		}
+		decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(string(raw))))
+		if err != nil {
+			t.Fatalf("decode part: %v", err)
+		}
+		if !strings.Contains(string(decoded), "123456") || !strings.Contains(string(decoded), "5 мин") {
+			t.Errorf("%s part lacks the code or expiry: %q", part.Header.Get("Content-Type"), decoded)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+	if strings.Join(types, ",") != "text/plain; charset=UTF-8,text/html; charset=UTF-8" {
+		t.Errorf("parts = %v, want plain then html", types)
+	}
+}
+
+func TestSMTPSenderRequiresStartTLS(t *testing.T) {
+	srv, pool := newFakeSMTP(t)
+	srv.configure(true, func(_ int, verb string) string {
+		if verb == "EHLO" {
+			return "250 fake"
+		}
+		return ""
+	})
+	sender := newTestSender(t, srv, pool, SMTPConfig{StartTLS: true, MaxRetries: 3, RetryBackoff: time.Millisecond})
+
+	err := sender.SendOTP(context.Background(), "user@univ.ru", "123456", domain.LanguageEN)
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("got %v, want a STARTTLS error", err)
+	}
+	if n := srv.connections(); n != 1 {
+		t.Errorf("permanent error retried: %d connections", n)
+	}
+}
+
+func TestSMTPSenderRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		reply     func(conn int, verb string) string
+		wantErr   bool
+		wantConns int
+	}{
+		{
+			name: "temporary failures then success",
+			reply: func(conn int, verb string) string {
+				if conn <= 2 && verb == "MAIL" {
+					return "421 try again later"
+				}
+				return ""
+			},
+			wantConns: 3,
+		},
+		{
+			name: "gives up after max retries",
+			reply: func(_ int, verb string) string {
+				if verb == "RCPT" {
+					return "451 mailbox busy"
+				}
+				return ""
+			},
+			wantErr:   true,
+			wantConns: 4,
+		},
+		{
+			name: "permanent rejection is not retried",
+			reply: func(_ int, verb string) string {
+				if verb == "RCPT" {
+					return "550 no such user"
+				}
+				return ""
+			},
+			wantErr:   true,
+			wantConns: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, pool := newFakeSMTP(t)
+			srv.configure(true, tt.reply)
+			sender := newTestSender(t, srv, pool, SMTPConfig{MaxRetries: 3, RetryBackoff: time.Millisecond})
+
+			err := sender.SendOTP(context.Background(), "user@univ.ru", "123456", domain.LanguageEN)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n := srv.connections(); n != tt.wantConns {
+				t.Errorf("connections = %d, want %d", n, tt.wantConns)
+			}
+			if messages, _, _ := srv.delivered(); !tt.wantErr && len(messages) != 1 {
+				t.Errorf("delivered %d messages, want 1", len(messages))
+			}
+		})
+	}
+}
+
+func TestSMTPSenderStaysWithinSendTimeout(t *testing.T) {
+	srv, pool := newFakeSMTP(t)
+	srv.configure(false, nil)
+	sender := newTestSender(t, srv, pool, SMTPConfig{
+		Timeout:      10 * time.Second,
+		SendTimeout:  300 * time.Millisecond,
+		MaxRetries:   3,
+		RetryBackoff: time.Second,
+	})
+
+	start := time.Now()
+	err := sender.SendOTP(context.Background(), "user@univ.ru", "123456", domain.LanguageEN)
+	if err == nil {
+		t.Fatal("SendOTP to a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("SendOTP took %s, want it bounded by the 300ms send timeout", elapsed)
+	}
+	if n := srv.connections(); n != 1 {
+		t.Errorf("retried with no time left: %d connections", n)
+	}
+
+	// The caller's deadline bounds the send the same way.
+	sender.cfg.SendTimeout = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := sender.SendOTP(ctx, "user@univ.ru", "123456", domain.LanguageEN); err == nil {
+		t.Fatal("SendOTP to a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("SendOTP took %s past the caller's deadline", elapsed)
+	}
+}
+
+func TestEnvelopeAddress(t *testing.T) {
+	for in, want := range map[string]string{
+		"noreply@univ.ru":              "noreply@univ.ru",
+		"Inno-VKode <noreply@univ.ru>": "noreply@univ.ru",
+		`"Bot <x>" <noreply@univ.ru>`:  "noreply@univ.ru",
+		"broken <noreply@univ.ru":      "broken <noreply@univ.ru",
+	} {
+		if got := envelopeAddress(in); got != want {
+			t.Errorf("envelopeAddress(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
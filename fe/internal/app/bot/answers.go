@@ -0,0 +1,43 @@
+package bot
+
+import (
+	"context"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+type callbackAnswerKey struct{}
+
+// withCallbackAnswer attaches an answer slot to the context of a callback
+// update; handlers fill it and handleUpdate hands it to the adapter.
+func withCallbackAnswer(ctx context.Context) (context.Context, *domain.CallbackAnswer) {
+	answer := &domain.CallbackAnswer{}
+	return context.WithValue(ctx, callbackAnswerKey{}, answer), answer
+}
+
+func setCallbackAnswer(ctx context.Context, text string, alert bool) bool {
+	answer, ok := ctx.Value(callbackAnswerKey{}).(*domain.CallbackAnswer)
+	if !ok {
+		return false
+	}
+	answer.Text = text
+	answer.Alert = alert
+	return true
+}
+
+// notice shows text as a toast when the update is a button tap and as a chat
+// message otherwise. Use it for short outcomes that need no record in chat.
+func (s *Service) notice(ctx context.Context, sess *domain.Session, text string) error {
+	if setCallbackAnswer(ctx, text, false) {
+		return nil
+	}
+	return s.reply(ctx, sess, text)
+}
+
+// alert is notice for outcomes the user must acknowledge.
+func (s *Service) alert(ctx context.Context, sess *domain.Session, text string) error {
+	if setCallbackAnswer(ctx, text, true) {
+		return nil
+	}
+	return s.reply(ctx, sess, text)
+}
@@ -0,0 +1,216 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// roleGuest stands for a chat that is not signed in. Guests get the applicant
+// menu, but the policy tells them apart from signed-in users acting as
+// applicants; see policyRole.
+const roleGuest domain.Role = "guest"
+
+var (
+	allRoles = []domain.Role{domain.RoleApplicant, domain.RoleStudent, domain.RoleEmployee, domain.RoleLeadership}
+	// everyone adds guests to the signed-in roles.
+	everyone       = append([]domain.Role{roleGuest}, allRoles...)
+	applicantRoles = []domain.Role{roleGuest, domain.RoleApplicant}
+	// memberRoles may run account actions: any signed-in role, including
+	// applicant so users acting as applicants can switch back or sign out.
+	memberRoles  = allRoles
+	studentRoles = []domain.Role{domain.RoleStudent}
+	staffRoles   = []domain.Role{domain.RoleEmployee}
+	campusRoles  = []domain.Role{domain.RoleStudent, domain.RoleEmployee}
+	leaderRoles  = []domain.Role{domain.RoleLeadership}
+	// broadcastRoles may open the broadcast flow; employees also need to be
+	// listed in BROADCAST_ADMINS, see canBroadcast.
+	broadcastRoles = []domain.Role{domain.RoleEmployee, domain.RoleLeadership}
+)
+
+// actionPolicy lists the roles allowed to run each action. Actions missing
+// from the policy are denied for everyone.
+var actionPolicy = map[domain.ActionID][]domain.Role{
+	domain.ActionSwitchLanguage:      everyone,
+	domain.ActionSwitchRole:          memberRoles,
+	domain.ActionSecurityOverview:    memberRoles,
+	domain.ActionSignOutOthers:       memberRoles,
+	domain.ActionLogout:              memberRoles,
+	domain.ActionViewProfile:         memberRoles,
+	domain.ActionToggleNotifications: memberRoles,
+	domain.ActionContactSupport:      memberRoles,
+	domain.ActionReportIssue:         memberRoles,
+	domain.ActionFAQ:                 campusRoles,
+
+	domain.ActionViewAdmissionsPrograms: applicantRoles,
+	domain.ActionBookOpenDay:            applicantRoles,
+	domain.ActionBookCampusTour:         applicantRoles,
+	domain.ActionBookAdmissionEvent:     applicantRoles,
+	domain.ActionAdmissionsContact:      applicantRoles,
+	domain.ActionAdmissionDocuments:     applicantRoles,
+	domain.ActionAdmissionAppointment:   applicantRoles,
+
+	domain.ActionViewSchedule:         studentRoles,
+	domain.ActionViewExams:            studentRoles,
+	domain.ActionViewGrades:           studentRoles,
+	domain.ActionViewDeadlines:        studentRoles,
+	domain.ActionTeacherFeedback:      studentRoles,
+	domain.ActionElectiveRegistration: studentRoles,
+	domain.ActionCareerConsultation:   studentRoles,
+	domain.ActionBrowseJobs:           studentRoles,
+	domain.ActionApplyJob:             studentRoles,
+	domain.ActionMyApplications:       studentRoles,
+	domain.ActionDeanCertificates:     studentRoles,
+	domain.ActionDeanTuition:          studentRoles,
+	domain.ActionDeanCompensation:     studentRoles,
+	domain.ActionDeanAppointment:      studentRoles,
+	domain.ActionDeanApplications:     studentRoles,
+	domain.ActionDormPayment:          studentRoles,
+	domain.ActionDormServices:         studentRoles,
+	domain.ActionDormGuestPass:        studentRoles,
+	domain.ActionDormMaintenance:      studentRoles,
+
+	domain.ActionEventsCalendar: campusRoles,
+	domain.ActionEventsRegister: memberRoles,
+	domain.ActionEventsMine:     campusRoles,
+
+	domain.ActionVisaStatus:          campusRoles,
+	domain.ActionVisaMakeApplication: campusRoles,
+
+	domain.ActionBusinessTripsList:   staffRoles,
+	domain.ActionBusinessTripRequest: staffRoles,
+	domain.ActionVacationsList:       staffRoles,
+	domain.ActionVacationRequest:     staffRoles,
+	domain.ActionCertificatesList:    staffRoles,
+	domain.ActionCertificateRequest:  staffRoles,
+	domain.ActionOfficeGuestPass:     staffRoles,
+	domain.ActionHRAppointment:       staffRoles,
+
+	domain.ActionLeadershipNews:   leaderRoles,
+	domain.ActionLeadershipAlerts: leaderRoles,
+	domain.ActionLeadershipEvents: leaderRoles,
+	domain.ActionAIQuery:          leaderRoles,
+	domain.ActionAISummary:        leaderRoles,
+	domain.ActionAITranscription:  leaderRoles,
+	domain.ActionBroadcast:        broadcastRoles,
+}
+
+// callbackPolicy covers the data-bearing callbacks produced by handlers.
+// nav:, act: and lang: are open to every role and checked further on dispatch.
+var callbackPolicy = []struct {
+	prefix string
+	roles  []domain.Role
+}{
+	{payloadNavPrefix, everyone},
+	{payloadActionPref, everyone},
+	{payloadLangPref, everyone},
+	{payloadRolePref, memberRoles},
+	{"event_select:", memberRoles},
+	{"event_mode:", memberRoles},
+	{"cancel_event:", memberRoles},
+	{"schedule:", studentRoles},
+	{"visa_app:", campusRoles},
+	{"visa_withdraw:", campusRoles},
+	{"visa_docs:", campusRoles},
+	{"visa_type:", campusRoles},
+	{payloadBroadcastPref, broadcastRoles},
+}
+
+func roleAllowed(roles []domain.Role, role domain.Role) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// policyRole is the role the policy is checked against: roleGuest for a
+// chat that is not signed in, whatever its session role says.
+func policyRole(sess *domain.Session) domain.Role {
+	if sess.Profile == nil {
+		return roleGuest
+	}
+	return sess.Role
+}
+
+func (s *Service) authorizeAction(sess *domain.Session, action domain.ActionID) bool {
+	if roleAllowed(actionPolicy[action], policyRole(sess)) && (action != domain.ActionBroadcast || s.canBroadcast(sess)) {
+		return true
+	}
+	s.logDenied(sess, "action", string(action))
+	return false
+}
+
+func (s *Service) authorizeNode(sess *domain.Session, node *MenuNode) bool {
+	if owner, ok := s.menus.Owner(node.ID); ok && owner == sess.Role {
+		return true
+	}
+	s.logDenied(sess, "menu", node.ID)
+	return false
+}
+
+func (s *Service) authorizeCallback(sess *domain.Session, payload string) bool {
+	for _, rule := range callbackPolicy {
+		if strings.HasPrefix(payload, rule.prefix) {
+			if roleAllowed(rule.roles, policyRole(sess)) {
+				return true
+			}
+			break
+		}
+	}
+	s.logDenied(sess, "callback", payload)
+	return false
+}
+
+func (s *Service) logDenied(sess *domain.Session, kind, target string) {
+	s.log.Warn().
+		Int64("chat_id", sess.ChatID).
+		Int64("user_id", sess.UserID).
+		Str("role", string(policyRole(sess))).
+		Str("kind", kind).
+		Str("target", target).
+		Msg("authorization denied")
+}
+
+// validateMenuPolicy checks that every action reachable from a role's menu is
+// permitted for that role, and every action guests see in the applicant menu
+// is permitted for guests, so the menus never offer a button the guard
+// rejects.
+func validateMenuPolicy(reg *MenuRegistry) error {
+	var problems []string
+	for id, node := range reg.nodes {
+		owner, ok := reg.Owner(id)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("node %s has no owning role", id))
+			continue
+		}
+		if node.Action != "" && !roleAllowed(actionPolicy[node.Action], owner) {
+			problems = append(problems, fmt.Sprintf("node %s: action %s not allowed for role %s", id, node.Action, owner))
+		}
+		if node.Action != "" && owner == domain.RoleApplicant && !accountActions[node.Action] && !roleAllowed(actionPolicy[node.Action], roleGuest) {
+			problems = append(problems, fmt.Sprintf("node %s: action %s not allowed for guests", id, node.Action))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("menu authorization policy mismatch:\n%s", strings.Join(problems, "\n"))
+}
+
+func (s *Service) replyForbidden(ctx context.Context, sess *domain.Session) error {
+	return s.notice(ctx, sess, s.t(sess.Language, "🚫 Этот раздел недоступен для вашей роли.", "🚫 This section is not available for your role."))
+}
+
+func actorFor(sess *domain.Session) domain.Actor {
+	actor := domain.Actor{ChatID: sess.ChatID, Role: sess.Role}
+	if sess.Profile != nil {
+		actor.UserID = sess.Profile.ID
+		actor.Email = sess.Profile.Email
+	}
+	return actor
+}
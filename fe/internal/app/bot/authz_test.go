@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/escalopa/inno-vkode/internal/config"
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// handlerPrefixes lists the callback prefixes each action's handler puts on
+// its buttons.
+var handlerPrefixes = map[domain.ActionID][]string{
+	domain.ActionViewSchedule:        {"schedule:"},
+	domain.ActionEventsRegister:      {"event_select:", "event_mode:"},
+	domain.ActionEventsMine:          {"cancel_event:"},
+	domain.ActionVisaStatus:          {"visa_app:", "visa_withdraw:", "visa_docs:"},
+	domain.ActionVisaMakeApplication: {"visa_type:"},
+	domain.ActionSwitchRole:          {payloadRolePref},
+	domain.ActionBroadcast:           {payloadBroadcastPref},
+	domain.ActionSwitchLanguage:      {payloadLangPref},
+}
+
+func TestMenuRegistryMatchesPolicy(t *testing.T) {
+	if err := validateMenuPolicy(buildMenuRegistry()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMenuButtonsAreAuthorized renders every menu of every role for a user
+// who may see all of it and checks each button, and each callback its
+// action's handler emits, against the guards.
+func TestMenuButtonsAreAuthorized(t *testing.T) {
+	ts := newTestService(t, &config.Config{BroadcastAdmins: []string{"all@univ.ru"}})
+	profile := &domain.UserProfile{
+		ID:    1,
+		Email: "all@univ.ru",
+		Role:  domain.RoleStudent,
+		Roles: allRoles,
+	}
+	for _, role := range allRoles {
+		root := ts.menus.Root(role)
+		if root == nil {
+			t.Fatalf("role %s has no menu", role)
+		}
+		sess := &domain.Session{ChatID: 1, Role: role, Language: domain.LanguageEN, Profile: profile}
+		var visit func(node *MenuNode)
+		visit = func(node *MenuNode) {
+			if !ts.authorizeNode(sess, node) {
+				t.Errorf("%s: menu %s is denied", role, node.ID)
+			}
+			kb := ts.buildMenuKeyboard(sess, node)
+			if kb == nil {
+				return
+			}
+			for _, row := range kb.Rows {
+				for _, btn := range row {
+					checkButton(t, ts, sess, node, btn.Payload)
+				}
+			}
+			for _, child := range node.Children {
+				if child.Action == "" {
+					visit(child)
+					continue
+				}
+				for _, prefix := range handlerPrefixes[child.Action] {
+					if !ts.authorizeCallback(sess, prefix+"1") {
+						t.Errorf("%s: %s emits %q callbacks the policy denies", role, child.ID, prefix)
+					}
+				}
+			}
+		}
+		visit(root)
+	}
+}
+
+func checkButton(t *testing.T, ts *testService, sess *domain.Session, node *MenuNode, payload string) {
+	t.Helper()
+	if !ts.authorizeCallback(sess, payload) {
+		t.Errorf("%s: button %q in %s is denied", sess.Role, payload, node.ID)
+		return
+	}
+	switch {
+	case strings.HasPrefix(payload, payloadActionPref):
+		action := domain.ActionID(strings.TrimPrefix(payload, payloadActionPref))
+		if !ts.authorizeAction(sess, action) {
+			t.Errorf("%s: action %s in %s is denied", sess.Role, action, node.ID)
+		}
+	case strings.HasPrefix(payload, payloadNavPrefix):
+		target := ts.menus.Node(strings.TrimPrefix(payload, payloadNavPrefix))
+		if target == nil {
+			t.Errorf("%s: button %q in %s leads nowhere", sess.Role, payload, node.ID)
+		}
+	}
+}
+
+func TestGuestMenuHidesAccountActions(t *testing.T) {
+	ts := newTestService(t, nil)
+	sess := &domain.Session{ChatID: 1, Role: domain.RoleApplicant, Language: domain.LanguageEN}
+	for _, row := range ts.buildMenuKeyboard(sess, ts.menus.Root(domain.RoleApplicant)).Rows {
+		for _, btn := range row {
+			if btn.Payload == payloadNavPrefix+"applicant.settings" {
+				t.Fatalf("guest sees the account settings menu")
+			}
+		}
+	}
+
+	sess.Profile = &domain.UserProfile{ID: 1, Role: domain.RoleStudent, Roles: []domain.Role{domain.RoleApplicant}}
+	found := false
+	for _, row := range ts.buildMenuKeyboard(sess, ts.menus.Root(domain.RoleApplicant)).Rows {
+		for _, btn := range row {
+			found = found || btn.Payload == payloadNavPrefix+"applicant.settings"
+		}
+	}
+	if !found {
+		t.Fatalf("signed-in applicant has no way to switch role or sign out")
+	}
+}
+
+func TestGuestsAreToldApartFromSignedInApplicants(t *testing.T) {
+	ts := newTestService(t, nil)
+	guest := &domain.Session{ChatID: 1, Role: domain.RoleApplicant, Language: domain.LanguageEN}
+	applicant := &domain.Session{
+		ChatID:   2,
+		Role:     domain.RoleApplicant,
+		Language: domain.LanguageEN,
+		Profile:  &domain.UserProfile{ID: 2, Role: domain.RoleStudent, Roles: []domain.Role{domain.RoleStudent, domain.RoleApplicant}},
+	}
+	tests := []struct {
+		name      string
+		allowed   func(sess *domain.Session) bool
+		guest     bool
+		applicant bool
+	}{
+		{"view programs", actionAllowed(ts, domain.ActionViewAdmissionsPrograms), true, true},
+		{"book open day", actionAllowed(ts, domain.ActionBookOpenDay), true, true},
+		{"switch language", actionAllowed(ts, domain.ActionSwitchLanguage), true, true},
+		{"view profile", actionAllowed(ts, domain.ActionViewProfile), false, true},
+		{"switch role", actionAllowed(ts, domain.ActionSwitchRole), false, true},
+		{"log out", actionAllowed(ts, domain.ActionLogout), false, true},
+		{"contact support", actionAllowed(ts, domain.ActionContactSupport), false, true},
+		{"register for event", actionAllowed(ts, domain.ActionEventsRegister), false, true},
+		{"view schedule", actionAllowed(ts, domain.ActionViewSchedule), false, false},
+		{"menu callback", callbackAllowed(ts, payloadNavPrefix+"applicant.root"), true, true},
+		{"role callback", callbackAllowed(ts, payloadRolePref+string(domain.RoleStudent)), false, true},
+		{"event callback", callbackAllowed(ts, "event_select:1"), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.allowed(guest); got != tt.guest {
+				t.Errorf("guest allowed = %v, want %v", got, tt.guest)
+			}
+			if got := tt.allowed(applicant); got != tt.applicant {
+				t.Errorf("signed-in applicant allowed = %v, want %v", got, tt.applicant)
+			}
+		})
+	}
+
+	// Every button a guest is shown passes the guards.
+	for _, row := range ts.buildMenuKeyboard(guest, ts.menus.Root(domain.RoleApplicant)).Rows {
+		for _, btn := range row {
+			checkButton(t, ts, guest, ts.menus.Root(domain.RoleApplicant), btn.Payload)
+		}
+	}
+	for _, child := range ts.menus.Node("applicant.admission").Children {
+		if !ts.authorizeAction(guest, child.Action) {
+			t.Errorf("guest denied %s offered in the applicant menu", child.Action)
+		}
+	}
+}
+
+func actionAllowed(ts *testService, action domain.ActionID) func(*domain.Session) bool {
+	return func(sess *domain.Session) bool { return ts.authorizeAction(sess, action) }
+}
+
+func callbackAllowed(ts *testService, payload string) func(*domain.Session) bool {
+	return func(sess *domain.Session) bool { return ts.authorizeCallback(sess, payload) }
+}
@@ -0,0 +1,566 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+	"github.com/escalopa/inno-vkode/internal/state"
+)
+
+const payloadBroadcastPref = "broadcast:"
+
+// Broadcast drafts live in PendingAction: Step 0 picks the audience, step 1
+// waits for the text and step 2 shows the preview until it is confirmed.
+const (
+	draftAudience = "audience"
+	draftText     = "text"
+	draftOption   = "option."
+
+	broadcastStepAudience = 0
+	broadcastStepText     = 1
+	broadcastStepPreview  = 2
+
+	// broadcastReportFailures caps the failed recipients listed in a report.
+	broadcastReportFailures = 10
+	// dormLookupBatch caps the students per bulk dorm room lookup to keep
+	// the query string short.
+	dormLookupBatch = 200
+
+	// broadcastCheckpoint is how often a running broadcast saves its
+	// progress; after a crash at most the messages sent since then are
+	// repeated.
+	broadcastCheckpoint = 5 * time.Second
+	// broadcastStaleAfter is how long a broadcast may go unsaved before it
+	// counts as abandoned and is resumed; broadcastResumeEvery is how often
+	// that is checked.
+	broadcastStaleAfter  = time.Minute
+	broadcastResumeEvery = 30 * time.Second
+	// broadcastDeliveryTimeout bounds the work for one recipient, retries
+	// included, so a stuck delivery cannot keep a running broadcast unsaved
+	// until it looks stale.
+	broadcastDeliveryTimeout = 20 * time.Second
+)
+
+// canBroadcast reports whether the session may send broadcasts: leadership
+// always, other staff only when listed in BROADCAST_ADMINS.
+func (s *Service) canBroadcast(sess *domain.Session) bool {
+	if sess.Profile == nil {
+		return false
+	}
+	if sess.Role == domain.RoleLeadership {
+		return true
+	}
+	for _, email := range s.cfg.BroadcastAdmins {
+		if strings.EqualFold(strings.TrimSpace(email), sess.Profile.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) startBroadcast(ctx context.Context, sess *domain.Session) error {
+	pa := &domain.PendingAction{
+		ID:        domain.ActionBroadcast,
+		Step:      broadcastStepAudience,
+		Data:      map[string]string{},
+		StartedAt: s.now(),
+	}
+	kb := &domain.Keyboard{}
+	for i, key := range s.audienceOptions(ctx) {
+		pa.Data[draftOption+strconv.Itoa(i)] = key
+		kb.Rows = append(kb.Rows, []domain.KeyboardButton{{
+			Label:   s.audienceLabel(sess.Language, parseAudience(key)),
+			Kind:    domain.ButtonKindCallback,
+			Payload: payloadBroadcastPref + "aud:" + strconv.Itoa(i),
+			Style:   domain.ButtonStylePrimary,
+		}})
+	}
+	kb.Rows = append(kb.Rows, []domain.KeyboardButton{s.broadcastCancelButton(sess)})
+	sess.PendingAction = pa
+	return s.replyMessage(ctx, sess, domain.OutgoingMessage{
+		Text:     s.t(sess.Language, "📣 Новая рассылка\n\nКому отправить сообщение?", "📣 New broadcast\n\nWho should receive it?"),
+		Keyboard: kb,
+	})
+}
+
+func (s *Service) handleBroadcastCallback(ctx context.Context, sess *domain.Session, param string) error {
+	if !s.canBroadcast(sess) {
+		s.logDenied(sess, "callback", payloadBroadcastPref+param)
+		return s.replyForbidden(ctx, sess)
+	}
+	pa := sess.PendingAction
+	if pa == nil || pa.ID != domain.ActionBroadcast {
+		return s.notice(ctx, sess, s.t(sess.Language, "Черновик рассылки не найден. Начните заново из меню.", "Broadcast draft not found. Start again from the menu."))
+	}
+	switch {
+	case strings.HasPrefix(param, "aud:"):
+		key, ok := pa.Data[draftOption+strings.TrimPrefix(param, "aud:")]
+		if !ok {
+			return s.notice(ctx, sess, s.t(sess.Language, "Вариант недоступен.", "Option is not available."))
+		}
+		pa.Data[draftAudience] = key
+		pa.Step = broadcastStepText
+		return s.promptBroadcastText(ctx, sess)
+	case param == "edit":
+		pa.Step = broadcastStepText
+		return s.promptBroadcastText(ctx, sess)
+	case param == "send":
+		if pa.Step != broadcastStepPreview {
+			return s.notice(ctx, sess, s.t(sess.Language, "Сначала введите текст рассылки.", "Enter the broadcast text first."))
+		}
+		return s.confirmBroadcast(ctx, sess)
+	case param == "cancel":
+		sess.PendingAction = nil
+		return s.notice(ctx, sess, s.t(sess.Language, "🚫 Рассылка отменена.", "🚫 Broadcast cancelled."))
+	}
+	return nil
+}
+
+func (s *Service) promptBroadcastText(ctx context.Context, sess *domain.Session) error {
+	aud := parseAudience(sess.PendingAction.Data[draftAudience])
+	text := fmt.Sprintf(s.t(sess.Language, "🎯 Аудитория: %s\n\n✏️ Отправьте текст рассылки одним сообщением.", "🎯 Audience: %s\n\n✏️ Send the broadcast text as one message."), s.audienceLabel(sess.Language, aud))
+	return s.replyMessage(ctx, sess, domain.OutgoingMessage{
+		Text:     text,
+		Keyboard: &domain.Keyboard{Rows: [][]domain.KeyboardButton{{s.broadcastCancelButton(sess)}}},
+	})
+}
+
+func (s *Service) handleBroadcastInput(ctx context.Context, sess *domain.Session, upd domain.Update) error {
+	pa := sess.PendingAction
+	if pa.Step != broadcastStepText {
+		return s.reply(ctx, sess, s.t(sess.Language, "Воспользуйтесь кнопками выше, чтобы продолжить рассылку.", "Use the buttons above to continue the broadcast."))
+	}
+	text := strings.TrimSpace(upd.Text)
+	if text == "" {
+		return s.reply(ctx, sess, s.t(sess.Language, "Текст рассылки не может быть пустым.", "The broadcast text cannot be empty."))
+	}
+	pa.Data[draftText] = text
+	pa.Step = broadcastStepPreview
+	return s.previewBroadcast(ctx, sess)
+}
+
+// previewBroadcast shows the message the way recipients will get it, followed
+// by the audience size and the confirmation buttons.
+func (s *Service) previewBroadcast(ctx context.Context, sess *domain.Session) error {
+	pa := sess.PendingAction
+	aud := parseAudience(pa.Data[draftAudience])
+	if err := s.replyMessage(ctx, sess, s.broadcastMessage(sess.Language, pa.Data[draftText])); err != nil {
+		return err
+	}
+	draft := domain.Broadcast{Recipients: s.broadcastRecipients(ctx, aud)}
+	counts := draft.Tally()
+	text := fmt.Sprintf(s.t(sess.Language,
+		"👆 Предпросмотр рассылки\n\n🎯 Аудитория: %s\n👥 Получат: %d\n🔕 Пропущено (уведомления выключены): %d",
+		"👆 Broadcast preview\n\n🎯 Audience: %s\n👥 Recipients: %d\n🔕 Skipped (notifications off): %d"),
+		s.audienceLabel(sess.Language, aud), counts[domain.RecipientPending], counts[domain.RecipientSkipped])
+	return s.replyMessage(ctx, sess, domain.OutgoingMessage{
+		Text: text,
+		Keyboard: &domain.Keyboard{Rows: [][]domain.KeyboardButton{
+			{
+				{Label: s.t(sess.Language, "✅ Отправить", "✅ Send"), Kind: domain.ButtonKindCallback, Payload: payloadBroadcastPref + "send", Style: domain.ButtonStylePrimary},
+				{Label: s.t(sess.Language, "✏️ Изменить текст", "✏️ Edit text"), Kind: domain.ButtonKindCallback, Payload: payloadBroadcastPref + "edit", Style: domain.ButtonStyleSecondary},
+			},
+			{s.broadcastCancelButton(sess)},
+		}},
+	})
+}
+
+func (s *Service) confirmBroadcast(ctx context.Context, sess *domain.Session) error {
+	pa := sess.PendingAction
+	b := &domain.Broadcast{
+		AuthorChatID: sess.ChatID,
+		AuthorEmail:  sess.Profile.Email,
+		Text:         pa.Data[draftText],
+		Audience:     parseAudience(pa.Data[draftAudience]),
+		CreatedAt:    s.now(),
+	}
+	b.Recipients = s.broadcastRecipients(ctx, b.Audience)
+	if err := s.store.CreateBroadcast(b); err != nil {
+		s.log.Error().Err(err).Str("author", b.AuthorEmail).Msg("failed to save broadcast")
+		return s.notice(ctx, sess, s.t(sess.Language, "⚠️ Не удалось запустить рассылку. Попробуйте ещё раз.", "⚠️ Could not start the broadcast. Please try again."))
+	}
+	sess.PendingAction = nil
+	pending := b.Tally()[domain.RecipientPending]
+	s.log.Info().
+		Int64("broadcast_id", b.ID).
+		Str("author", b.AuthorEmail).
+		Str("audience", pa.Data[draftAudience]).
+		Int("recipients", pending).
+		Msg("broadcast started")
+	s.trackBroadcast(b.ID)
+	go s.runBroadcast(s.broadcastContext(), b)
+	return s.reply(ctx, sess, fmt.Sprintf(s.t(sess.Language,
+		"🚀 Рассылка #%d запущена: %d получателей. Пришлю отчёт, когда она завершится.",
+		"🚀 Broadcast #%d started for %d recipients. You will get a report when it is done."), b.ID, pending))
+}
+
+// runBroadcast delivers b one recipient at a time at BROADCAST_RATE, so a
+// large audience leaves room in the messenger's limits for interactive
+// replies, and reports the outcome to the author. Progress is saved every
+// broadcastCheckpoint; on shutdown the remaining recipients stay pending for
+// resumeBroadcasts. Callers register b with trackBroadcast first.
+func (s *Service) runBroadcast(ctx context.Context, b *domain.Broadcast) {
+	defer s.untrackBroadcast(b.ID)
+	log := s.log.With().Int64("broadcast_id", b.ID).Logger()
+	var tick <-chan time.Time
+	if interval := s.broadcastInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for i := range b.Recipients {
+		r := &b.Recipients[i]
+		if r.Status != domain.RecipientPending {
+			continue
+		}
+		if ctx.Err() == nil && tick != nil {
+			select {
+			case <-ctx.Done():
+			case <-tick:
+			}
+		}
+		if ctx.Err() != nil {
+			if s.checkpointBroadcast(b, log) {
+				log.Info().Int("pending", b.Tally()[domain.RecipientPending]).Msg("broadcast interrupted, progress saved")
+			}
+			return
+		}
+		s.deliverBroadcast(ctx, b, r, log)
+		if s.now().Sub(b.UpdatedAt) >= broadcastCheckpoint && !s.checkpointBroadcast(b, log) {
+			return
+		}
+	}
+	b.FinishedAt = s.now()
+	if !s.checkpointBroadcast(b, log) {
+		return
+	}
+	counts := b.Tally()
+	log.Info().
+		Int("sent", counts[domain.RecipientSent]).
+		Int("failed", counts[domain.RecipientFailed]).
+		Int("skipped", counts[domain.RecipientSkipped]).
+		Dur("took", b.FinishedAt.Sub(b.CreatedAt)).
+		Msg("broadcast finished")
+	s.reportBroadcast(context.WithoutCancel(ctx), b)
+}
+
+func (s *Service) deliverBroadcast(ctx context.Context, b *domain.Broadcast, r *domain.BroadcastRecipient, log zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, broadcastDeliveryTimeout)
+	defer cancel()
+	// The recipient may have opted out or left since the preview.
+	sess, ok := s.store.Get(r.ChatID)
+	switch {
+	case !ok || sess.Profile == nil || sess.Profile.ID != r.ProfileID:
+		r.Status, r.Error = domain.RecipientSkipped, "signed out"
+		return
+	case sess.Suspended:
+		r.Status, r.Error = domain.RecipientSkipped, "chat stopped the bot"
+		return
+	case sess.NotificationsDisabled:
+		r.Status, r.Error = domain.RecipientSkipped, "notifications off"
+		return
+	}
+	if _, err := s.messenger.Send(ctx, r.ChatID, r.UserID, s.broadcastMessage(sess.Language, b.Text)); err != nil {
+		r.Status, r.Error = domain.RecipientFailed, err.Error()
+		log.Warn().Err(err).Int64("chat_id", r.ChatID).Str("email", r.Email).Msg("broadcast delivery failed")
+		return
+	}
+	r.Status, r.SentAt = domain.RecipientSent, s.now()
+	s.recordBroadcastDelivery(ctx, b, r)
+}
+
+// checkpointBroadcast saves b's progress and reports whether this process
+// still runs it: a version conflict means another one has resumed it.
+func (s *Service) checkpointBroadcast(b *domain.Broadcast, log zerolog.Logger) bool {
+	err := s.store.SaveBroadcast(b)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, state.ErrVersionConflict):
+		log.Warn().Msg("broadcast resumed elsewhere, stopping")
+		return false
+	default:
+		log.Warn().Err(err).Msg("failed to save broadcast progress")
+		return true
+	}
+}
+
+// resumeBroadcasts picks up broadcasts nobody has saved for a while: ones cut
+// short by a restart or run by a replica that went away. Claiming one is a
+// compare-and-swap, so only one process resumes it, and a broadcast this
+// process still runs is never claimed.
+func (s *Service) resumeBroadcasts(ctx context.Context) {
+	ticker := time.NewTicker(broadcastResumeEvery)
+	defer ticker.Stop()
+	for {
+		s.resumeStaleBroadcasts(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) resumeStaleBroadcasts(ctx context.Context) {
+	staleAfter := max(broadcastStaleAfter, 3*s.broadcastInterval())
+	for _, b := range s.store.UnfinishedBroadcasts() {
+		if s.now().Sub(b.UpdatedAt) < staleAfter || !s.trackBroadcast(b.ID) {
+			continue
+		}
+		if err := s.store.SaveBroadcast(b); err != nil {
+			s.untrackBroadcast(b.ID)
+			if !errors.Is(err, state.ErrVersionConflict) {
+				s.log.Warn().Err(err).Int64("broadcast_id", b.ID).Msg("failed to claim broadcast")
+			}
+			continue
+		}
+		s.log.Info().
+			Int64("broadcast_id", b.ID).
+			Int("pending", b.Tally()[domain.RecipientPending]).
+			Msg("resuming broadcast")
+		go s.runBroadcast(ctx, b)
+	}
+}
+
+// broadcastContext returns the context new broadcasts run under, the one
+// passed to Start.
+func (s *Service) broadcastContext() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runCtx
+}
+
+// trackBroadcast marks the broadcast as run by this process and reports
+// false if it already is.
+func (s *Service) trackBroadcast(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.broadcasts[id] {
+		return false
+	}
+	s.broadcasts[id] = true
+	return true
+}
+
+func (s *Service) untrackBroadcast(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.broadcasts, id)
+}
+
+func (s *Service) broadcastInterval() time.Duration {
+	if s.cfg.BroadcastRate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / s.cfg.BroadcastRate)
+}
+
+// recordBroadcastDelivery stores the delivered message in the recipient's
+// notification history on the backend. Failures only cost the history entry.
+func (s *Service) recordBroadcastDelivery(ctx context.Context, b *domain.Broadcast, r *domain.BroadcastRecipient) {
+	subject := fmt.Sprintf("Broadcast #%d", b.ID)
+	if _, err := s.backend.SendNotification(ctx, subject, b.Text, &r.ProfileID); err != nil {
+		s.log.Warn().Err(err).Int64("broadcast_id", b.ID).Int64("recipient_id", r.ProfileID).Msg("failed to record broadcast notification")
+	}
+}
+
+func (s *Service) reportBroadcast(ctx context.Context, b *domain.Broadcast) {
+	author, ok := s.store.Get(b.AuthorChatID)
+	if !ok || author.Suspended {
+		return
+	}
+	lang := author.Language
+	counts := b.Tally()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, s.t(lang,
+		"📣 Рассылка #%d завершена\n\n✅ Доставлено: %d\n❌ Ошибок: %d\n🔕 Пропущено: %d",
+		"📣 Broadcast #%d finished\n\n✅ Delivered: %d\n❌ Failed: %d\n🔕 Skipped: %d"),
+		b.ID, counts[domain.RecipientSent], counts[domain.RecipientFailed], counts[domain.RecipientSkipped])
+	if counts[domain.RecipientFailed] > 0 {
+		sb.WriteString(s.t(lang, "\n\nНе доставлено:", "\n\nNot delivered:"))
+		listed := 0
+		for _, r := range b.Recipients {
+			if r.Status != domain.RecipientFailed {
+				continue
+			}
+			if listed == broadcastReportFailures {
+				fmt.Fprintf(&sb, s.t(lang, "\n… и ещё %d", "\n… and %d more"), counts[domain.RecipientFailed]-listed)
+				break
+			}
+			fmt.Fprintf(&sb, "\n• %s — %s", r.Email, r.Error)
+			listed++
+		}
+	}
+	if _, err := s.messenger.Send(ctx, author.ChatID, author.UserID, domain.OutgoingMessage{Text: sb.String()}); err != nil {
+		s.log.Warn().Err(err).Int64("broadcast_id", b.ID).Msg("failed to send broadcast report")
+	}
+}
+
+func (s *Service) broadcastMessage(lang domain.Language, text string) domain.OutgoingMessage {
+	return domain.OutgoingMessage{Text: s.t(lang, "📣 Объявление\n\n", "📣 Announcement\n\n") + text}
+}
+
+func (s *Service) broadcastCancelButton(sess *domain.Session) domain.KeyboardButton {
+	return domain.KeyboardButton{
+		Label:   s.t(sess.Language, "❌ Отмена", "❌ Cancel"),
+		Kind:    domain.ButtonKindCallback,
+		Payload: payloadBroadcastPref + "cancel",
+		Style:   domain.ButtonStyleSecondary,
+	}
+}
+
+// broadcastRecipients resolves an audience against the signed-in chats. A
+// user signed in from several chats is messaged once, in the chat used last.
+func (s *Service) broadcastRecipients(ctx context.Context, aud domain.Audience) []domain.BroadcastRecipient {
+	sessions := s.signedInSessions()
+	var buildings map[int64]string
+	if aud.DormBuilding != "" {
+		buildings = s.dormBuildings(ctx, sessions)
+	}
+	var out []domain.BroadcastRecipient
+	for _, sess := range sessions {
+		p := sess.Profile
+		if !aud.Matches(p, buildings[p.ID]) {
+			continue
+		}
+		r := domain.BroadcastRecipient{
+			ChatID:    sess.ChatID,
+			UserID:    sess.UserID,
+			ProfileID: p.ID,
+			Email:     p.Email,
+			Status:    domain.RecipientPending,
+		}
+		switch {
+		case sess.Suspended:
+			r.Status, r.Error = domain.RecipientSkipped, "chat stopped the bot"
+		case sess.NotificationsDisabled:
+			r.Status, r.Error = domain.RecipientSkipped, "notifications off"
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// signedInSessions returns the most recently used session of every signed-in
+// user, ordered by user ID.
+func (s *Service) signedInSessions() []*domain.Session {
+	latest := make(map[int64]*domain.Session)
+	for _, sess := range s.store.All() {
+		if sess.Profile == nil {
+			continue
+		}
+		if cur, ok := latest[sess.Profile.ID]; ok && !sess.LastActivity.After(cur.LastActivity) {
+			continue
+		}
+		latest[sess.Profile.ID] = sess
+	}
+	out := make([]*domain.Session, 0, len(latest))
+	for _, sess := range latest {
+		out = append(out, sess)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Profile.ID < out[j].Profile.ID })
+	return out
+}
+
+// dormBuildings looks up the building of every dorm resident among sessions
+// in bulk; profiles only carry the room number.
+func (s *Service) dormBuildings(ctx context.Context, sessions []*domain.Session) map[int64]string {
+	var ids []int64
+	for _, sess := range sessions {
+		if p := sess.Profile; p.DormRoom != "" && p.HasRole(domain.RoleStudent) {
+			ids = append(ids, p.ID)
+		}
+	}
+	buildings := make(map[int64]string)
+	for start := 0; start < len(ids); start += dormLookupBatch {
+		batch := ids[start:min(start+dormLookupBatch, len(ids))]
+		rooms, err := s.backend.ListDormRooms(ctx, batch)
+		if err != nil {
+			s.log.Warn().Err(err).Int("students", len(batch)).Msg("failed to load dorm rooms for broadcast")
+			continue
+		}
+		for _, room := range rooms {
+			if room.Building != "" {
+				buildings[room.StudentID] = room.Building
+			}
+		}
+	}
+	return buildings
+}
+
+// audienceOptions lists the segments offered in the picker: the fixed ones
+// plus every faculty and dorm building found among signed-in users.
+func (s *Service) audienceOptions(ctx context.Context) []string {
+	options := []string{
+		"all",
+		"role:" + string(domain.RoleStudent),
+		"role:" + string(domain.RoleEmployee),
+		"role:" + string(domain.RoleLeadership),
+		"foreign",
+	}
+	sessions := s.signedInSessions()
+	faculties := make(map[string]bool)
+	for _, sess := range sessions {
+		if f := strings.TrimSpace(sess.Profile.Faculty); f != "" {
+			faculties[f] = true
+		}
+	}
+	buildings := make(map[string]bool)
+	for _, b := range s.dormBuildings(ctx, sessions) {
+		buildings[b] = true
+	}
+	for _, f := range sortedKeys(faculties) {
+		options = append(options, "faculty:"+f)
+	}
+	for _, b := range sortedKeys(buildings) {
+		options = append(options, "dorm:"+b)
+	}
+	return options
+}
+
+func parseAudience(key string) domain.Audience {
+	kind, value, _ := strings.Cut(key, ":")
+	switch kind {
+	case "role":
+		return domain.Audience{Role: domain.Role(value)}
+	case "foreign":
+		return domain.Audience{ForeignOnly: true}
+	case "faculty":
+		return domain.Audience{Faculty: value}
+	case "dorm":
+		return domain.Audience{DormBuilding: value}
+	}
+	return domain.Audience{}
+}
+
+func (s *Service) audienceLabel(lang domain.Language, aud domain.Audience) string {
+	switch {
+	case aud.Role != "":
+		return s.roleTitle(lang, aud.Role)
+	case aud.ForeignOnly:
+		return s.t(lang, "🌍 Иностранные пользователи", "🌍 International users")
+	case aud.Faculty != "":
+		return s.t(lang, "🏛️ Факультет: ", "🏛️ Faculty: ") + aud.Faculty
+	case aud.DormBuilding != "":
+		return s.t(lang, "🏠 Общежитие: ", "🏠 Dorm building: ") + aud.DormBuilding
+	}
+	return s.t(lang, "👥 Все пользователи", "👥 Everyone")
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,373 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// waitForReport waits until the broadcast report reaches the author.
+func waitForReport(t *testing.T, ts *testService, authorChatID int64) domain.OutgoingMessage {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, msg := range ts.messenger.to(authorChatID) {
+			if strings.Contains(msg.Text, "finished") {
+				return msg
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no broadcast report sent to chat %d", authorChatID)
+	return domain.OutgoingMessage{}
+}
+
+func TestBroadcastDraftLooksUpDormRoomsInBulk(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "rector@univ.ru", Role: domain.RoleLeadership})
+	for id := int64(10); id < 30; id++ {
+		ts.signIn(t, id, domain.UserProfile{ID: id, DormRoom: "101", Roles: []domain.Role{domain.RoleStudent}})
+		building := "A"
+		if id%2 == 0 {
+			building = "B"
+		}
+		ts.backend.dormBuildings[id] = building
+	}
+
+	ts.press(t, 1, payloadActionPref+string(domain.ActionBroadcast))
+	ts.press(t, 1, ts.messenger.button(t, 1, "Dorm building: B"))
+	ts.write(t, 1, "Hot water is off tomorrow")
+	if preview := ts.messenger.last(t, 1); !strings.Contains(preview.Text, "Recipients: 10") {
+		t.Fatalf("preview = %q, want 10 recipients", preview.Text)
+	}
+	ts.press(t, 1, ts.messenger.button(t, 1, "Send"))
+	waitForReport(t, ts, 1)
+
+	// Picker, preview and confirmation resolve the audience once each.
+	if calls := ts.backend.dormLookups(); calls != 3 {
+		t.Errorf("dorm room lookups = %d, want 3 for 20 residents", calls)
+	}
+	for id := int64(10); id < 30; id++ {
+		got := len(ts.messenger.to(id))
+		if want := int(1 - id%2); got != want {
+			t.Errorf("chat %d got %d messages, want %d", id, got, want)
+		}
+	}
+}
+
+func TestStoredSessionsWithoutNotificationSettingGetBroadcasts(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "rector@univ.ru", Role: domain.RoleLeadership})
+	// A session written before the opt-out existed has no such field.
+	ts.signIn(t, 2, domain.UserProfile{ID: 2, Email: "old@univ.ru"})
+	ts.signIn(t, 3, domain.UserProfile{ID: 3, Email: "opted-out@univ.ru"})
+	if _, err := ts.store.Update(3, func(sess *domain.Session) error {
+		sess.NotificationsDisabled = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	recipients := ts.broadcastRecipients(context.Background(), domain.Audience{Role: domain.RoleStudent})
+	status := make(map[int64]domain.RecipientStatus)
+	for _, r := range recipients {
+		status[r.ChatID] = r.Status
+	}
+	if status[2] != domain.RecipientPending || status[3] != domain.RecipientSkipped {
+		t.Fatalf("statuses = %v, want chat 2 pending and chat 3 skipped", status)
+	}
+}
+
+func TestBroadcastRecipients(t *testing.T) {
+	ts := newTestService(t, nil)
+	profiles := []domain.UserProfile{
+		{ID: 1, Email: "physics@univ.ru", Faculty: "Physics", DormRoom: "12"},
+		{ID: 2, Email: "math@univ.ru", Faculty: "Math", IsForeign: true},
+		{ID: 3, Email: "teacher@univ.ru", Role: domain.RoleEmployee, Faculty: "Physics"},
+		{ID: 4, Email: "rector@univ.ru", Role: domain.RoleLeadership, Roles: []domain.Role{domain.RoleEmployee}},
+	}
+	for _, p := range profiles {
+		ts.signIn(t, p.ID, p)
+	}
+	ts.backend.dormBuildings[1] = "A"
+	// User 2 also signed in from chat 20 later; only that chat is messaged.
+	time.Sleep(time.Millisecond)
+	ts.signIn(t, 20, profiles[1])
+	// A guest is never a recipient.
+	if err := ts.store.Save(&domain.Session{ChatID: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.store.Update(3, func(sess *domain.Session) error {
+		sess.NotificationsDisabled = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ts.stopChat(4)
+
+	tests := []struct {
+		name string
+		aud  domain.Audience
+		want map[int64]domain.RecipientStatus
+	}{
+		{"everyone", domain.Audience{}, map[int64]domain.RecipientStatus{
+			1: domain.RecipientPending, 20: domain.RecipientPending, 3: domain.RecipientSkipped, 4: domain.RecipientSkipped,
+		}},
+		{"students", domain.Audience{Role: domain.RoleStudent}, map[int64]domain.RecipientStatus{
+			1: domain.RecipientPending, 20: domain.RecipientPending,
+		}},
+		{"employees", domain.Audience{Role: domain.RoleEmployee}, map[int64]domain.RecipientStatus{
+			3: domain.RecipientSkipped, 4: domain.RecipientSkipped,
+		}},
+		{"faculty", domain.Audience{Faculty: "physics"}, map[int64]domain.RecipientStatus{
+			1: domain.RecipientPending, 3: domain.RecipientSkipped,
+		}},
+		{"foreign", domain.Audience{ForeignOnly: true}, map[int64]domain.RecipientStatus{
+			20: domain.RecipientPending,
+		}},
+		{"dorm building", domain.Audience{DormBuilding: "A"}, map[int64]domain.RecipientStatus{
+			1: domain.RecipientPending,
+		}},
+		{"nobody", domain.Audience{Faculty: "History"}, map[int64]domain.RecipientStatus{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[int64]domain.RecipientStatus)
+			for _, r := range ts.broadcastRecipients(context.Background(), tt.aud) {
+				if _, dup := got[r.ChatID]; dup {
+					t.Errorf("chat %d listed twice", r.ChatID)
+				}
+				got[r.ChatID] = r.Status
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("recipients = %v, want %v", got, tt.want)
+			}
+			for chat, status := range tt.want {
+				if got[chat] != status {
+					t.Errorf("chat %d: status %q, want %q", chat, got[chat], status)
+				}
+			}
+		})
+	}
+}
+
+// newBroadcast stores a broadcast to chats, all pending, as confirmBroadcast
+// does.
+func newBroadcast(t *testing.T, ts *testService, author int64, chats ...int64) *domain.Broadcast {
+	t.Helper()
+	b := &domain.Broadcast{AuthorChatID: author, AuthorEmail: "rector@univ.ru", Text: "Campus closed today", CreatedAt: time.Now()}
+	for _, chat := range chats {
+		b.Recipients = append(b.Recipients, domain.BroadcastRecipient{
+			ChatID:    chat,
+			UserID:    chat,
+			ProfileID: chat,
+			Email:     strconv.FormatInt(chat, 10) + "@univ.ru",
+			Status:    domain.RecipientPending,
+		})
+	}
+	if err := ts.store.CreateBroadcast(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRunBroadcast(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "rector@univ.ru", Role: domain.RoleLeadership})
+	for chat := int64(10); chat <= 14; chat++ {
+		ts.signIn(t, chat, domain.UserProfile{ID: chat})
+	}
+	b := newBroadcast(t, ts, 1, 10, 11, 12, 13, 14, 15)
+	// Since the preview: 11 opted out, 12 blocked the bot, 13's chat fails
+	// and 15 signed out.
+	if _, err := ts.store.Update(11, func(sess *domain.Session) error {
+		sess.NotificationsDisabled = true
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ts.stopChat(12)
+	ts.messenger.failTo = map[int64]error{13: errors.New("chat not found")}
+
+	ts.runBroadcast(context.Background(), b)
+
+	want := map[int64]domain.RecipientStatus{
+		10: domain.RecipientSent,
+		11: domain.RecipientSkipped,
+		12: domain.RecipientSkipped,
+		13: domain.RecipientFailed,
+		14: domain.RecipientSent,
+		15: domain.RecipientSkipped,
+	}
+	for _, r := range b.Recipients {
+		if r.Status != want[r.ChatID] {
+			t.Errorf("chat %d: status %q (%s), want %q", r.ChatID, r.Status, r.Error, want[r.ChatID])
+		}
+	}
+	for chat, status := range want {
+		got := len(ts.messenger.to(chat))
+		if wantSent := map[bool]int{true: 1}[status == domain.RecipientSent]; got != wantSent {
+			t.Errorf("chat %d got %d messages, want %d", chat, got, wantSent)
+		}
+	}
+	if got := ts.backend.notifications; len(got) != 2 || got[0] != 10 || got[1] != 14 {
+		t.Errorf("recorded notifications for %v, want [10 14]", got)
+	}
+
+	report := ts.messenger.last(t, 1).Text
+	for _, part := range []string{"Delivered: 2", "Failed: 1", "Skipped: 3", "13@univ.ru — chat not found"} {
+		if !strings.Contains(report, part) {
+			t.Errorf("report lacks %q:\n%s", part, report)
+		}
+	}
+	if b.FinishedAt.IsZero() || len(ts.store.UnfinishedBroadcasts()) != 0 {
+		t.Errorf("finished broadcast not saved as finished")
+	}
+}
+
+func TestRunBroadcastSavesProgressOnShutdownAndResumes(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "rector@univ.ru", Role: domain.RoleLeadership})
+	for chat := int64(10); chat <= 13; chat++ {
+		ts.signIn(t, chat, domain.UserProfile{ID: chat})
+	}
+	b := newBroadcast(t, ts, 1, 10, 11, 12, 13)
+
+	// The bot shuts down after the first two messages.
+	ctx, cancel := context.WithCancel(context.Background())
+	ts.messenger.onSend = func(_ context.Context, chatID int64) {
+		if chatID == 11 {
+			cancel()
+		}
+	}
+	ts.runBroadcast(ctx, b)
+	ts.messenger.onSend = nil
+
+	unfinished := ts.store.UnfinishedBroadcasts()
+	if len(unfinished) != 1 {
+		t.Fatalf("%d unfinished broadcasts stored, want 1", len(unfinished))
+	}
+	if counts := unfinished[0].Tally(); counts[domain.RecipientSent] != 2 || counts[domain.RecipientPending] != 2 {
+		t.Fatalf("saved progress = %v, want 2 sent and 2 pending", counts)
+	}
+	if msgs := ts.messenger.to(1); len(msgs) != 0 {
+		t.Fatalf("report sent for an interrupted broadcast: %q", msgs[0].Text)
+	}
+
+	// Still fresh: the runner may be alive elsewhere.
+	ts.resumeStaleBroadcasts(context.Background())
+	if len(ts.messenger.to(12)) != 0 {
+		t.Fatalf("fresh broadcast resumed")
+	}
+
+	ts.now = func() time.Time { return time.Now().Add(broadcastStaleAfter + time.Second) }
+	ts.resumeStaleBroadcasts(context.Background())
+	waitForReport(t, ts, 1)
+	for chat := int64(10); chat <= 13; chat++ {
+		if got := len(ts.messenger.to(chat)); got != 1 {
+			t.Errorf("chat %d got %d messages, want exactly 1", chat, got)
+		}
+	}
+	if len(ts.store.UnfinishedBroadcasts()) != 0 {
+		t.Errorf("resumed broadcast not finished")
+	}
+}
+
+func TestRunBroadcastStopsWhenResumedElsewhere(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "rector@univ.ru", Role: domain.RoleLeadership})
+	for chat := int64(10); chat <= 12; chat++ {
+		ts.signIn(t, chat, domain.UserProfile{ID: chat})
+	}
+	b := newBroadcast(t, ts, 1, 10, 11, 12)
+	// Another replica claims the broadcast while this one is sending.
+	ts.messenger.onSend = func(_ context.Context, chatID int64) {
+		if chatID == 10 {
+			claimed := ts.store.UnfinishedBroadcasts()[0]
+			if err := ts.store.SaveBroadcast(claimed); err != nil {
+				t.Errorf("claim: %v", err)
+			}
+		}
+	}
+	ts.now = func() time.Time { return time.Now().Add(broadcastCheckpoint) }
+
+	ts.runBroadcast(context.Background(), b)
+
+	if got := len(ts.messenger.to(11)) + len(ts.messenger.to(12)); got != 0 {
+		t.Errorf("kept sending %d messages after losing the broadcast", got)
+	}
+	if msgs := ts.messenger.to(1); len(msgs) != 0 {
+		t.Errorf("reported a broadcast it no longer runs: %q", msgs[0].Text)
+	}
+}
+
+func TestResumeSkipsBroadcastsRunningHere(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "rector@univ.ru", Role: domain.RoleLeadership})
+	ts.signIn(t, 10, domain.UserProfile{ID: 10})
+	b := newBroadcast(t, ts, 1, 10)
+	// A slow delivery has kept the broadcast unsaved past staleAfter.
+	ts.trackBroadcast(b.ID)
+	ts.now = func() time.Time { return time.Now().Add(broadcastStaleAfter + time.Second) }
+
+	ts.resumeStaleBroadcasts(context.Background())
+
+	if got := len(ts.messenger.to(10)); got != 0 {
+		t.Fatalf("resumed a broadcast this process runs: %d messages sent", got)
+	}
+	if unfinished := ts.store.UnfinishedBroadcasts(); len(unfinished) != 1 || unfinished[0].Version != b.Version {
+		t.Fatalf("broadcast claimed from its own runner")
+	}
+	// Its runner still owns it and finishes it.
+	ts.runBroadcast(context.Background(), b)
+	if len(ts.messenger.to(10)) != 1 || len(ts.store.UnfinishedBroadcasts()) != 0 {
+		t.Fatalf("runner did not finish the broadcast")
+	}
+}
+
+func TestBroadcastDeliveryIsBounded(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "rector@univ.ru", Role: domain.RoleLeadership})
+	ts.signIn(t, 10, domain.UserProfile{ID: 10})
+	b := newBroadcast(t, ts, 1, 10)
+	var deadline time.Time
+	ts.messenger.onSend = func(ctx context.Context, chatID int64) {
+		if chatID == 10 {
+			deadline, _ = ctx.Deadline()
+		}
+	}
+
+	ts.runBroadcast(context.Background(), b)
+
+	if deadline.IsZero() || time.Until(deadline) > broadcastDeliveryTimeout {
+		t.Fatalf("delivery deadline %v, want at most %v away", deadline, broadcastDeliveryTimeout)
+	}
+}
+
+func TestBroadcastConfirmedWhileStarting(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "rector@univ.ru", Role: domain.RoleLeadership})
+	ts.signIn(t, 10, domain.UserProfile{ID: 10})
+	ts.press(t, 1, payloadActionPref+string(domain.ActionBroadcast))
+	ts.press(t, 1, ts.messenger.button(t, 1, "Everyone"))
+	ts.write(t, 1, "Library closes early today")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := make(chan error, 1)
+	go func() { started <- ts.Start(ctx) }()
+	ts.press(t, 1, ts.messenger.button(t, 1, "Send"))
+
+	waitForReport(t, ts, 1)
+	if err := <-started; err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if got := len(ts.messenger.to(10)); got != 1 {
+		t.Fatalf("chat 10 got %d messages, want 1", got)
+	}
+}
@@ -0,0 +1,126 @@
+package bot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+const (
+	callbackSigSep = "|"
+	callbackSigLen = 12
+)
+
+// signedCallbackPrefixes are the payloads that carry identifiers or drive
+// backend writes; they must come back exactly as the bot issued them.
+var signedCallbackPrefixes = []string{
+	"event_select:",
+	"event_mode:",
+	"cancel_event:",
+	"schedule:",
+	"visa_app:",
+	"visa_withdraw:",
+	"visa_docs:",
+	"visa_type:",
+	payloadBroadcastPref,
+}
+
+var (
+	errCallbackMalformed = errors.New("malformed signed callback")
+	errCallbackSignature = errors.New("callback signature mismatch")
+	errCallbackExpired   = errors.New("callback expired")
+)
+
+func requiresSignature(payload string) bool {
+	for _, prefix := range signedCallbackPrefixes {
+		if strings.HasPrefix(payload, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) signKeyboard(sess *domain.Session, kb *domain.Keyboard) *domain.Keyboard {
+	if kb == nil {
+		return nil
+	}
+	signed := &domain.Keyboard{Rows: make([][]domain.KeyboardButton, len(kb.Rows))}
+	issued := s.now()
+	for i, row := range kb.Rows {
+		signed.Rows[i] = make([]domain.KeyboardButton, len(row))
+		for j, btn := range row {
+			if btn.Kind == domain.ButtonKindCallback && requiresSignature(btn.Payload) {
+				btn.Payload = s.signCallback(sess, btn.Payload, issued)
+			}
+			signed.Rows[i][j] = btn
+		}
+	}
+	return signed
+}
+
+func (s *Service) signCallback(sess *domain.Session, payload string, issued time.Time) string {
+	ts := strconv.FormatInt(issued.Unix(), 36)
+	return payload + callbackSigSep + ts + callbackSigSep + s.callbackMAC(sess, payload, ts)
+}
+
+// verifyCallback strips and checks the signature of a signed payload and
+// returns the original payload.
+func (s *Service) verifyCallback(sess *domain.Session, raw string) (string, error) {
+	parts := strings.Split(raw, callbackSigSep)
+	if len(parts) != 3 {
+		return "", errCallbackMalformed
+	}
+	payload, ts, sig := parts[0], parts[1], parts[2]
+	if !hmac.Equal([]byte(sig), []byte(s.callbackMAC(sess, payload, ts))) {
+		return "", errCallbackSignature
+	}
+	issuedUnix, err := strconv.ParseInt(ts, 36, 64)
+	if err != nil {
+		return "", errCallbackMalformed
+	}
+	if s.cfg.CallbackTTL > 0 && s.now().Sub(time.Unix(issuedUnix, 0)) > s.cfg.CallbackTTL {
+		return "", errCallbackExpired
+	}
+	return payload, nil
+}
+
+func (s *Service) callbackMAC(sess *domain.Session, payload, ts string) string {
+	mac := hmac.New(sha256.New, s.callbackKey)
+	fmt.Fprintf(mac, "%d|%d|%s|%s", sess.ChatID, sess.UserID, ts, payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:callbackSigLen]
+}
+
+func (s *Service) rejectCallback(ctx context.Context, sess *domain.Session, raw string, err error) error {
+	s.log.Warn().
+		Err(err).
+		Int64("chat_id", sess.ChatID).
+		Int64("user_id", sess.UserID).
+		Str("payload", raw).
+		Msg("rejected callback payload")
+	if errors.Is(err, errCallbackExpired) {
+		return s.alert(ctx, sess, s.t(sess.Language, "⌛ Эта кнопка устарела. Откройте раздел в меню ещё раз.", "⌛ This button has expired. Please open the section from the menu again."))
+	}
+	return s.alert(ctx, sess, s.t(sess.Language, "🚫 Кнопка недействительна. Откройте раздел в меню ещё раз.", "🚫 This button is not valid. Please open the section from the menu again."))
+}
+
+func (s *Service) ownsVisaApplication(ctx context.Context, userID, appID int64) (bool, error) {
+	apps, err := s.backend.GetVisaApplications(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	want := strconv.FormatInt(appID, 10)
+	for _, app := range apps {
+		if fmt.Sprintf("%v", app["id"]) == want {
+			return true, nil
+		}
+	}
+	return false, nil
+}
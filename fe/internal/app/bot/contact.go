@@ -0,0 +1,72 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// skipInput is what users type to leave an optional contact field empty.
+const skipInput = "-"
+
+// normalizePhone converts a phone number to E.164. Numbers written without a
+// country code are taken as Russian: ten digits, or eleven with the domestic
+// 8 prefix. A plus is only accepted in front of the country code.
+func normalizePhone(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	international := strings.HasPrefix(raw, "+")
+	if international {
+		raw = raw[1:]
+	}
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+		default:
+			return "", false
+		}
+	}
+	num := digits.String()
+	switch {
+	case international:
+	case strings.HasPrefix(num, "00"):
+		num = num[2:]
+	case len(num) == 11 && num[0] == '8':
+		num = "7" + num[1:]
+	case len(num) == 10 && num[0] != '0':
+		num = "7" + num
+	}
+	if len(num) < 8 || len(num) > 15 || num[0] == '0' {
+		return "", false
+	}
+	return "+" + num, true
+}
+
+func (s *Service) contactKeyboard(sess *domain.Session) *domain.Keyboard {
+	return &domain.Keyboard{Rows: [][]domain.KeyboardButton{{{
+		Label: s.t(sess.Language, "📱 Поделиться номером", "📱 Share my phone number"),
+		Kind:  domain.ButtonKindContact,
+		Style: domain.ButtonStylePrimary,
+	}}}}
+}
+
+// contactPhone extracts a normalized phone number from a shared contact or
+// typed text. It returns a user-facing problem when the input is unusable.
+func (s *Service) contactPhone(sess *domain.Session, upd domain.Update) (string, string) {
+	raw := upd.Text
+	if upd.Contact != nil {
+		// Only the user's own contact counts; forwarding someone else's card
+		// must not book in their name.
+		if upd.Contact.UserID != 0 && upd.UserID != 0 && upd.Contact.UserID != upd.UserID {
+			return "", s.t(sess.Language, "⚠️ Поделитесь, пожалуйста, своим собственным контактом.", "⚠️ Please share your own contact.")
+		}
+		raw = upd.Contact.Phone
+	}
+	phone, ok := normalizePhone(raw)
+	if !ok {
+		return "", s.t(sess.Language, "⚠️ Не удалось распознать номер. Введите его в формате +79991234567 или нажмите кнопку ниже.", "⚠️ Couldn't read that number. Type it as +79991234567 or use the button below.")
+	}
+	return phone, ""
+}
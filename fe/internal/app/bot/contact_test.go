@@ -0,0 +1,38 @@
+package bot
+
+import "testing"
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		raw    string
+		want   string
+		wantOK bool
+	}{
+		{"+7 999 123-45-67", "+79991234567", true},
+		{"8 (999) 123-45-67", "+79991234567", true},
+		{"999 123 45 67", "+79991234567", true},
+		{"495 123-45-67", "+74951234567", true},
+		{"(812) 123.45.67", "+78121234567", true},
+		{"800 555-35-35", "+78005553535", true},
+		{"79991234567", "+79991234567", true},
+		{"0049 30 1234567", "+49301234567", true},
+		{"+44 20 7946 0958", "+442079460958", true},
+		{"  +7 999 123 45 67  ", "+79991234567", true},
+		{"7+9991234567", "", false},
+		{"+7 999 +123 45 67", "", false},
+		{"++79991234567", "", false},
+		{"012 345 67 89", "", false},
+		{"1234567", "", false},
+		{"+1234567890123456", "", false},
+		{"999-CALL-NOW", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, ok := normalizePhone(tt.raw)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("normalizePhone(%q) = %q, %v, want %q, %v", tt.raw, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
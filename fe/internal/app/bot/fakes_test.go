@@ -0,0 +1,295 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/config"
+	"github.com/escalopa/inno-vkode/internal/domain"
+	"github.com/escalopa/inno-vkode/internal/ports"
+	"github.com/escalopa/inno-vkode/internal/state"
+)
+
+type sentMessage struct {
+	ChatID int64
+	Msg    domain.OutgoingMessage
+}
+
+// fakeMessenger records outgoing messages. onSend, if set, runs before each
+// send is recorded.
+type fakeMessenger struct {
+	mu     sync.Mutex
+	sent   []sentMessage
+	onSend func(ctx context.Context, chatID int64)
+	failTo map[int64]error
+	nextID int
+}
+
+func (m *fakeMessenger) Start(context.Context, func(context.Context, domain.Update) (domain.CallbackAnswer, error)) error {
+	return nil
+}
+
+func (m *fakeMessenger) Send(ctx context.Context, chatID, _ int64, msg domain.OutgoingMessage) (string, error) {
+	if m.onSend != nil {
+		m.onSend(ctx, chatID)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.failTo[chatID]; err != nil {
+		return "", err
+	}
+	m.sent = append(m.sent, sentMessage{ChatID: chatID, Msg: msg})
+	m.nextID++
+	return strconv.Itoa(m.nextID), nil
+}
+
+func (m *fakeMessenger) Edit(_ context.Context, chatID int64, _ string, msg domain.OutgoingMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, sentMessage{ChatID: chatID, Msg: msg})
+	return nil
+}
+
+func (m *fakeMessenger) Delete(context.Context, int64, string) error { return nil }
+
+func (m *fakeMessenger) to(chatID int64) []domain.OutgoingMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []domain.OutgoingMessage
+	for _, s := range m.sent {
+		if s.ChatID == chatID {
+			out = append(out, s.Msg)
+		}
+	}
+	return out
+}
+
+func (m *fakeMessenger) last(t *testing.T, chatID int64) domain.OutgoingMessage {
+	t.Helper()
+	msgs := m.to(chatID)
+	if len(msgs) == 0 {
+		t.Fatalf("nothing sent to chat %d", chatID)
+	}
+	return msgs[len(msgs)-1]
+}
+
+// button returns the payload of the first button in the last message to
+// chatID whose label contains label.
+func (m *fakeMessenger) button(t *testing.T, chatID int64, label string) string {
+	t.Helper()
+	msg := m.last(t, chatID)
+	if msg.Keyboard != nil {
+		for _, row := range msg.Keyboard.Rows {
+			for _, b := range row {
+				if strings.Contains(b.Label, label) {
+					return b.Payload
+				}
+			}
+		}
+	}
+	t.Fatalf("no %q button in %q", label, msg.Text)
+	return ""
+}
+
+// fakeBackend implements the backend calls the tests need; anything else
+// panics through the nil embedded interface.
+type fakeBackend struct {
+	ports.Backend
+
+	mu            sync.Mutex
+	dormBuildings map[int64]string
+	dormCalls     int
+	notifications []int64
+}
+
+func (b *fakeBackend) ListDormRooms(_ context.Context, studentIDs []int64) ([]domain.DormRoom, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dormCalls++
+	var rooms []domain.DormRoom
+	for _, id := range studentIDs {
+		if building, ok := b.dormBuildings[id]; ok {
+			rooms = append(rooms, domain.DormRoom{StudentID: id, Building: building})
+		}
+	}
+	return rooms, nil
+}
+
+func (b *fakeBackend) GetUserByEmail(_ context.Context, email string) (*domain.UserProfile, error) {
+	return &domain.UserProfile{ID: 1, Email: email, Role: domain.RoleStudent}, nil
+}
+
+func (b *fakeBackend) dormLookups() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.dormCalls
+}
+
+func (b *fakeBackend) SendNotification(_ context.Context, _, _ string, recipientID *int64) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.notifications = append(b.notifications, *recipientID)
+	return int64(len(b.notifications)), nil
+}
+
+// countingStore counts writes that reach the wrapped store.
+type countingStore struct {
+	state.Store
+	mu    sync.Mutex
+	saves int
+}
+
+func (s *countingStore) Save(sess *domain.Session) error {
+	s.mu.Lock()
+	s.saves++
+	s.mu.Unlock()
+	return s.Store.Save(sess)
+}
+
+func (s *countingStore) Update(chatID int64, fn func(*domain.Session) error) (*domain.Session, error) {
+	for attempt := 0; attempt < 5; attempt++ {
+		sess, ok := s.Get(chatID)
+		if !ok {
+			return nil, state.ErrSessionNotFound
+		}
+		if err := fn(sess); err != nil {
+			return nil, err
+		}
+		err := s.Save(sess)
+		if err == nil {
+			return sess, nil
+		}
+		if !errors.Is(err, state.ErrVersionConflict) {
+			return nil, err
+		}
+	}
+	return nil, state.ErrVersionConflict
+}
+
+func (s *countingStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
+
+// fakeEmail records the addresses codes were sent to.
+type fakeEmail struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (e *fakeEmail) SendOTP(_ context.Context, email, _ string, _ domain.Language) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sent = append(e.sent, email)
+	return nil
+}
+
+func (e *fakeEmail) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.sent)
+}
+
+type testService struct {
+	*Service
+	store     *countingStore
+	messenger *fakeMessenger
+	backend   *fakeBackend
+	email     *fakeEmail
+}
+
+func newTestService(t *testing.T, cfg *config.Config) *testService {
+	t.Helper()
+	if cfg == nil {
+		cfg = &config.Config{}
+	}
+	if cfg.CallbackSecret == "" {
+		cfg.CallbackSecret = "test-secret"
+	}
+	if cfg.CallbackTTL == 0 {
+		cfg.CallbackTTL = time.Hour
+	}
+	store := &countingStore{Store: state.NewMemoryStore(time.Now)}
+	messenger := &fakeMessenger{}
+	backend := &fakeBackend{dormBuildings: map[int64]string{}}
+	email := &fakeEmail{}
+	return &testService{
+		Service:   New(cfg, zerolog.Nop(), backend, messenger, email, store),
+		store:     store,
+		messenger: messenger,
+		backend:   backend,
+		email:     email,
+	}
+}
+
+// signIn stores a signed-in session at the main menu.
+func (ts *testService) signIn(t *testing.T, chatID int64, profile domain.UserProfile) {
+	t.Helper()
+	if profile.Role == "" {
+		profile.Role = domain.RoleStudent
+	}
+	sess := &domain.Session{
+		ChatID:     chatID,
+		UserID:     chatID,
+		Language:   domain.LanguageEN,
+		Role:       profile.Role,
+		Stage:      domain.StageMainMenu,
+		Email:      profile.Email,
+		Profile:    &profile,
+		LoggedInAt: time.Now(),
+	}
+	if root := ts.menus.Root(profile.Role); root != nil {
+		sess.CurrentMenu = root.ID
+	}
+	if err := ts.store.Save(sess); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+}
+
+func (ts *testService) session(t *testing.T, chatID int64) *domain.Session {
+	t.Helper()
+	sess, ok := ts.store.Get(chatID)
+	if !ok {
+		t.Fatalf("no session for chat %d", chatID)
+	}
+	return sess
+}
+
+// press sends a callback, signing payloads that need a signature.
+func (ts *testService) press(t *testing.T, chatID int64, payload string) domain.CallbackAnswer {
+	t.Helper()
+	if requiresSignature(payload) && !strings.Contains(payload, callbackSigSep) {
+		payload = ts.signCallback(ts.session(t, chatID), payload, time.Now())
+	}
+	answer, err := ts.handleUpdate(context.Background(), domain.Update{
+		Type:    domain.UpdateTypeCallback,
+		ChatID:  chatID,
+		UserID:  chatID,
+		Payload: payload,
+	})
+	if err != nil {
+		t.Fatalf("callback %q: %v", payload, err)
+	}
+	return answer
+}
+
+func (ts *testService) write(t *testing.T, chatID int64, text string) {
+	t.Helper()
+	_, err := ts.handleUpdate(context.Background(), domain.Update{
+		Type:   domain.UpdateTypeMessage,
+		ChatID: chatID,
+		UserID: chatID,
+		Text:   text,
+	})
+	if err != nil {
+		t.Fatalf("message %q: %v", text, err)
+	}
+}
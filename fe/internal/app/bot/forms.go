@@ -14,6 +14,12 @@ type FormField struct {
 	Key      string
 	Prompt   map[domain.Language]string
 	Optional bool
+	// Upload makes the field expect an attachment instead of text. Text sent
+	// to an optional upload field skips it.
+	Upload *UploadRule
+	// Contact fields take a phone number, typed or shared with the contact
+	// button, and store it in E.164.
+	Contact bool
 }
 
 func (f FormField) PromptText(lang domain.Language) string {
@@ -50,6 +56,7 @@ func (s *Service) buildForms() map[domain.ActionID]FormDefinition {
 			Fields: []FormField{
 				{Key: "type", Prompt: l("Тип проблемы (электрика, сантехника...):", "Issue type (electrical, plumbing...):")},
 				{Key: "details", Prompt: l("Подробности:", "Details:")},
+				{Key: "photo", Prompt: l("Пришлите фото проблемы или напишите «-», чтобы пропустить:", "Send a photo of the issue or type \"-\" to skip:"), Optional: true, Upload: &photoUpload},
 			},
 			OnSubmit: submitDormMaintenance,
 		},
@@ -145,11 +152,20 @@ func (s *Service) buildForms() map[domain.ActionID]FormDefinition {
 				{Key: "event_id", Prompt: l("ID мероприятия:", "Event ID:")},
 				{Key: "name", Prompt: l("Ваше имя:", "Your name:")},
 				{Key: "email", Prompt: l("Email:", "Email:")},
-				{Key: "phone", Prompt: l("Телефон:", "Phone:"), Optional: true},
+				{Key: "phone", Prompt: l("Телефон: нажмите кнопку, чтобы поделиться номером, введите его вручную или отправьте «-», чтобы пропустить:", "Phone: tap the button to share your number, type it, or send \"-\" to skip:"), Optional: true, Contact: true},
 				{Key: "note", Prompt: l("Примечание (опционально):", "Note (optional):"), Optional: true},
 			},
 			OnSubmit: submitAdmissionEventBooking,
 		},
+		domain.ActionAdmissionDocuments: {
+			Intro: l("📄 Необходимые документы для поступления: копия паспорта, диплом с приложением, результаты ЕГЭ, мотивационное письмо, фото 3x4.\nОтправляйте по одному файлу (PDF, JPEG или PNG, до 10 МБ).", "📄 Documents required for admission: passport copy, previous diploma with transcript, exam results, motivation letter, 3x4 photo.\nSend one file at a time (PDF, JPEG or PNG, up to 10 MB)."),
+			Fields: []FormField{
+				{Key: "name", Prompt: l("Ваше имя:", "Your name:")},
+				{Key: "email", Prompt: l("Email:", "Email:")},
+				{Key: "document", Prompt: l("Прикрепите документ:", "Attach the document:"), Upload: &documentUpload},
+			},
+			OnSubmit: submitAdmissionDocument,
+		},
 	}
 }
 
@@ -159,7 +175,6 @@ func (s *Service) startForm(ctx context.Context, sess *domain.Session, action do
 		Step: 0,
 		Data: map[string]string{},
 	}
-	s.saveSession(sess)
 	intro := ""
 	if def.Intro != nil {
 		intro = def.Intro[domain.LanguageRU]
@@ -169,10 +184,18 @@ func (s *Service) startForm(ctx context.Context, sess *domain.Session, action do
 	}
 	prompt := def.Fields[0].PromptText(sess.Language)
 	text := strings.TrimSpace(fmt.Sprintf("%s\n%s", intro, prompt))
-	return s.reply(ctx, sess, text)
+	return s.promptField(ctx, sess, def.Fields[0], text)
+}
+
+func (s *Service) promptField(ctx context.Context, sess *domain.Session, field FormField, text string) error {
+	msg := domain.OutgoingMessage{Text: text}
+	if field.Contact {
+		msg.Keyboard = s.contactKeyboard(sess)
+	}
+	return s.replyMessage(ctx, sess, msg)
 }
 
-func (s *Service) handleFormInput(ctx context.Context, sess *domain.Session, input string) error {
+func (s *Service) handleFormInput(ctx context.Context, sess *domain.Session, upd domain.Update) error {
 	pa := sess.PendingAction
 	if pa == nil {
 		return nil
@@ -180,31 +203,46 @@ func (s *Service) handleFormInput(ctx context.Context, sess *domain.Session, inp
 	def, ok := s.forms[pa.ID]
 	if !ok {
 		sess.PendingAction = nil
-		s.saveSession(sess)
 		return s.reply(ctx, sess, s.t(sess.Language, "Форма недоступна.", "Form is no longer available."))
 	}
 	field := def.Fields[pa.Step]
-	if input == "" && !field.Optional {
-		return s.reply(ctx, sess, s.t(sess.Language, "Поле не может быть пустым.", "This field cannot be empty."))
-	}
-	if input == "" && field.Optional {
+	input := strings.TrimSpace(upd.Text)
+	switch {
+	case field.Contact && field.Optional && upd.Contact == nil && input == skipInput:
+		pa.Data[field.Key] = ""
+	case field.Contact:
+		phone, problem := s.contactPhone(sess, upd)
+		if problem != "" {
+			return s.promptField(ctx, sess, field, problem)
+		}
+		pa.Data[field.Key] = phone
+	case field.Upload != nil && field.Optional && len(upd.Attachments) == 0:
 		pa.Data[field.Key] = ""
-	} else {
+	case field.Upload != nil:
+		att, problem := s.pickUpload(sess, *field.Upload, upd.Attachments)
+		if problem != "" {
+			return s.reply(ctx, sess, problem)
+		}
+		storeUpload(pa.Data, field.Key, att)
+	case input == "" && !field.Optional:
+		return s.reply(ctx, sess, s.t(sess.Language, "Поле не может быть пустым.", "This field cannot be empty."))
+	default:
 		pa.Data[field.Key] = input
 	}
 	pa.Step++
 	if pa.Step >= len(def.Fields) {
 		sess.PendingAction = nil
-		s.saveSession(sess)
 		msg, err := def.OnSubmit(ctx, s, sess, pa.Data)
+		if text, ok := s.unavailableText(sess.Language, err); ok {
+			return s.reply(ctx, sess, text)
+		}
 		if err != nil {
 			return s.reply(ctx, sess, s.t(sess.Language, "Не удалось обработать форму. Попробуйте позже.", "Failed to submit form, please try again later."))
 		}
 		return s.replyMessage(ctx, sess, msg)
 	}
-	s.saveSession(sess)
-	nextPrompt := def.Fields[pa.Step].PromptText(sess.Language)
-	return s.reply(ctx, sess, nextPrompt)
+	next := def.Fields[pa.Step]
+	return s.promptField(ctx, sess, next, next.PromptText(sess.Language))
 }
 
 // --- Form submit helpers ---
@@ -271,7 +309,7 @@ func submitDormMaintenance(ctx context.Context, s *Service, sess *domain.Session
 	if sess.Profile == nil || sess.Profile.ID == 0 {
 		return messageError(sess.Language, "Авторизуйтесь как студент.", "Please login as a student."), nil
 	}
-	reqID, err := s.backend.CreateDormMaintenance(ctx, sess.Profile.ID, data["type"], data["details"])
+	reqID, err := s.backend.CreateDormMaintenance(ctx, sess.Profile.ID, data["type"], data["details"], data["photo"])
 	if err != nil {
 		return domain.OutgoingMessage{}, err
 	}
@@ -451,6 +489,32 @@ func submitAdmissionEventBooking(ctx context.Context, s *Service, sess *domain.S
 		fmt.Sprintf("✅ Your seat is booked! Booking ID: %d\n\nConfirmation sent to %s", bookingID, email)), nil
 }
 
+func submitAdmissionDocument(ctx context.Context, s *Service, sess *domain.Session, data map[string]string) (domain.OutgoingMessage, error) {
+	name := strings.TrimSpace(data["name"])
+	email := strings.TrimSpace(data["email"])
+	if name == "" || email == "" {
+		return messageError(sess.Language, "Имя и email обязательны.", "Name and email are required."), nil
+	}
+	appID := sess.AdmissionApplicationID
+	if appID == 0 || !strings.EqualFold(sess.AdmissionEmail, email) {
+		var err error
+		appID, err = s.backend.SubmitAdmissionApplication(ctx, name, email, nil, map[string]any{"source": "bot"})
+		if err != nil {
+			return domain.OutgoingMessage{}, err
+		}
+		// Later documents from this chat go to the same application.
+		sess.AdmissionApplicationID = appID
+		sess.AdmissionEmail = email
+	}
+	docID, err := s.backend.UploadAdmissionDocument(ctx, appID, data["document"+uploadNameSuffix], data["document"+uploadMIMESuffix], data["document"])
+	if err != nil {
+		return domain.OutgoingMessage{}, err
+	}
+	return messageSuccess(sess.Language,
+		fmt.Sprintf("✅ Документ «%s» получен (заявка #%d, документ #%d).", data["document"+uploadNameSuffix], appID, docID),
+		fmt.Sprintf("✅ Document \"%s\" received (application #%d, document #%d).", data["document"+uploadNameSuffix], appID, docID)), nil
+}
+
 // --- helpers ---
 
 func normalizeDate(val string) (string, error) {
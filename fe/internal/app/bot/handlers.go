@@ -23,11 +23,6 @@ func (s *Service) handleAction(ctx context.Context, sess *domain.Session, action
 			Text:      fmt.Sprintf("📞 **Приёмная комиссия**\n\n📧 Email: %s\n📱 Телефон: %s\n🏢 Офис: %s", s.cfg.AdmissionsEmail, s.cfg.AdmissionsPhone, s.cfg.AdmissionsOffice),
 			ParseMode: domain.ParseModeMarkdown,
 		}, nil
-	case domain.ActionAdmissionDocuments:
-		return domain.OutgoingMessage{
-			Text:      "📄 **Необходимые документы для поступления:**\n\n• Копия паспорта\n• Предыдущий диплом + транскрипт\n• Результаты ЕГЭ\n• Мотивационное письмо\n• Фото 3x4 (6 шт.)\n\n⚠️ Загрузите PDF-файлы перед записью на подачу документов.",
-			ParseMode: domain.ParseModeMarkdown,
-		}, nil
 	case domain.ActionAdmissionAppointment:
 		return domain.OutgoingMessage{
 			Text: "📅 Используйте форму записи для выбора даты/времени.\nПриносите оригиналы документов в кампус.\n\n🕐 Доступные слоты: Пн–Пт 10:00-17:00.",
@@ -124,10 +119,15 @@ func (s *Service) handleAction(ctx context.Context, sess *domain.Session, action
 		return s.handleVisaMakeApplication(ctx, sess)
 	case domain.ActionViewProfile:
 		return s.handleProfile(sess), nil
+	case domain.ActionSwitchRole:
+		return s.handleRoleSwitcher(sess), nil
+	case domain.ActionSecurityOverview:
+		return s.handleSecurityOverview(sess), nil
+	case domain.ActionSignOutOthers:
+		return s.handleSignOutOthers(ctx, sess), nil
 	case domain.ActionToggleNotifications:
-		sess.NotificationsEnabled = !sess.NotificationsEnabled
-		s.saveSession(sess)
-		if sess.NotificationsEnabled {
+		sess.NotificationsDisabled = !sess.NotificationsDisabled
+		if !sess.NotificationsDisabled {
 			return domain.OutgoingMessage{Text: s.t(sess.Language, "🔔 Уведомления включены!", "🔔 Notifications enabled!")}, nil
 		}
 		return domain.OutgoingMessage{Text: s.t(sess.Language, "🔕 Уведомления отключены.", "🔕 Notifications disabled.")}, nil
@@ -385,7 +385,7 @@ func (s *Service) handlePersonalEvents(ctx context.Context, sess *domain.Session
 		kb.Rows = append(kb.Rows, []domain.KeyboardButton{btn})
 	}
 	return domain.OutgoingMessage{
-		Text:    "Your registrations (click to cancel):",
+		Text:     "Your registrations (click to cancel):",
 		Keyboard: kb,
 	}, nil
 }
@@ -420,7 +420,7 @@ func (s *Service) handleEventRegistration(ctx context.Context, sess *domain.Sess
 		kb.Rows = append(kb.Rows, []domain.KeyboardButton{btn})
 	}
 	return domain.OutgoingMessage{
-		Text:    "Select an event to register:",
+		Text:     "Select an event to register:",
 		Keyboard: kb,
 	}, nil
 }
@@ -524,7 +524,7 @@ func (s *Service) handleProfile(sess *domain.Session) domain.OutgoingMessage {
 		emptyFallback(p.NameRU, "—"),
 		emptyFallback(p.NameEN, "—"),
 		p.Email,
-		p.Role,
+		s.profileRoles(sess),
 		emptyFallback(p.Faculty, "—"),
 		emptyFallback(p.DormRoom, "—"),
 	)
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"context"
+	"errors"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+	"github.com/escalopa/inno-vkode/internal/state"
+)
+
+// restart begins the conversation anew, as an explicit /start does. The
+// deep-link payload, if any, is kept on the session.
+func (s *Service) restart(ctx context.Context, sess *domain.Session, payload string) error {
+	clearSessionAuth(sess)
+	sess.Stage = domain.StageSelectLanguage
+	sess.StartPayload = payload
+	if payload != "" {
+		s.log.Info().Int64("chat_id", sess.ChatID).Str("payload", payload).Msg("bot started from deep link")
+	}
+	return s.sendLanguagePrompt(ctx, sess, true)
+}
+
+// started handles the platform's Start event: opening the bot again, a deep
+// link, or coming back after blocking it. A signed-in user stays signed in and
+// gets the main menu; only guests start over.
+func (s *Service) started(ctx context.Context, sess *domain.Session, payload string) error {
+	if sess.Profile == nil {
+		return s.restart(ctx, sess, payload)
+	}
+	if payload != "" {
+		sess.StartPayload = payload
+		s.log.Info().Int64("chat_id", sess.ChatID).Str("payload", payload).Msg("bot started from deep link")
+	}
+	sess.Stage = domain.StageMainMenu
+	sess.PendingAction = nil
+	sess.PendingOTP = nil
+	if err := s.reply(ctx, sess, s.t(sess.Language, "👋 С возвращением! Вы по-прежнему в своём аккаунте.", "👋 Welcome back! You are still signed in.")); err != nil {
+		return err
+	}
+	return s.sendCurrentMenu(ctx, sess)
+}
+
+// stopChat handles a chat that blocked or removed the bot. Guest sessions are
+// dropped; signed-in ones are suspended so the user is still signed in when
+// they come back, but the chat gets no notifications until then.
+func (s *Service) stopChat(chatID int64) {
+	sess, ok := s.store.Get(chatID)
+	if !ok {
+		return
+	}
+	if sess.Profile == nil {
+		err := s.store.DeleteVersion(chatID, sess.Version)
+		if err == nil || errors.Is(err, state.ErrSessionNotFound) {
+			s.log.Info().Int64("chat_id", chatID).Msg("bot stopped in chat, guest session deleted")
+			return
+		}
+		// Written meanwhile, possibly by a sign-in: suspend it instead.
+	}
+	_, err := s.store.Update(chatID, func(cur *domain.Session) error {
+		cur.Suspended = true
+		cur.PendingAction = nil
+		cur.PendingOTP = nil
+		cur.MenuMessageID = ""
+		return nil
+	})
+	if err != nil {
+		s.log.Error().Err(err).Int64("chat_id", chatID).Msg("failed to suspend session")
+		return
+	}
+	s.log.Info().Int64("chat_id", chatID).Msg("bot stopped in chat, session suspended")
+}
+
+// resume lifts a suspension once the user writes to the bot again and
+// reports whether it did.
+func (s *Service) resume(sess *domain.Session) bool {
+	if !sess.Suspended {
+		return false
+	}
+	sess.Suspended = false
+	s.log.Info().Int64("chat_id", sess.ChatID).Msg("session resumed")
+	return true
+}
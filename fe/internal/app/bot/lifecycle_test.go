@@ -0,0 +1,68 @@
+package bot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+func TestStartKeepsSignedInUsers(t *testing.T) {
+	tests := []struct {
+		name       string
+		suspended  bool
+		upd        domain.Update
+		wantSigned bool
+	}{
+		{"platform start", false, domain.Update{Type: domain.UpdateTypeStarted, Payload: "open_day"}, true},
+		{"platform start after blocking", true, domain.Update{Type: domain.UpdateTypeStarted}, true},
+		{"restart button after blocking", true, domain.Update{Type: domain.UpdateTypeMessage, Text: "/start"}, true},
+		{"explicit /start", false, domain.Update{Type: domain.UpdateTypeMessage, Text: "/start"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestService(t, nil)
+			ts.signIn(t, 1, domain.UserProfile{ID: 10, Email: "s@univ.ru"})
+			if tt.suspended {
+				ts.stopChat(1)
+			}
+
+			upd := tt.upd
+			upd.ChatID, upd.UserID = 1, 1
+			if _, err := ts.handleUpdate(context.Background(), upd); err != nil {
+				t.Fatalf("handleUpdate: %v", err)
+			}
+
+			sess := ts.session(t, 1)
+			if sess.Suspended {
+				t.Errorf("session still suspended")
+			}
+			if signed := sess.Profile != nil; signed != tt.wantSigned {
+				t.Fatalf("signed in = %v, want %v", signed, tt.wantSigned)
+			}
+			if !tt.wantSigned {
+				if sess.Stage != domain.StageSelectLanguage {
+					t.Errorf("stage = %s, want the language prompt", sess.Stage)
+				}
+				return
+			}
+			if sess.Stage != domain.StageMainMenu || sess.StartPayload != upd.Payload {
+				t.Errorf("stage %s payload %q, want main menu with payload %q", sess.Stage, sess.StartPayload, upd.Payload)
+			}
+			if menu := ts.messenger.last(t, 1); menu.Keyboard == nil {
+				t.Errorf("last message %q has no menu", menu.Text)
+			}
+		})
+	}
+}
+
+func TestStartGreetsGuestsWithLanguagePrompt(t *testing.T) {
+	ts := newTestService(t, nil)
+	if _, err := ts.handleUpdate(context.Background(), domain.Update{Type: domain.UpdateTypeStarted, ChatID: 2, UserID: 2, Payload: "promo"}); err != nil {
+		t.Fatalf("handleUpdate: %v", err)
+	}
+	sess := ts.session(t, 2)
+	if sess.Stage != domain.StageSelectLanguage || sess.StartPayload != "promo" {
+		t.Errorf("stage %s payload %q, want the language prompt with payload promo", sess.Stage, sess.StartPayload)
+	}
+}
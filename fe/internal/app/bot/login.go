@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"context"
+	"strings"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+func (s *Service) loginDomainAllowed(email string) bool {
+	if len(s.cfg.LoginEmailDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	host := email[at+1:]
+	for _, allowed := range s.cfg.LoginEmailDomains {
+		allowed = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(allowed), "@"))
+		if allowed != "" && (host == allowed || strings.HasSuffix(host, "."+allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Service) loginEmailExample() string {
+	for _, d := range s.cfg.LoginEmailDomains {
+		if d = strings.TrimPrefix(strings.TrimSpace(d), "@"); d != "" {
+			return "student@" + d
+		}
+	}
+	return "student@univ.ru"
+}
+
+func (s *Service) promptLoginEmail(ctx context.Context, sess *domain.Session) error {
+	sess.Stage = domain.StageCollectEmail
+	sess.Email = ""
+	sess.PendingOTP = nil
+	example := s.loginEmailExample()
+	return s.reply(ctx, sess, s.t(sess.Language, "📧 Введите ваш университетский email для авторизации:\n\nПример: "+example, "📧 Enter your university email for login:\n\nExample: "+example))
+}
+
+func (s *Service) enterGuestMode(ctx context.Context, sess *domain.Session) error {
+	sess.Role = domain.RoleApplicant
+	sess.Stage = domain.StageMainMenu
+	sess.Email = ""
+	sess.PendingOTP = nil
+	if root := s.menus.Root(sess.Role); root != nil {
+		sess.CurrentMenu = root.ID
+	}
+	greeting := s.t(sess.Language, "🎉 Добро пожаловать в гостевой режим!\n\n👋 Вы можете просматривать информацию о поступлении и общих сервисах.", "🎉 Welcome to guest mode!\n\n👋 You can browse admission info and general services.")
+	if err := s.reply(ctx, sess, greeting); err != nil {
+		return err
+	}
+	return s.sendCurrentMenu(ctx, sess)
+}
+
+func (s *Service) replyUnknownEmail(ctx context.Context, sess *domain.Session) error {
+	s.log.Info().Str("email", sess.Email).Int64("chat_id", sess.ChatID).Msg("login attempt for unknown email")
+	sess.Email = ""
+	return s.replyMessage(ctx, sess, domain.OutgoingMessage{
+		Text: s.t(sess.Language,
+			"🔍 Мы не нашли учётную запись с таким email.\n\nПроверьте адрес или продолжите как гость — в гостевом режиме доступна информация о поступлении и общие сервисы.",
+			"🔍 We couldn't find an account with this email.\n\nCheck the address or continue as a guest to browse admission info and general services."),
+		Keyboard: &domain.Keyboard{
+			Rows: [][]domain.KeyboardButton{
+				{
+					{Label: "✏️ " + s.t(sess.Language, "Другой email", "Another email"), Kind: domain.ButtonKindCallback, Payload: payloadAuthPref + "login", Style: domain.ButtonStylePrimary},
+					{Label: "👤 " + s.t(sess.Language, "Продолжить как гость", "Continue as guest"), Kind: domain.ButtonKindCallback, Payload: payloadAuthPref + "guest", Style: domain.ButtonStyleSecondary},
+				},
+			},
+		},
+	})
+}
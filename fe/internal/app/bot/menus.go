@@ -34,14 +34,16 @@ func (n *MenuNode) DescriptionText(lang domain.Language) string {
 }
 
 type MenuRegistry struct {
-	nodes map[string]*MenuNode
-	roots map[domain.Role]*MenuNode
+	nodes  map[string]*MenuNode
+	roots  map[domain.Role]*MenuNode
+	owners map[string]domain.Role
 }
 
 func buildMenuRegistry() *MenuRegistry {
 	reg := &MenuRegistry{
-		nodes: make(map[string]*MenuNode),
-		roots: make(map[domain.Role]*MenuNode),
+		nodes:  make(map[string]*MenuNode),
+		roots:  make(map[domain.Role]*MenuNode),
+		owners: make(map[string]domain.Role),
 	}
 	reg.registerRoot(domain.RoleApplicant, applicantMenu())
 	reg.registerRoot(domain.RoleStudent, studentMenu())
@@ -54,18 +56,19 @@ func (r *MenuRegistry) registerRoot(role domain.Role, root *MenuNode) {
 	if root == nil {
 		return
 	}
-	r.walk(root, "")
+	r.walk(root, "", role)
 	r.roots[role] = root
 }
 
-func (r *MenuRegistry) walk(node *MenuNode, parentID string) {
+func (r *MenuRegistry) walk(node *MenuNode, parentID string, role domain.Role) {
 	if node == nil {
 		return
 	}
 	node.ParentID = parentID
 	r.nodes[node.ID] = node
+	r.owners[node.ID] = role
 	for _, child := range node.Children {
-		r.walk(child, node.ID)
+		r.walk(child, node.ID, role)
 	}
 }
 
@@ -77,6 +80,12 @@ func (r *MenuRegistry) Node(id string) *MenuNode {
 	return r.nodes[id]
 }
 
+// Owner returns the role whose root menu contains the node.
+func (r *MenuRegistry) Owner(id string) (domain.Role, bool) {
+	role, ok := r.owners[id]
+	return role, ok
+}
+
 func applicantMenu() *MenuNode {
 	return menuNode("applicant.root", l("🏠 Главное меню", "🏠 Main menu"), l("🎓 Гостевой режим для абитуриентов и гостей университета.", "🎓 Guest mode for applicants and university guests."), "", []*MenuNode{
 		menuNode("applicant.admission", l("📚 Поступление", "📚 Admission"), l("Информация о программах и мероприятиях.", "Programs, open days and campus tours."), "", []*MenuNode{
@@ -91,6 +100,16 @@ func applicantMenu() *MenuNode {
 			actionNode("applicant.documents.appointment", l("Записаться на подачу", "Book submission slot"), domain.ActionAdmissionAppointment),
 		}),
 		actionNode("applicant.language", l("🌐 Язык", "🌐 Language"), domain.ActionSwitchLanguage),
+		menuNode("applicant.settings", l("⚙️ Настройки", "⚙️ Settings"), nil, "", []*MenuNode{
+			actionNode("applicant.settings.profile", l("👤 Профиль", "👤 Profile"), domain.ActionViewProfile),
+			actionNode("applicant.settings.role", l("🔄 Сменить роль", "🔄 Switch role"), domain.ActionSwitchRole),
+			actionNode("applicant.settings.notifications", l("🔔 Уведомления", "🔔 Notifications"), domain.ActionToggleNotifications),
+			menuNode("applicant.settings.security", l("🔐 Безопасность", "🔐 Security"), l("Активные сеансы и выход из аккаунта.", "Active sessions and sign-out."), "", []*MenuNode{
+				actionNode("applicant.settings.security.sessions", l("📱 Активные сеансы", "📱 Active sessions"), domain.ActionSecurityOverview),
+				actionNode("applicant.settings.security.sign_out_others", l("🚪 Выйти на других устройствах", "🚪 Sign out other chats"), domain.ActionSignOutOthers),
+				actionNode("applicant.settings.security.logout", l("🔓 Выйти", "🔓 Log out"), domain.ActionLogout),
+			}),
+		}),
 	})
 }
 
@@ -135,7 +154,13 @@ func studentMenu() *MenuNode {
 		menuNode("student.settings", l("⚙️ Настройки", "⚙️ Settings"), nil, "", []*MenuNode{
 			actionNode("student.settings.profile", l("👤 Профиль", "👤 Profile"), domain.ActionViewProfile),
 			actionNode("student.settings.language", l("🌐 Язык", "🌐 Language"), domain.ActionSwitchLanguage),
+			actionNode("student.settings.role", l("🔄 Сменить роль", "🔄 Switch role"), domain.ActionSwitchRole),
 			actionNode("student.settings.notifications", l("🔔 Уведомления", "🔔 Notifications"), domain.ActionToggleNotifications),
+			menuNode("student.settings.security", l("🔐 Безопасность", "🔐 Security"), l("Активные сеансы и выход из аккаунта.", "Active sessions and sign-out."), "", []*MenuNode{
+				actionNode("student.settings.security.sessions", l("📱 Активные сеансы", "📱 Active sessions"), domain.ActionSecurityOverview),
+				actionNode("student.settings.security.sign_out_others", l("🚪 Выйти на других устройствах", "🚪 Sign out other chats"), domain.ActionSignOutOthers),
+				actionNode("student.settings.security.logout", l("🔓 Выйти", "🔓 Log out"), domain.ActionLogout),
+			}),
 		}),
 		menuNode("student.support", l("ℹ️ Поддержка", "ℹ️ Support"), nil, "", []*MenuNode{
 			actionNode("student.support.faq", l("❓ FAQ / AI", "❓ FAQ / AI"), domain.ActionFAQ),
@@ -170,10 +195,17 @@ func employeeMenu() *MenuNode {
 			actionNode("employee.visa.status", l("📋 Статус", "📋 Status"), domain.ActionVisaStatus),
 			actionNode("employee.visa.make_application", l("📝 Сделать заявку", "📝 Make application"), domain.ActionVisaMakeApplication),
 		}),
+		actionNode("employee.broadcast", l("📣 Рассылка", "📣 Broadcast"), domain.ActionBroadcast),
 		menuNode("employee.settings", l("⚙️ Настройки", "⚙️ Settings"), nil, "", []*MenuNode{
 			actionNode("employee.settings.profile", l("👤 Профиль", "👤 Profile"), domain.ActionViewProfile),
 			actionNode("employee.settings.language", l("🌐 Язык", "🌐 Language"), domain.ActionSwitchLanguage),
+			actionNode("employee.settings.role", l("🔄 Сменить роль", "🔄 Switch role"), domain.ActionSwitchRole),
 			actionNode("employee.settings.notifications", l("🔔 Уведомления", "🔔 Notifications"), domain.ActionToggleNotifications),
+			menuNode("employee.settings.security", l("🔐 Безопасность", "🔐 Security"), l("Активные сеансы и выход из аккаунта.", "Active sessions and sign-out."), "", []*MenuNode{
+				actionNode("employee.settings.security.sessions", l("📱 Активные сеансы", "📱 Active sessions"), domain.ActionSecurityOverview),
+				actionNode("employee.settings.security.sign_out_others", l("🚪 Выйти на других устройствах", "🚪 Sign out other chats"), domain.ActionSignOutOthers),
+				actionNode("employee.settings.security.logout", l("🔓 Выйти", "🔓 Log out"), domain.ActionLogout),
+			}),
 		}),
 		menuNode("employee.support", l("ℹ️ Поддержка", "ℹ️ Support"), nil, "", []*MenuNode{
 			actionNode("employee.support.faq", l("❓ FAQ / AI", "❓ FAQ / AI"), domain.ActionFAQ),
@@ -198,10 +230,17 @@ func leadershipMenu() *MenuNode {
 			actionNode("leadership.ai.summary", l("📝 Executive summary", "📝 Executive summary"), domain.ActionAISummary),
 			actionNode("leadership.ai.transcribe", l("🎧 Транскрибация", "🎧 Transcription"), domain.ActionAITranscription),
 		}),
+		actionNode("leadership.broadcast", l("📣 Рассылка", "📣 Broadcast"), domain.ActionBroadcast),
 		menuNode("leadership.settings", l("⚙️ Настройки", "⚙️ Settings"), nil, "", []*MenuNode{
 			actionNode("leadership.settings.profile", l("👤 Профиль", "👤 Profile"), domain.ActionViewProfile),
 			actionNode("leadership.settings.language", l("🌐 Язык", "🌐 Language"), domain.ActionSwitchLanguage),
+			actionNode("leadership.settings.role", l("🔄 Сменить роль", "🔄 Switch role"), domain.ActionSwitchRole),
 			actionNode("leadership.settings.notifications", l("🔔 Уведомления", "🔔 Notifications"), domain.ActionToggleNotifications),
+			menuNode("leadership.settings.security", l("🔐 Безопасность", "🔐 Security"), l("Активные сеансы и выход из аккаунта.", "Active sessions and sign-out."), "", []*MenuNode{
+				actionNode("leadership.settings.security.sessions", l("📱 Активные сеансы", "📱 Active sessions"), domain.ActionSecurityOverview),
+				actionNode("leadership.settings.security.sign_out_others", l("🚪 Выйти на других устройствах", "🚪 Sign out other chats"), domain.ActionSignOutOthers),
+				actionNode("leadership.settings.security.logout", l("🔓 Выйти", "🔓 Log out"), domain.ActionLogout),
+			}),
 		}),
 		menuNode("leadership.support", l("ℹ️ Поддержка", "ℹ️ Support"), nil, "", []*MenuNode{
 			actionNode("leadership.support.contact", l("📨 Обратиться", "📨 Contact support"), domain.ActionContactSupport),
@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+	"github.com/escalopa/inno-vkode/internal/state"
+)
+
+const payloadOTPResend = "otp:resend"
+
+// otpLimiter counts failed OTP attempts per email across sessions so that
+// restarting the flow from another chat, or reaching another replica, does
+// not reset the budget. Store errors are logged and let the attempt through:
+// the per-code attempt limit still applies.
+type otpLimiter struct {
+	store       state.OTPFailureStore
+	log         zerolog.Logger
+	maxAttempts int
+	lockout     time.Duration
+}
+
+func newOTPLimiter(store state.OTPFailureStore, maxAttempts int, lockout time.Duration, log zerolog.Logger) *otpLimiter {
+	return &otpLimiter{
+		store:       store,
+		log:         log,
+		maxAttempts: maxAttempts,
+		lockout:     lockout,
+	}
+}
+
+func (l *otpLimiter) lockedUntil(email string, now time.Time) (time.Time, bool) {
+	e, err := l.store.OTPFailures(email)
+	if err != nil {
+		l.log.Error().Err(err).Str("email", email).Msg("failed to load otp failures")
+		return time.Time{}, false
+	}
+	if now.Before(e.LockedUntil) {
+		return e.LockedUntil, true
+	}
+	return time.Time{}, false
+}
+
+// fail records a failed attempt and reports whether the email is now locked.
+func (l *otpLimiter) fail(email string, now time.Time) bool {
+	e, err := l.store.UpdateOTPFailures(email, func(e domain.OTPFailures) domain.OTPFailures {
+		if now.Sub(e.LastFailure) > l.lockout {
+			e = domain.OTPFailures{LastSent: e.LastSent}
+		}
+		e.Count++
+		e.LastFailure = now
+		if l.maxAttempts > 0 && e.Count >= l.maxAttempts {
+			e.LockedUntil = now.Add(l.lockout)
+		}
+		return e
+	})
+	if err != nil {
+		l.log.Error().Err(err).Str("email", email).Msg("failed to record otp failure")
+		return false
+	}
+	return now.Before(e.LockedUntil)
+}
+
+// claimSend records a code sent to email at now unless one was sent less
+// than cooldown ago, in which case it returns how long to wait.
+func (l *otpLimiter) claimSend(email string, now time.Time, cooldown time.Duration) time.Duration {
+	var wait time.Duration
+	_, err := l.store.UpdateOTPFailures(email, func(e domain.OTPFailures) domain.OTPFailures {
+		wait = 0
+		if next := e.LastSent.Add(cooldown); now.Before(next) {
+			wait = next.Sub(now)
+			return e
+		}
+		e.LastSent = now
+		return e
+	})
+	if err != nil {
+		l.log.Error().Err(err).Str("email", email).Msg("failed to record otp send")
+		return 0
+	}
+	return wait
+}
+
+// reset forgets the failures; the last send time stays for the cooldown.
+func (l *otpLimiter) reset(email string) {
+	_, err := l.store.UpdateOTPFailures(email, func(e domain.OTPFailures) domain.OTPFailures {
+		return domain.OTPFailures{LastSent: e.LastSent}
+	})
+	if err != nil {
+		l.log.Error().Err(err).Str("email", email).Msg("failed to reset otp failures")
+	}
+}
+
+// hashOTP keys the digest with a server secret: a leaked session store alone
+// is not enough to brute-force the few million possible codes offline.
+func (s *Service) hashOTP(salt, code string) string {
+	mac := hmac.New(sha256.New, s.otpKey)
+	mac.Write([]byte(salt + ":" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Service) issueOTP(sess *domain.Session) string {
+	code := s.generateOTP()
+	saltRaw := make([]byte, 16)
+	if _, err := rand.Read(saltRaw); err != nil {
+		s.log.Error().Err(err).Msg("failed to generate otp salt")
+	}
+	salt := hex.EncodeToString(saltRaw)
+	now := s.now()
+	sess.PendingOTP = &domain.PendingOTP{
+		Email:     sess.Email,
+		CodeHash:  s.hashOTP(salt, code),
+		Salt:      salt,
+		SentAt:    now,
+		ExpiresAt: now.Add(s.otpExpiry),
+	}
+	return code
+}
+
+func (s *Service) verifyOTP(otp *domain.PendingOTP, input string) bool {
+	got := s.hashOTP(otp.Salt, input)
+	return subtle.ConstantTimeCompare([]byte(got), []byte(otp.CodeHash)) == 1
+}
+
+// sendOTP mails a new code unless one went to the same address less than
+// OTP_RESEND_COOLDOWN ago, from this chat or any other. A code already sent
+// to that address from this chat stays valid meanwhile.
+func (s *Service) sendOTP(ctx context.Context, sess *domain.Session) error {
+	if wait := s.otpLimiter.claimSend(sess.Email, s.now(), s.cfg.OTPResendCooldown); wait > 0 {
+		seconds := max(int(wait.Round(time.Second).Seconds()), 1)
+		text := s.t(sess.Language,
+			fmt.Sprintf("⏳ Код на этот адрес уже отправлен. Новый можно запросить через %d сек.", seconds),
+			fmt.Sprintf("⏳ A code was already sent to this address. You can request a new one in %d s.", seconds))
+		if sess.PendingOTP == nil || sess.PendingOTP.Email != sess.Email {
+			sess.PendingOTP = nil
+			sess.Stage = domain.StageCollectEmail
+			return s.reply(ctx, sess, text)
+		}
+		sess.Stage = domain.StageAwaitOTP
+		return s.replyMessage(ctx, sess, domain.OutgoingMessage{Text: text, Keyboard: s.otpKeyboard(sess)})
+	}
+	code := s.issueOTP(sess)
+	if err := s.email.SendOTP(ctx, sess.Email, code, sess.Language); err != nil {
+		s.log.Error().Err(err).Str("email", sess.Email).Msg("failed to send otp")
+		sess.PendingOTP = nil
+		sess.Stage = domain.StageCollectEmail
+		return s.reply(ctx, sess, s.t(sess.Language, "⚠️ Не удалось отправить письмо с кодом. Попробуйте ещё раз чуть позже или введите другой email:", "⚠️ We couldn't send the code email. Please try again a bit later or enter another email:"))
+	}
+	sess.Stage = domain.StageAwaitOTP
+	return s.replyMessage(ctx, sess, domain.OutgoingMessage{
+		Text:     s.t(sess.Language, "🔐 Мы отправили 6-значный код подтверждения на вашу почту!\n\n📨 Проверьте папку \"Входящие\" и введите код:", "🔐 We sent a 6-digit verification code to your email!\n\n📨 Check your inbox and enter the code:"),
+		Keyboard: s.otpKeyboard(sess),
+	})
+}
+
+func (s *Service) otpKeyboard(sess *domain.Session) *domain.Keyboard {
+	return &domain.Keyboard{
+		Rows: [][]domain.KeyboardButton{
+			{{Label: s.t(sess.Language, "🔁 Отправить код повторно", "🔁 Resend code"), Kind: domain.ButtonKindCallback, Payload: payloadOTPResend, Style: domain.ButtonStyleSecondary}},
+		},
+	}
+}
+
+func (s *Service) handleOTPResend(ctx context.Context, sess *domain.Session) error {
+	if until, locked := s.otpLimiter.lockedUntil(sess.Email, s.now()); locked {
+		return s.replyOTPLocked(ctx, sess, until)
+	}
+	return s.sendOTP(ctx, sess)
+}
+
+func (s *Service) replyOTPLocked(ctx context.Context, sess *domain.Session, until time.Time) error {
+	sess.PendingOTP = nil
+	sess.Stage = domain.StageChooseAuthMode
+	minutes := int(until.Sub(s.now()).Round(time.Minute).Minutes())
+	if minutes < 1 {
+		minutes = 1
+	}
+	return s.reply(ctx, sess, s.t(sess.Language,
+		fmt.Sprintf("🔒 Слишком много неверных попыток. Вход для этого email заблокирован на %d мин.", minutes),
+		fmt.Sprintf("🔒 Too many failed attempts. Login for this email is locked for %d min.", minutes)))
+}
@@ -0,0 +1,105 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/config"
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+func TestOTPLimiterIsSharedThroughStore(t *testing.T) {
+	cfg := &config.Config{OTPMaxAttempts: 3, OTPLockout: time.Minute}
+	a := newTestService(t, cfg)
+	b := New(cfg, zerolog.Nop(), a.backend, a.messenger, nil, a.store)
+
+	now := time.Now()
+	const email = "s@univ.ru"
+	a.otpLimiter.fail(email, now)
+	b.otpLimiter.fail(email, now)
+	if _, locked := a.otpLimiter.lockedUntil(email, now); locked {
+		t.Fatalf("locked after 2 of 3 attempts")
+	}
+	if !a.otpLimiter.fail(email, now) {
+		t.Fatalf("third failure did not lock the email")
+	}
+	if _, locked := b.otpLimiter.lockedUntil(email, now); !locked {
+		t.Fatalf("other replica does not see the lock")
+	}
+	if _, locked := b.otpLimiter.lockedUntil(email, now.Add(2*time.Minute)); locked {
+		t.Fatalf("lock outlived OTP_LOCKOUT")
+	}
+
+	b.otpLimiter.reset(email)
+	if _, locked := a.otpLimiter.lockedUntil(email, now); locked {
+		t.Fatalf("still locked after reset")
+	}
+}
+
+func TestOTPHashIsKeyedWithSecret(t *testing.T) {
+	a := newTestService(t, &config.Config{OTPSecret: "one"})
+	same := newTestService(t, &config.Config{OTPSecret: "one"})
+	other := newTestService(t, &config.Config{OTPSecret: "two"})
+
+	sess := &domain.Session{}
+	code := a.issueOTP(sess)
+	if !same.verifyOTP(sess.PendingOTP, code) {
+		t.Errorf("replica with the same OTP_SECRET rejects the code")
+	}
+	if other.verifyOTP(sess.PendingOTP, code) {
+		t.Errorf("code verified with another OTP_SECRET")
+	}
+	if a.verifyOTP(sess.PendingOTP, code+"0") {
+		t.Errorf("wrong code verified")
+	}
+}
+
+func TestOTPResendCooldownAppliesToEveryPath(t *testing.T) {
+	cfg := &config.Config{OTPMaxAttempts: 3, OTPLockout: time.Minute, OTPResendCooldown: time.Minute}
+	ts := newTestService(t, cfg)
+	now := time.Now()
+	ts.now = func() time.Time { return now }
+	const email = "victim@univ.ru"
+	for _, chatID := range []int64{1, 2} {
+		if err := ts.store.Save(&domain.Session{ChatID: chatID, UserID: chatID, Language: domain.LanguageEN, Stage: domain.StageChooseAuthMode}); err != nil {
+			t.Fatalf("save session: %v", err)
+		}
+	}
+
+	ts.write(t, 1, "login")
+	ts.write(t, 1, email)
+	if got := ts.email.count(); got != 1 {
+		t.Fatalf("sent %d codes, want 1", got)
+	}
+
+	// Back to the login prompt and the same address again.
+	if _, err := ts.store.Update(1, func(sess *domain.Session) error {
+		sess.Stage = domain.StageChooseAuthMode
+		return nil
+	}); err != nil {
+		t.Fatalf("update session: %v", err)
+	}
+	ts.write(t, 1, "login")
+	ts.write(t, 1, email)
+	// Another chat asking for the same address.
+	ts.write(t, 2, "login")
+	ts.write(t, 2, email)
+	if got := ts.email.count(); got != 1 {
+		t.Fatalf("sent %d codes within the cooldown, want 1", got)
+	}
+	if last := ts.messenger.last(t, 2); !strings.Contains(last.Text, "already sent") {
+		t.Errorf("reply %q does not mention the cooldown", last.Text)
+	}
+	if sess := ts.session(t, 2); sess.Stage != domain.StageCollectEmail || sess.PendingOTP != nil {
+		t.Errorf("chat 2 stage %s with pending code %v, want to be asked for an email again", sess.Stage, sess.PendingOTP != nil)
+	}
+
+	now = now.Add(2 * time.Minute)
+	ts.write(t, 2, email)
+	if got := ts.email.count(); got != 2 {
+		t.Fatalf("sent %d codes after the cooldown, want 2", got)
+	}
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"context"
+	"strings"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+var roleTitles = map[domain.Role]map[domain.Language]string{
+	domain.RoleApplicant:  l("🎓 Абитуриент", "🎓 Applicant"),
+	domain.RoleStudent:    l("📚 Студент", "📚 Student"),
+	domain.RoleEmployee:   l("💼 Сотрудник", "💼 Employee"),
+	domain.RoleLeadership: l("👔 Руководство", "👔 Leadership"),
+}
+
+func (s *Service) roleTitle(lang domain.Language, role domain.Role) string {
+	if titles, ok := roleTitles[role]; ok {
+		return s.t(lang, titles[domain.LanguageRU], titles[domain.LanguageEN])
+	}
+	return string(role)
+}
+
+func (s *Service) handleRoleSwitcher(sess *domain.Session) domain.OutgoingMessage {
+	roles := sess.Profile.AvailableRoles()
+	if len(roles) < 2 {
+		return domain.OutgoingMessage{Text: s.t(sess.Language, "У вашей учётной записи только одна роль.", "Your account has a single role.")}
+	}
+	kb := &domain.Keyboard{}
+	for _, role := range roles {
+		label := s.roleTitle(sess.Language, role)
+		style := domain.ButtonStylePrimary
+		if role == sess.Role {
+			label = "✅ " + label
+			style = domain.ButtonStyleSecondary
+		}
+		kb.Rows = append(kb.Rows, []domain.KeyboardButton{{
+			Label:   label,
+			Kind:    domain.ButtonKindCallback,
+			Payload: payloadRolePref + string(role),
+			Style:   style,
+		}})
+	}
+	return domain.OutgoingMessage{
+		Text:     s.t(sess.Language, "🔄 Выберите роль, от имени которой продолжить работу:", "🔄 Choose the role you want to continue as:"),
+		Keyboard: kb,
+	}
+}
+
+func (s *Service) switchRole(ctx context.Context, sess *domain.Session, role domain.Role) error {
+	if sess.Profile == nil || !sess.Profile.HasRole(role) {
+		s.logDenied(sess, "role", string(role))
+		return s.replyForbidden(ctx, sess)
+	}
+	root := s.menus.Root(role)
+	if root == nil {
+		return s.replyForbidden(ctx, sess)
+	}
+	sess.Role = role
+	sess.CurrentMenu = root.ID
+	sess.PendingAction = nil
+	sess.PendingEventID = 0
+	sess.PendingVisaApplicationID = 0
+	s.log.Info().Int64("chat_id", sess.ChatID).Str("role", string(role)).Msg("active role switched")
+	text := s.t(sess.Language, "Вы работаете как: ", "You are now acting as: ") + s.roleTitle(sess.Language, role)
+	if err := s.reply(ctx, sess, text); err != nil {
+		return err
+	}
+	return s.sendCurrentMenu(ctx, sess)
+}
+
+func (s *Service) profileRoles(sess *domain.Session) string {
+	roles := sess.Profile.AvailableRoles()
+	parts := make([]string, 0, len(roles))
+	for _, role := range roles {
+		part := string(role)
+		if role == sess.Role && len(roles) > 1 {
+			part += " ✅"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,116 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+const sessionTimeLayout = "02.01.2006 15:04"
+
+var errNotSignedIn = errors.New("session is not signed in to the account")
+
+func (s *Service) logout(ctx context.Context, sess *domain.Session) error {
+	if sess.Profile == nil {
+		return s.reply(ctx, sess, s.t(sess.Language, "Вы не вошли в аккаунт.", "You are not signed in."))
+	}
+	s.log.Info().Int64("chat_id", sess.ChatID).Str("email", sess.Profile.Email).Msg("user logged out")
+	clearSessionAuth(sess)
+	sess.Stage = domain.StageChooseAuthMode
+	if err := s.reply(ctx, sess, s.t(sess.Language, "👋 Вы вышли из аккаунта.", "👋 You have been signed out.")); err != nil {
+		return err
+	}
+	return s.sendAuthModePrompt(ctx, sess)
+}
+
+// accountSessions returns the sessions of other chats signed in with the same
+// email, most recently active first.
+func (s *Service) accountSessions(sess *domain.Session) []*domain.Session {
+	if sess.Profile == nil || sess.Profile.Email == "" {
+		return nil
+	}
+	var others []*domain.Session
+	for _, other := range s.store.All() {
+		if other.ChatID == sess.ChatID || other.Profile == nil {
+			continue
+		}
+		if strings.EqualFold(other.Profile.Email, sess.Profile.Email) {
+			others = append(others, other)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].LastActivity.After(others[j].LastActivity)
+	})
+	return others
+}
+
+func (s *Service) handleSecurityOverview(sess *domain.Session) domain.OutgoingMessage {
+	if sess.Profile == nil {
+		return messageError(sess.Language, "Нужна авторизация.", "Please login first.")
+	}
+	lines := []string{s.t(sess.Language, "🔐 **Активные сеансы**", "🔐 **Active sessions**"), ""}
+	current := s.t(sess.Language, "• Этот чат (%d): вход %s", "• This chat (%d): signed in %s")
+	lines = append(lines, fmt.Sprintf(current, sess.ChatID, formatSessionTime(sess.LoggedInAt)))
+
+	others := s.accountSessions(sess)
+	if len(others) == 0 {
+		lines = append(lines, "", s.t(sess.Language, "Других активных сеансов нет.", "No other active sessions."))
+	} else {
+		last := others[0]
+		lines = append(lines, "", fmt.Sprintf(s.t(sess.Language, "🕒 Последнее использование в другом чате: %s (чат %d)", "🕒 Last used from another chat: %s (chat %d)"), formatSessionTime(last.LastActivity), last.ChatID), "")
+		for _, other := range others {
+			lines = append(lines, fmt.Sprintf(s.t(sess.Language, "• Чат %d: вход %s, активность %s", "• Chat %d: signed in %s, last active %s"),
+				other.ChatID, formatSessionTime(other.LoggedInAt), formatSessionTime(other.LastActivity)))
+		}
+	}
+	return domain.OutgoingMessage{Text: strings.Join(lines, "\n"), ParseMode: domain.ParseModeMarkdown}
+}
+
+func (s *Service) handleSignOutOthers(ctx context.Context, sess *domain.Session) domain.OutgoingMessage {
+	if sess.Profile == nil {
+		return messageError(sess.Language, "Нужна авторизация.", "Please login first.")
+	}
+	email := sess.Profile.Email
+	revoked := 0
+	for _, other := range s.accountSessions(sess) {
+		updated, err := s.store.Update(other.ChatID, func(cur *domain.Session) error {
+			if cur.Profile == nil || !strings.EqualFold(cur.Profile.Email, email) {
+				return errNotSignedIn
+			}
+			clearSessionAuth(cur)
+			return nil
+		})
+		if errors.Is(err, errNotSignedIn) {
+			continue
+		}
+		if err != nil {
+			s.log.Error().Err(err).Int64("chat_id", other.ChatID).Msg("failed to sign out session")
+			continue
+		}
+		revoked++
+		if updated.Suspended {
+			continue
+		}
+		notice := s.t(updated.Language, "🔒 Вы вышли из аккаунта: сеанс завершён с другого устройства. Используйте /start, чтобы войти снова.", "🔒 You were signed out from another device. Use /start to sign in again.")
+		if _, err := s.messenger.Send(ctx, updated.ChatID, updated.UserID, domain.OutgoingMessage{Text: notice}); err != nil {
+			s.log.Warn().Err(err).Int64("chat_id", updated.ChatID).Msg("failed to notify signed out chat")
+		}
+	}
+	s.log.Info().Int64("chat_id", sess.ChatID).Str("email", email).Int("revoked", revoked).Msg("signed out other sessions")
+	if revoked == 0 {
+		return domain.OutgoingMessage{Text: s.t(sess.Language, "Других активных сеансов нет.", "No other active sessions.")}
+	}
+	return domain.OutgoingMessage{Text: fmt.Sprintf(s.t(sess.Language, "✅ Завершено сеансов: %d.", "✅ Signed out %d other session(s)."), revoked)}
+}
+
+func formatSessionTime(t time.Time) string {
+	if t.IsZero() {
+		return "—"
+	}
+	return t.Format(sessionTimeLayout)
+}
@@ -3,9 +3,11 @@ package bot
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -21,6 +23,7 @@ const (
 	payloadActionPref = "act:"
 	payloadLangPref   = "lang:"
 	payloadAuthPref   = "auth:"
+	payloadRolePref   = "role:"
 )
 
 type Service struct {
@@ -30,46 +33,148 @@ type Service struct {
 	messenger ports.Messenger
 	email     ports.EmailSender
 	store     state.Store
+	janitor   *state.Janitor
 
 	menus *MenuRegistry
 	forms map[domain.ActionID]FormDefinition
 
-	now       func() time.Time
-	otpDigits int
-	otpExpiry time.Duration
+	now        func() time.Time
+	otpDigits  int
+	otpExpiry  time.Duration
+	otpLimiter *otpLimiter
+	otpKey     []byte
+
+	callbackKey []byte
+
+	// mu guards runCtx and broadcasts.
+	mu sync.Mutex
+	// runCtx outlives single updates; broadcasts run under it.
+	runCtx context.Context
+	// broadcasts holds the IDs of broadcasts this process is running.
+	broadcasts map[int64]bool
 }
 
 func New(cfg *config.Config, log zerolog.Logger, backend ports.Backend, messenger ports.Messenger, email ports.EmailSender, store state.Store) *Service {
 	s := &Service{
-		cfg:       cfg,
-		log:       log,
-		backend:   backend,
-		messenger: messenger,
-		email:     email,
-		store:     store,
-		menus:     buildMenuRegistry(),
-		now:       time.Now,
-		otpDigits: 6,
-		otpExpiry: cfg.OTPExpiry,
+		cfg:        cfg,
+		log:        log,
+		backend:    backend,
+		messenger:  messenger,
+		email:      email,
+		store:      store,
+		menus:      buildMenuRegistry(),
+		now:        time.Now,
+		otpDigits:  6,
+		otpExpiry:  cfg.OTPExpiry,
+		otpLimiter: newOTPLimiter(store, cfg.OTPMaxAttempts, cfg.OTPLockout, log),
+		runCtx:     context.Background(),
+		broadcasts: make(map[int64]bool),
 	}
 	s.forms = s.buildForms()
+	s.callbackKey = []byte(cfg.CallbackSecret)
+	if len(s.callbackKey) == 0 {
+		s.callbackKey = make([]byte, 32)
+		if _, err := rand.Read(s.callbackKey); err != nil {
+			panic(err)
+		}
+		log.Warn().Msg("CALLBACK_SECRET is not set, using a random key: buttons stop working after restart")
+	}
+	s.otpKey = []byte(cfg.OTPSecret)
+	if len(s.otpKey) == 0 {
+		s.otpKey = make([]byte, 32)
+		if _, err := rand.Read(s.otpKey); err != nil {
+			panic(err)
+		}
+		log.Warn().Msg("OTP_SECRET is not set, using a random key: codes sent before a restart stop working")
+	}
+	if err := validateMenuPolicy(s.menus); err != nil {
+		panic(err)
+	}
+	s.janitor = state.NewJanitor(store, state.JanitorConfig{
+		Interval: cfg.JanitorInterval,
+		FormTTL:  cfg.FormTTL,
+		GuestTTL: cfg.GuestSessionTTL,
+	}, s.now, log)
+	if cfg.NotifyExpiry {
+		s.janitor.OnExpire(s.notifyExpired)
+	}
 	return s
 }
 
 func (s *Service) Start(ctx context.Context) error {
 	s.log.Info().Msg("starting MAX bot service")
+	s.mu.Lock()
+	s.runCtx = ctx
+	s.mu.Unlock()
+	go func() {
+		if err := s.janitor.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			s.log.Error().Err(err).Msg("session janitor stopped")
+		}
+	}()
+	go s.resumeBroadcasts(ctx)
 	return s.messenger.Start(ctx, s.handleUpdate)
 }
 
-func (s *Service) handleUpdate(ctx context.Context, upd domain.Update) error {
+func (s *Service) notifyExpired(ctx context.Context, sess *domain.Session, reasons []state.ExpiryReason) {
+	if sess.Suspended {
+		return
+	}
+	for _, reason := range reasons {
+		var text string
+		switch reason {
+		case state.ExpiredForm:
+			text = s.t(sess.Language, "⌛ Время заполнения формы истекло. Начните заново из меню.", "⌛ Your form timed out. Start again from the menu.")
+		case state.ExpiredOTP:
+			text = s.t(sess.Language, "⏰ Код подтверждения истёк. Введите email ещё раз, чтобы получить новый код.", "⏰ Your verification code expired. Enter your email again to get a new code.")
+		default:
+			continue
+		}
+		if _, err := s.messenger.Send(ctx, sess.ChatID, sess.UserID, domain.OutgoingMessage{Text: text}); err != nil {
+			s.log.Warn().Err(err).Int64("chat_id", sess.ChatID).Msg("failed to send expiry notice")
+		}
+	}
+}
+
+func (s *Service) handleUpdate(ctx context.Context, upd domain.Update) (domain.CallbackAnswer, error) {
 	if upd.ChatID == 0 {
-		return nil
+		return domain.CallbackAnswer{}, nil
+	}
+	if upd.Type == domain.UpdateTypeStopped {
+		s.stopChat(upd.ChatID)
+		return domain.CallbackAnswer{}, nil
 	}
 	sess := s.ensureSession(upd.ChatID)
+	base := sess.Clone()
+	defer s.commitSession(base, sess)
 	if upd.UserID != 0 {
 		sess.UserID = upd.UserID
 	}
+	resumed := s.resume(sess)
+	ctx = domain.WithActor(ctx, actorFor(sess))
+
+	// Coming back after blocking the bot means pressing its Start or Restart
+	// button, which some platforms send as a plain /start; that must not sign
+	// the user out.
+	if resumed && (upd.Type == domain.UpdateTypeStarted || isStartCommand(upd.Text)) {
+		return domain.CallbackAnswer{}, s.started(ctx, sess, upd.Payload)
+	}
+
+	if upd.Type != domain.UpdateTypeCallback {
+		return domain.CallbackAnswer{}, s.routeUpdate(ctx, sess, upd)
+	}
+	ctx, answer := withCallbackAnswer(ctx)
+	err := s.routeUpdate(ctx, sess, upd)
+	if err != nil && answer.Text == "" {
+		if text, ok := s.unavailableText(sess.Language, err); ok {
+			answer.Text = text
+		} else {
+			answer.Text = s.t(sess.Language, "⚠️ Что-то пошло не так. Попробуйте ещё раз.", "⚠️ Something went wrong. Please try again.")
+		}
+	}
+	return *answer, err
+}
 
+func (s *Service) routeUpdate(ctx context.Context, sess *domain.Session, upd domain.Update) error {
 	if handled, err := s.handleGlobalCommands(ctx, sess, upd); handled || err != nil {
 		return err
 	}
@@ -91,27 +196,27 @@ func (s *Service) handleUpdate(ctx context.Context, upd domain.Update) error {
 }
 
 func (s *Service) handleGlobalCommands(ctx context.Context, sess *domain.Session, upd domain.Update) (bool, error) {
+	if upd.Type == domain.UpdateTypeStarted {
+		return true, s.started(ctx, sess, upd.Payload)
+	}
 	text := strings.TrimSpace(strings.ToLower(upd.Text))
 	switch text {
 	case "/start":
-		s.resetSession(sess)
-		sess.Stage = domain.StageSelectLanguage
-		s.saveSession(sess)
-		return true, s.sendLanguagePrompt(ctx, sess, true)
+		return true, s.restart(ctx, sess, "")
 	case "/language":
 		sess.Stage = domain.StageSelectLanguage
 		sess.PendingAction = nil
-		s.saveSession(sess)
 		return true, s.sendLanguagePrompt(ctx, sess, false)
 	case "/help":
 		helpText := s.t(sess.Language,
-			"🆘 **Помощь**\n\n📋 **Команды:**\n• /start - Перезапустить бота\n• /language - Изменить язык\n• /help - Показать эту справку\n• /cancel - Отменить текущее действие\n\n❓ **Часто задаваемые вопросы:**\n• Как войти? Используйте /start и выберите 'Войти'.\n• Забыли пароль? Свяжитесь с поддержкой через меню.\n• Проблемы с ботом? Опишите в '🐞 Сообщить об ошибке'.\n\n💬 Для дополнительной помощи используйте меню 'ℹ️ Поддержка'.",
-			"🆘 **Help**\n\n📋 **Commands:**\n• /start - Restart the bot\n• /language - Change language\n• /help - Show this help\n• /cancel - Cancel current action\n\n❓ **FAQs:**\n• How to login? Use /start and choose 'Login'.\n• Forgot password? Contact support via menu.\n• Bot issues? Report in '🐞 Report issue'.\n\n💬 For more help, use 'ℹ️ Support' menu.")
+			"🆘 **Помощь**\n\n📋 **Команды:**\n• /start - Перезапустить бота\n• /language - Изменить язык\n• /help - Показать эту справку\n• /cancel - Отменить текущее действие\n• /logout - Выйти из аккаунта\n\n❓ **Часто задаваемые вопросы:**\n• Как войти? Используйте /start и выберите 'Войти'.\n• Забыли пароль? Свяжитесь с поддержкой через меню.\n• Проблемы с ботом? Опишите в '🐞 Сообщить об ошибке'.\n\n💬 Для дополнительной помощи используйте меню 'ℹ️ Поддержка'.",
+			"🆘 **Help**\n\n📋 **Commands:**\n• /start - Restart the bot\n• /language - Change language\n• /help - Show this help\n• /cancel - Cancel current action\n• /logout - Sign out\n\n❓ **FAQs:**\n• How to login? Use /start and choose 'Login'.\n• Forgot password? Contact support via menu.\n• Bot issues? Report in '🐞 Report issue'.\n\n💬 For more help, use 'ℹ️ Support' menu.")
 		return true, s.replyMessage(ctx, sess, domain.OutgoingMessage{Text: helpText, ParseMode: domain.ParseModeMarkdown})
+	case "/logout":
+		return true, s.logout(ctx, sess)
 	case "/cancel", "cancel", "отмена":
 		if sess.PendingAction != nil {
 			sess.PendingAction = nil
-			s.saveSession(sess)
 			return true, s.reply(ctx, sess, s.t(sess.Language, "🚫 Действие отменено.", "🚫 Action cancelled."))
 		}
 	}
@@ -141,7 +246,6 @@ func (s *Service) handleLanguageSelection(ctx context.Context, sess *domain.Sess
 		sess.PendingAction = nil
 		sess.PendingEventID = 0
 		sess.PendingVisaApplicationID = 0
-		s.saveSession(sess)
 		greeting := s.t(sess.Language, "🌐 Язык интерфейса изменён!", "🌐 Interface language changed!")
 		if err := s.reply(ctx, sess, greeting); err != nil {
 			return err
@@ -150,7 +254,6 @@ func (s *Service) handleLanguageSelection(ctx context.Context, sess *domain.Sess
 	}
 
 	sess.Stage = domain.StageChooseAuthMode
-	s.saveSession(sess)
 	return s.sendAuthModePrompt(ctx, sess)
 }
 
@@ -164,27 +267,23 @@ func (s *Service) handleChooseAuthMode(ctx context.Context, sess *domain.Session
 	}
 	switch mode {
 	case "guest", "гость":
-		sess.Role = domain.RoleApplicant
-		sess.Stage = domain.StageMainMenu
-		if root := s.menus.Root(sess.Role); root != nil {
-			sess.CurrentMenu = root.ID
-		}
-		s.saveSession(sess)
-		greeting := s.t(sess.Language, "🎉 Добро пожаловать в гостевой режим!\n\n👋 Вы можете просматривать информацию о поступлении и общих сервисах.", "🎉 Welcome to guest mode!\n\n👋 You can browse admission info and general services.")
-		if err := s.reply(ctx, sess, greeting); err != nil {
-			return err
-		}
-		return s.sendCurrentMenu(ctx, sess)
+		return s.enterGuestMode(ctx, sess)
 	case "login", "войти":
-		sess.Stage = domain.StageCollectEmail
-		s.saveSession(sess)
-		return s.reply(ctx, sess, s.t(sess.Language, "📧 Введите ваш университетский email для авторизации:\n\nПример: student@university.edu", "📧 Enter your university email for login:\n\nExample: student@university.edu"))
+		return s.promptLoginEmail(ctx, sess)
 	default:
 		return s.sendAuthModePrompt(ctx, sess)
 	}
 }
 
 func (s *Service) handleEmailCollection(ctx context.Context, sess *domain.Session, upd domain.Update) error {
+	if upd.Type == domain.UpdateTypeCallback {
+		switch upd.Payload {
+		case payloadAuthPref + "guest":
+			return s.enterGuestMode(ctx, sess)
+		case payloadAuthPref + "login":
+			return s.promptLoginEmail(ctx, sess)
+		}
+	}
 	if upd.Text == "" {
 		return nil
 	}
@@ -192,53 +291,75 @@ func (s *Service) handleEmailCollection(ctx context.Context, sess *domain.Sessio
 	if !strings.Contains(email, "@") || len(email) < 5 {
 		return s.reply(ctx, sess, s.t(sess.Language, "❌ Неверный формат email. Попробуйте снова.", "❌ Invalid email format. Please try again."))
 	}
+	if !s.loginDomainAllowed(email) {
+		domains := "@" + strings.Join(s.cfg.LoginEmailDomains, ", @")
+		return s.reply(ctx, sess, s.t(sess.Language,
+			fmt.Sprintf("🏛 Вход доступен только с университетской почты (%s). Введите другой email:", domains),
+			fmt.Sprintf("🏛 Login is only available with a university email (%s). Please enter another email:", domains)))
+	}
 	sess.Email = email
-	code := s.generateOTP()
-	sess.PendingOTP = &domain.PendingOTP{
-		Code:      code,
-		ExpiresAt: s.now().Add(s.otpExpiry),
+	if until, locked := s.otpLimiter.lockedUntil(email, s.now()); locked {
+		return s.replyOTPLocked(ctx, sess, until)
 	}
-	if err := s.email.SendOTP(context.Background(), email, code); err != nil {
-		s.log.Error().Err(err).Str("email", email).Msg("failed to send otp")
+	if _, err := s.backend.GetUserByEmail(ctx, email); err != nil {
+		if errors.Is(err, domain.ErrNotFound) {
+			return s.replyUnknownEmail(ctx, sess)
+		}
+		s.log.Error().Err(err).Str("email", email).Msg("failed to look up user before login")
+		return s.reply(ctx, sess, s.t(sess.Language, "⚠️ Сервис авторизации временно недоступен. Попробуйте ввести email чуть позже.", "⚠️ The login service is temporarily unavailable. Please try entering your email again later."))
 	}
-	sess.Stage = domain.StageAwaitOTP
-	s.saveSession(sess)
-	return s.reply(ctx, sess, s.t(sess.Language, "🔐 Мы отправили 6-значный код подтверждения на вашу почту!\n\n📨 Проверьте папку \"Входящие\" и введите код:", "🔐 We sent a 6-digit verification code to your email!\n\n📨 Check your inbox and enter the code:"))
+	return s.sendOTP(ctx, sess)
 }
 
 func (s *Service) handleOTPSubmission(ctx context.Context, sess *domain.Session, upd domain.Update) error {
+	if upd.Type == domain.UpdateTypeCallback && upd.Payload == payloadOTPResend {
+		return s.handleOTPResend(ctx, sess)
+	}
 	if upd.Text == "" || sess.PendingOTP == nil {
 		return nil
 	}
+	if until, locked := s.otpLimiter.lockedUntil(sess.Email, s.now()); locked {
+		return s.replyOTPLocked(ctx, sess, until)
+	}
 	if s.now().After(sess.PendingOTP.ExpiresAt) {
-		sess.PendingOTP = nil
-		s.saveSession(sess)
-		return s.reply(ctx, sess, s.t(sess.Language, "⏰ Код подтверждения истёк. Начните процесс заново с /start", "⏰ Verification code expired. Start over with /start"))
+		return s.replyMessage(ctx, sess, domain.OutgoingMessage{
+			Text:     s.t(sess.Language, "⏰ Код подтверждения истёк. Запросите новый код.", "⏰ Verification code expired. Request a new one."),
+			Keyboard: s.otpKeyboard(sess),
+		})
 	}
-	if strings.TrimSpace(upd.Text) != sess.PendingOTP.Code {
-		return s.reply(ctx, sess, s.t(sess.Language, "❌ Неверный код подтверждения. Попробуйте ещё раз.", "❌ Incorrect verification code. Try again."))
+	if !s.verifyOTP(sess.PendingOTP, strings.TrimSpace(upd.Text)) {
+		sess.PendingOTP.Attempts++
+		emailLocked := s.otpLimiter.fail(sess.Email, s.now())
+		s.log.Warn().Str("email", sess.Email).Int64("chat_id", sess.ChatID).Int("attempts", sess.PendingOTP.Attempts).Msg("invalid otp submitted")
+		if emailLocked || sess.PendingOTP.Attempts >= s.cfg.OTPMaxAttempts {
+			return s.replyOTPLocked(ctx, sess, s.now().Add(s.cfg.OTPLockout))
+		}
+		left := s.cfg.OTPMaxAttempts - sess.PendingOTP.Attempts
+		return s.replyMessage(ctx, sess, domain.OutgoingMessage{
+			Text:     s.t(sess.Language, fmt.Sprintf("❌ Неверный код подтверждения. Осталось попыток: %d.", left), fmt.Sprintf("❌ Incorrect verification code. Attempts left: %d.", left)),
+			Keyboard: s.otpKeyboard(sess),
+		})
 	}
+	s.otpLimiter.reset(sess.Email)
 
 	profile, err := s.backend.GetUserByEmail(ctx, sess.Email)
+	if errors.Is(err, domain.ErrNotFound) {
+		sess.PendingOTP = nil
+		sess.Stage = domain.StageCollectEmail
+		return s.replyUnknownEmail(ctx, sess)
+	}
 	if err != nil {
-		s.log.Warn().Err(err).Str("email", sess.Email).Msg("user not found, fallback applicant")
-		profile = &domain.UserProfile{
-			Email:     sess.Email,
-			NameRU:    sess.Email,
-			NameEN:    sess.Email,
-			Role:      domain.RoleApplicant,
-			Language:  sess.Language,
-			CreatedAt: s.now(),
-		}
+		s.log.Error().Err(err).Str("email", sess.Email).Msg("failed to load profile after otp")
+		return s.reply(ctx, sess, s.t(sess.Language, "⚠️ Не удалось загрузить ваш профиль. Отправьте код ещё раз через минуту.", "⚠️ We couldn't load your profile. Please send the code again in a minute."))
 	}
 	sess.Profile = profile
 	sess.Role = profile.Role
+	sess.LoggedInAt = s.now()
 	sess.Stage = domain.StageMainMenu
 	sess.PendingOTP = nil
 	if root := s.menus.Root(sess.Role); root != nil {
 		sess.CurrentMenu = root.ID
 	}
-	s.saveSession(sess)
 
 	greeting := s.t(sess.Language, fmt.Sprintf("🎊 Добро пожаловать, %s!\n\n✅ Авторизация успешна. Доступ ко всем сервисам открыт.", profile.NameRU), fmt.Sprintf("🎊 Welcome, %s!\n\n✅ Login successful. Full access to all services.", profile.NameEN))
 	if err := s.reply(ctx, sess, greeting); err != nil {
@@ -248,14 +369,28 @@ func (s *Service) handleOTPSubmission(ctx context.Context, sess *domain.Session,
 }
 
 func (s *Service) handleMainMenu(ctx context.Context, sess *domain.Session, upd domain.Update) error {
-	if sess.PendingVisaApplicationID > 0 && upd.Type == domain.UpdateTypeMessage && strings.TrimSpace(upd.Text) != "" {
-		return s.handleVisaDocumentUpload(ctx, sess, strings.TrimSpace(upd.Text))
+	hasInput := strings.TrimSpace(upd.Text) != "" || len(upd.Attachments) > 0
+	if sess.PendingVisaApplicationID > 0 && upd.Type == domain.UpdateTypeMessage && hasInput {
+		return s.handleVisaDocumentUpload(ctx, sess, upd.Attachments)
 	}
-	if sess.PendingAction != nil && upd.Type == domain.UpdateTypeMessage && strings.TrimSpace(upd.Text) != "" {
-		return s.handleFormInput(ctx, sess, strings.TrimSpace(upd.Text))
+	if sess.PendingAction != nil && sess.PendingAction.ID == domain.ActionBroadcast && upd.Type == domain.UpdateTypeMessage && hasInput {
+		return s.handleBroadcastInput(ctx, sess, upd)
+	}
+	if sess.PendingAction != nil && (upd.Type == domain.UpdateTypeContact || upd.Type == domain.UpdateTypeMessage && hasInput) {
+		return s.handleFormInput(ctx, sess, upd)
 	}
 
 	if upd.Type == domain.UpdateTypeCallback {
+		if requiresSignature(upd.Payload) {
+			payload, err := s.verifyCallback(sess, upd.Payload)
+			if err != nil {
+				return s.rejectCallback(ctx, sess, upd.Payload, err)
+			}
+			upd.Payload = payload
+		}
+		if !s.authorizeCallback(sess, upd.Payload) {
+			return s.replyForbidden(ctx, sess)
+		}
 		switch {
 		case strings.HasPrefix(upd.Payload, payloadNavPrefix):
 			return s.navigateTo(ctx, sess, strings.TrimPrefix(upd.Payload, payloadNavPrefix))
@@ -264,8 +399,9 @@ func (s *Service) handleMainMenu(ctx context.Context, sess *domain.Session, upd
 		case strings.HasPrefix(upd.Payload, payloadLangPref):
 			sess.Stage = domain.StageSelectLanguage
 			sess.PendingAction = nil
-			s.saveSession(sess)
 			return s.sendLanguagePrompt(ctx, sess, false)
+		case strings.HasPrefix(upd.Payload, payloadRolePref):
+			return s.switchRole(ctx, sess, domain.Role(strings.TrimPrefix(upd.Payload, payloadRolePref)))
 		case strings.HasPrefix(upd.Payload, "event_select:"):
 			return s.handleEventSelect(ctx, sess, strings.TrimPrefix(upd.Payload, "event_select:"))
 		case strings.HasPrefix(upd.Payload, "event_mode:"):
@@ -287,6 +423,8 @@ func (s *Service) handleMainMenu(ctx context.Context, sess *domain.Session, upd
 		case strings.HasPrefix(upd.Payload, "visa_type:"):
 			appType := strings.TrimPrefix(upd.Payload, "visa_type:")
 			return s.handleVisaTypeSelect(ctx, sess, appType)
+		case strings.HasPrefix(upd.Payload, payloadBroadcastPref):
+			return s.handleBroadcastCallback(ctx, sess, strings.TrimPrefix(upd.Payload, payloadBroadcastPref))
 		}
 	}
 
@@ -301,30 +439,52 @@ func (s *Service) navigateTo(ctx context.Context, sess *domain.Session, nodeID s
 	if node == nil {
 		return nil
 	}
+	if !s.authorizeNode(sess, node) {
+		return s.replyForbidden(ctx, sess)
+	}
 	root := s.menus.Root(sess.Role)
 	if root == nil {
 		return nil
 	}
 	sess.CurrentMenu = node.ID
-	s.saveSession(sess)
-	return s.sendMenuNode(ctx, sess, node)
+	msg := s.menuMessage(sess, node)
+	if s.editMenu(ctx, sess, msg) {
+		return nil
+	}
+	return s.sendMenu(ctx, sess, msg)
 }
 
 func (s *Service) executeAction(ctx context.Context, sess *domain.Session, action domain.ActionID) error {
+	if !s.authorizeAction(sess, action) {
+		return s.replyForbidden(ctx, sess)
+	}
 	if action == domain.ActionSwitchLanguage {
 		sess.Stage = domain.StageSelectLanguage
 		sess.PendingAction = nil
 		sess.PendingEventID = 0
 		sess.PendingVisaApplicationID = 0
-		s.saveSession(sess)
 		return s.sendLanguagePrompt(ctx, sess, false)
 	}
+	if action == domain.ActionLogout {
+		return s.logout(ctx, sess)
+	}
+	if action == domain.ActionBroadcast {
+		return s.startBroadcast(ctx, sess)
+	}
 
 	if form, ok := s.forms[action]; ok {
 		return s.startForm(ctx, sess, action, form)
 	}
 
 	msg, err := s.handleAction(ctx, sess, action)
+	if errors.Is(err, domain.ErrForbidden) {
+		s.logDenied(sess, "backend", string(action))
+		return s.replyForbidden(ctx, sess)
+	}
+	if text, ok := s.unavailableText(sess.Language, err); ok {
+		s.log.Warn().Err(err).Str("action", string(action)).Msg("backend unavailable")
+		return s.notice(ctx, sess, text)
+	}
 	if err != nil {
 		s.log.Error().Err(err).Str("action", string(action)).Msg("action handler failed")
 		return s.reply(ctx, sess, s.t(sess.Language, "Произошла ошибка. Попробуйте позже.", "Something went wrong, please try later."))
@@ -337,7 +497,6 @@ func (s *Service) sendCurrentMenu(ctx context.Context, sess *domain.Session) err
 	if node == nil {
 		if root := s.menus.Root(sess.Role); root != nil {
 			sess.CurrentMenu = root.ID
-			s.saveSession(sess)
 			node = root
 		} else {
 			return nil
@@ -347,17 +506,51 @@ func (s *Service) sendCurrentMenu(ctx context.Context, sess *domain.Session) err
 }
 
 func (s *Service) sendMenuNode(ctx context.Context, sess *domain.Session, node *MenuNode) error {
+	return s.sendMenu(ctx, sess, s.menuMessage(sess, node))
+}
+
+func (s *Service) menuMessage(sess *domain.Session, node *MenuNode) domain.OutgoingMessage {
 	title := node.TitleText(sess.Language)
 	desc := node.DescriptionText(sess.Language)
 	text := title
 	if desc != "" {
 		text = fmt.Sprintf("%s\n\n%s", title, desc)
 	}
-	msg := domain.OutgoingMessage{
+	return domain.OutgoingMessage{
 		Text:     text,
 		Keyboard: s.buildMenuKeyboard(sess, node),
 	}
-	return s.replyMessage(ctx, sess, msg)
+}
+
+// accountActions only make sense for a signed-in session.
+var accountActions = map[domain.ActionID]bool{
+	domain.ActionViewProfile:         true,
+	domain.ActionSwitchRole:          true,
+	domain.ActionToggleNotifications: true,
+	domain.ActionSecurityOverview:    true,
+	domain.ActionSignOutOthers:       true,
+	domain.ActionLogout:              true,
+}
+
+// menuItemVisible hides buttons the session cannot use, and submenus left
+// with no visible buttons.
+func (s *Service) menuItemVisible(sess *domain.Session, node *MenuNode) bool {
+	switch {
+	case node.Action == "":
+		for _, child := range node.Children {
+			if s.menuItemVisible(sess, child) {
+				return true
+			}
+		}
+		return len(node.Children) == 0
+	case accountActions[node.Action] && sess.Profile == nil:
+		return false
+	case node.Action == domain.ActionSwitchRole:
+		return len(sess.Profile.AvailableRoles()) > 1
+	case node.Action == domain.ActionBroadcast:
+		return s.canBroadcast(sess)
+	}
+	return true
 }
 
 func (s *Service) buildMenuKeyboard(sess *domain.Session, node *MenuNode) *domain.Keyboard {
@@ -366,6 +559,9 @@ func (s *Service) buildMenuKeyboard(sess *domain.Session, node *MenuNode) *domai
 	}
 	kb := &domain.Keyboard{}
 	for _, child := range node.Children {
+		if !s.menuItemVisible(sess, child) {
+			continue
+		}
 		btn := domain.KeyboardButton{
 			Label: child.TitleText(sess.Language),
 			Style: domain.ButtonStylePrimary,
@@ -439,7 +635,48 @@ func (s *Service) reply(ctx context.Context, sess *domain.Session, text string)
 }
 
 func (s *Service) replyMessage(ctx context.Context, sess *domain.Session, msg domain.OutgoingMessage) error {
-	s.saveSession(sess)
+	_, err := s.deliver(ctx, sess, msg)
+	return err
+}
+
+// sendMenu sends a menu as a new message and remembers it, so that following
+// navigation edits it in place instead of stacking keyboards in the chat.
+func (s *Service) sendMenu(ctx context.Context, sess *domain.Session, msg domain.OutgoingMessage) error {
+	messageID, err := s.deliver(ctx, sess, msg)
+	if err != nil {
+		return err
+	}
+	if messageID != "" {
+		sess.MenuMessageID = messageID
+	}
+	return nil
+}
+
+// editMenu rewrites the remembered menu message and reports whether it did.
+// It fails when the message is gone or too old to edit; callers then send anew.
+func (s *Service) editMenu(ctx context.Context, sess *domain.Session, msg domain.OutgoingMessage) bool {
+	if sess.MenuMessageID == "" {
+		return false
+	}
+	msg.Keyboard = s.signKeyboard(sess, msg.Keyboard)
+	if err := s.messenger.Edit(ctx, sess.ChatID, sess.MenuMessageID, msg); err != nil {
+		s.log.Debug().Err(err).Int64("chat_id", sess.ChatID).Str("message_id", sess.MenuMessageID).Msg("menu edit failed, sending a new one")
+		sess.MenuMessageID = ""
+		return false
+	}
+	return true
+}
+
+func (s *Service) deliver(ctx context.Context, sess *domain.Session, msg domain.OutgoingMessage) (string, error) {
+	if msg.Reset && sess.MenuMessageID != "" {
+		if err := s.messenger.Delete(ctx, sess.ChatID, sess.MenuMessageID); err != nil {
+			s.log.Debug().Err(err).Int64("chat_id", sess.ChatID).Msg("failed to delete previous menu")
+		}
+	}
+	// Anything sent below the menu means it is no longer the latest message;
+	// editing it would change content the user has scrolled past.
+	sess.MenuMessageID = ""
+	msg.Keyboard = s.signKeyboard(sess, msg.Keyboard)
 	return s.messenger.Send(ctx, sess.ChatID, sess.UserID, msg)
 }
 
@@ -447,17 +684,19 @@ func (s *Service) ensureSession(chatID int64) *domain.Session {
 	if sess, ok := s.store.Get(chatID); ok {
 		return sess
 	}
-	sess := &domain.Session{
+	return &domain.Session{
 		ChatID:   chatID,
 		Language: domain.LanguageRU,
 		Stage:    domain.StageInit,
 		Role:     domain.RoleApplicant,
 	}
-	s.store.Save(sess)
-	return sess
 }
 
-func (s *Service) resetSession(sess *domain.Session) {
+func isStartCommand(text string) bool {
+	return strings.EqualFold(strings.TrimSpace(text), "/start")
+}
+
+func clearSessionAuth(sess *domain.Session) {
 	sess.Stage = domain.StageInit
 	sess.PendingAction = nil
 	sess.PendingOTP = nil
@@ -467,11 +706,34 @@ func (s *Service) resetSession(sess *domain.Session) {
 	sess.Email = ""
 	sess.Role = domain.RoleApplicant
 	sess.CurrentMenu = ""
-	s.saveSession(sess)
-}
-
-func (s *Service) saveSession(sess *domain.Session) {
-	s.store.Save(sess)
+	sess.LoggedInAt = time.Time{}
+}
+
+// commitSession stores the session once at the end of an update. Handlers
+// only change it in memory. If someone else wrote the session in the meantime
+// (the janitor, a remote sign-out, another replica), the update's own changes
+// are re-applied on top of theirs instead of being dropped.
+func (s *Service) commitSession(base, sess *domain.Session) {
+	err := s.store.Save(sess)
+	if errors.Is(err, state.ErrVersionConflict) {
+		var merged *domain.Session
+		merged, err = s.store.Update(sess.ChatID, func(cur *domain.Session) error {
+			cur.Rebase(base, sess)
+			return nil
+		})
+		switch {
+		case errors.Is(err, state.ErrSessionNotFound):
+			// Deleted while the update ran; the user is active, so keep it.
+			sess.Version = 0
+			err = s.store.Save(sess)
+		case err == nil:
+			*sess = *merged
+			s.log.Debug().Int64("chat_id", sess.ChatID).Msg("session changed concurrently, update re-applied")
+		}
+	}
+	if err != nil {
+		s.log.Error().Err(err).Int64("chat_id", sess.ChatID).Msg("failed to save session")
+	}
 }
 
 func (s *Service) generateOTP() string {
@@ -495,7 +757,6 @@ func (s *Service) handleEventSelect(ctx context.Context, sess *domain.Session, e
 		return s.reply(ctx, sess, "Invalid event ID.")
 	}
 	sess.PendingEventID = eventID
-	s.saveSession(sess)
 	kb := &domain.Keyboard{
 		Rows: [][]domain.KeyboardButton{
 			{
@@ -505,7 +766,7 @@ func (s *Service) handleEventSelect(ctx context.Context, sess *domain.Session, e
 		},
 	}
 	msg := domain.OutgoingMessage{
-		Text:    "Choose your registration type:",
+		Text:     "Choose your registration type:",
 		Keyboard: kb,
 	}
 	return s.replyMessage(ctx, sess, msg)
@@ -517,22 +778,25 @@ func (s *Service) handleEventMode(ctx context.Context, sess *domain.Session, mod
 	}
 	if sess.Profile == nil || sess.Profile.ID == 0 {
 		sess.PendingEventID = 0
-		s.saveSession(sess)
 		return s.reply(ctx, sess, "Please login first.")
 	}
 	status, err := s.backend.RSVPEvent(ctx, sess.PendingEventID, sess.Profile.ID, mode, "")
+	sess.PendingEventID = 0
+	if errors.Is(err, domain.ErrConflict) {
+		return s.notice(ctx, sess, s.t(sess.Language, "😔 Свободных мест на событии не осталось.", "😔 This event is fully booked."))
+	}
+	if text, ok := s.unavailableText(sess.Language, err); ok {
+		return s.notice(ctx, sess, text)
+	}
 	if err != nil {
-		sess.PendingEventID = 0
-		s.saveSession(sess)
-		return s.reply(ctx, sess, "Registration failed: "+err.Error())
+		s.log.Error().Err(err).Msg("event registration failed")
+		return s.notice(ctx, sess, s.t(sess.Language, "⚠️ Не удалось зарегистрироваться. Попробуйте позже.", "⚠️ Registration failed. Please try again later."))
 	}
-	sess.PendingEventID = 0
-	s.saveSession(sess)
 	switch status {
 	case "registered", "updated":
 		return s.reply(ctx, sess, "Registration successful as "+mode+"!")
 	case "already_registered":
-		return s.reply(ctx, sess, "You are already registered for this event.")
+		return s.notice(ctx, sess, s.t(sess.Language, "ℹ️ Вы уже зарегистрированы на это событие.", "ℹ️ You are already registered for this event."))
 	default:
 		return s.reply(ctx, sess, "Registration status: "+status)
 	}
@@ -547,8 +811,12 @@ func (s *Service) handleCancelEvent(ctx context.Context, sess *domain.Session, e
 		return s.reply(ctx, sess, "Please login first.")
 	}
 	err = s.backend.CancelRSVP(ctx, eventID, sess.Profile.ID)
+	if text, ok := s.unavailableText(sess.Language, err); ok {
+		return s.notice(ctx, sess, text)
+	}
 	if err != nil {
-		return s.reply(ctx, sess, "Cancellation failed: "+err.Error())
+		s.log.Error().Err(err).Int64("event_id", eventID).Msg("event cancellation failed")
+		return s.notice(ctx, sess, s.t(sess.Language, "⚠️ Не удалось отменить регистрацию. Попробуйте позже.", "⚠️ Cancellation failed. Please try again later."))
 	}
 	return s.reply(ctx, sess, "Registration cancelled successfully!")
 }
@@ -559,7 +827,7 @@ func (s *Service) handleScheduleFilter(ctx context.Context, sess *domain.Session
 	}
 	items, err := s.backend.GetSchedule(ctx, sess.Profile.ID)
 	if err != nil {
-		return s.reply(ctx, sess, s.t(sess.Language, "Ошибка загрузки расписания.", "Error loading schedule."))
+		return s.notice(ctx, sess, s.t(sess.Language, "Ошибка загрузки расписания.", "Error loading schedule."))
 	}
 	var filtered []domain.ScheduleEntry
 	if param == "all" {
@@ -605,9 +873,21 @@ func (s *Service) handleVisaWithdraw(ctx context.Context, sess *domain.Session,
 	if sess.Profile == nil || sess.Profile.ID == 0 {
 		return s.reply(ctx, sess, s.t(sess.Language, "Нужна авторизация.", "Please login first."))
 	}
+	owned, err := s.ownsVisaApplication(ctx, sess.Profile.ID, appID)
+	if err != nil {
+		return s.notice(ctx, sess, s.t(sess.Language, "Ошибка при отзыве заявки.", "Error withdrawing application."))
+	}
+	if !owned {
+		s.logDenied(sess, "visa_application", appIDStr)
+		return s.replyForbidden(ctx, sess)
+	}
 	err = s.backend.WithdrawVisaApplication(ctx, appID)
+	if errors.Is(err, domain.ErrForbidden) {
+		s.logDenied(sess, "visa_application", appIDStr)
+		return s.replyForbidden(ctx, sess)
+	}
 	if err != nil {
-		return s.reply(ctx, sess, s.t(sess.Language, "Ошибка при отзыве заявки.", "Error withdrawing application."))
+		return s.notice(ctx, sess, s.t(sess.Language, "Ошибка при отзыве заявки.", "Error withdrawing application."))
 	}
 	return s.reply(ctx, sess, s.t(sess.Language, "Заявка отозвана.", "Application withdrawn."))
 }
@@ -620,9 +900,17 @@ func (s *Service) handleVisaShowDocuments(ctx context.Context, sess *domain.Sess
 	if sess.Profile == nil || sess.Profile.ID == 0 {
 		return s.reply(ctx, sess, s.t(sess.Language, "Нужна авторизация.", "Please login first."))
 	}
+	owned, err := s.ownsVisaApplication(ctx, sess.Profile.ID, appID)
+	if err != nil {
+		return s.notice(ctx, sess, s.t(sess.Language, "Ошибка загрузки документов.", "Error loading documents."))
+	}
+	if !owned {
+		s.logDenied(sess, "visa_application", appIDStr)
+		return s.replyForbidden(ctx, sess)
+	}
 	docs, err := s.backend.GetVisaDocuments(ctx, appID)
 	if err != nil {
-		return s.reply(ctx, sess, s.t(sess.Language, "Ошибка загрузки документов.", "Error loading documents."))
+		return s.notice(ctx, sess, s.t(sess.Language, "Ошибка загрузки документов.", "Error loading documents."))
 	}
 	if len(docs) == 0 {
 		return s.reply(ctx, sess, s.t(sess.Language, "Нет связанных документов.", "No relevant docs."))
@@ -640,24 +928,25 @@ func (s *Service) handleVisaTypeSelect(ctx context.Context, sess *domain.Session
 	}
 	appID, err := s.backend.CreateVisaApplication(ctx, sess.Profile.ID, appType)
 	if err != nil {
-		return s.reply(ctx, sess, s.t(sess.Language, "Ошибка создания заявки.", "Error creating application."))
+		return s.notice(ctx, sess, s.t(sess.Language, "Ошибка создания заявки.", "Error creating application."))
 	}
 	sess.PendingVisaApplicationID = appID
-	s.saveSession(sess)
-	return s.reply(ctx, sess, s.t(sess.Language, "Заявка создана. Пожалуйста, загрузите документ (отправьте файл или ссылку).", "Application created. Please upload the document (send file or link)."))
+	return s.reply(ctx, sess, s.t(sess.Language, "Заявка создана. Пожалуйста, прикрепите документ (PDF, JPEG или PNG, до 10 МБ).", "Application created. Please attach the document (PDF, JPEG or PNG, up to 10 MB)."))
 }
 
-func (s *Service) handleVisaDocumentUpload(ctx context.Context, sess *domain.Session, fileURL string) error {
+func (s *Service) handleVisaDocumentUpload(ctx context.Context, sess *domain.Session, attachments []domain.Attachment) error {
 	if sess.PendingVisaApplicationID == 0 {
 		return nil // shouldn't happen
 	}
-	// Assume fileURL is the file name or URL
-	_, err := s.backend.UploadVisaDocument(ctx, sess.PendingVisaApplicationID, "uploaded_document", fileURL)
+	att, problem := s.pickUpload(sess, documentUpload, attachments)
+	if problem != "" {
+		return s.reply(ctx, sess, problem)
+	}
+	_, err := s.backend.UploadVisaDocument(ctx, sess.PendingVisaApplicationID, uploadFileName(att), att.Location())
 	if err != nil {
 		return s.reply(ctx, sess, s.t(sess.Language, "Ошибка загрузки документа.", "Error uploading document."))
 	}
 	sess.PendingVisaApplicationID = 0
-	s.saveSession(sess)
 	return s.reply(ctx, sess, s.t(sess.Language, "Документ загружен успешно.", "Document uploaded successfully."))
 }
 
@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+func TestUpdateWritesSessionOnce(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "anna@univ.ru"})
+	before := ts.store.count()
+
+	ts.press(t, 1, payloadActionPref+string(domain.ActionToggleNotifications))
+
+	if got := ts.store.count() - before; got != 1 {
+		t.Fatalf("update wrote the session %d times, want 1", got)
+	}
+	if !ts.session(t, 1).NotificationsDisabled {
+		t.Fatalf("notifications still enabled after toggle")
+	}
+}
+
+func TestUpdateRebasesOnConcurrentWrite(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "anna@univ.ru"})
+	// Another writer changes the session while the handler is replying.
+	ts.messenger.onSend = func(_ context.Context, chatID int64) {
+		_, err := ts.store.Update(chatID, func(sess *domain.Session) error {
+			sess.PendingVisaApplicationID = 42
+			return nil
+		})
+		if err != nil {
+			t.Errorf("concurrent update: %v", err)
+		}
+	}
+
+	ts.press(t, 1, payloadActionPref+string(domain.ActionToggleNotifications))
+
+	sess := ts.session(t, 1)
+	if !sess.NotificationsDisabled {
+		t.Errorf("the update's own change was lost")
+	}
+	if sess.PendingVisaApplicationID != 42 {
+		t.Errorf("the concurrent change was lost: PendingVisaApplicationID = %d", sess.PendingVisaApplicationID)
+	}
+}
+
+func TestUpdateRecreatesSessionDeletedMeanwhile(t *testing.T) {
+	ts := newTestService(t, nil)
+	ts.signIn(t, 1, domain.UserProfile{ID: 1, Email: "anna@univ.ru"})
+	ts.messenger.onSend = func(_ context.Context, chatID int64) { ts.store.Delete(chatID) }
+
+	ts.press(t, 1, payloadActionPref+string(domain.ActionToggleNotifications))
+
+	if sess := ts.session(t, 1); sess.Profile == nil || !sess.NotificationsDisabled {
+		t.Fatalf("session not restored with the update's changes: %+v", sess)
+	}
+}
+
+func TestConcurrentUpdatesAndWriters(t *testing.T) {
+	const (
+		chats   = 16
+		toggles = 5
+	)
+	ts := newTestService(t, nil)
+	for chat := int64(1); chat <= chats; chat++ {
+		ts.signIn(t, chat, domain.UserProfile{ID: chat, Email: "user@univ.ru"})
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		written = make(map[int64]int64)
+	)
+	for chat := int64(1); chat <= chats; chat++ {
+		wg.Add(2)
+		// Updates of one chat are serial, as the dispatcher guarantees.
+		go func() {
+			defer wg.Done()
+			for i := 0; i < toggles; i++ {
+				ts.press(t, chat, payloadActionPref+string(domain.ActionToggleNotifications))
+			}
+		}()
+		// Writers outside the update flow, like the janitor or a remote
+		// sign-out, race with them.
+		go func() {
+			defer wg.Done()
+			for i := 0; i < toggles; i++ {
+				if _, err := ts.store.Update(chat, func(sess *domain.Session) error {
+					sess.PendingEventID++
+					return nil
+				}); err == nil {
+					mu.Lock()
+					written[chat]++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for chat := int64(1); chat <= chats; chat++ {
+		sess := ts.session(t, chat)
+		if sess.NotificationsDisabled != (toggles%2 == 1) {
+			t.Errorf("chat %d: NotificationsDisabled = %v after %d toggles", chat, sess.NotificationsDisabled, toggles)
+		}
+		if sess.PendingEventID != written[chat] {
+			t.Errorf("chat %d: PendingEventID = %d, want %d", chat, sess.PendingEventID, written[chat])
+		}
+	}
+}
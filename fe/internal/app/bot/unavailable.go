@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"errors"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// subsystemTitles names backend API sections in outage messages.
+var subsystemTitles = map[string]map[domain.Language]string{
+	"users":         l("Профили", "Profiles"),
+	"schedule":      l("Расписание", "Schedule"),
+	"courses":       l("Курсы", "Courses"),
+	"exams":         l("Экзамены", "Exams"),
+	"grades":        l("Оценки", "Grades"),
+	"deadlines":     l("Дедлайны", "Deadlines"),
+	"events":        l("Мероприятия", "Events"),
+	"news":          l("Новости", "News"),
+	"clubs":         l("Клубы", "Clubs"),
+	"admissions":    l("Приёмная комиссия", "Admissions"),
+	"dean":          l("Деканат", "Dean's office"),
+	"dorms":         l("Общежитие", "Dormitory"),
+	"library":       l("Библиотека", "Library"),
+	"support":       l("Поддержка", "Support"),
+	"ai":            l("AI-ассистент", "AI assistant"),
+	"hr":            l("Кадры", "HR"),
+	"visa":          l("Визы", "Visa"),
+	"notifications": l("Уведомления", "Notifications"),
+}
+
+// unavailableText reports whether err is a backend outage and, if so, the
+// message telling the user which service is down.
+func (s *Service) unavailableText(lang domain.Language, err error) (string, bool) {
+	var unavailable *domain.UnavailableError
+	if !errors.As(err, &unavailable) {
+		return "", false
+	}
+	title, ok := subsystemTitles[unavailable.Subsystem]
+	if !ok {
+		return s.t(lang,
+			"⏳ Сервисы университета временно недоступны. Попробуйте через несколько минут.",
+			"⏳ University services are temporarily unavailable. Please try again in a few minutes."), true
+	}
+	return s.t(lang,
+		"⏳ Сервис «"+title[domain.LanguageRU]+"» временно недоступен. Попробуйте через несколько минут.",
+		"⏳ The "+title[domain.LanguageEN]+" service is temporarily unavailable. Please try again in a few minutes."), true
+}
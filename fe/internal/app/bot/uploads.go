@@ -0,0 +1,100 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// UploadRule restricts what a file field accepts. Accept holds MIME types,
+// "image/*" style wildcards allowed; a zero MaxSize means no limit. Sizes the
+// platform does not report are not checked.
+type UploadRule struct {
+	Accept  []string
+	MaxSize int64
+}
+
+var (
+	documentUpload = UploadRule{Accept: []string{"application/pdf", "image/jpeg", "image/png"}, MaxSize: 10 << 20}
+	photoUpload    = UploadRule{Accept: []string{"image/*"}, MaxSize: 5 << 20}
+)
+
+// Form data keeps the upload location under the field key and its metadata
+// under these suffixes.
+const (
+	uploadNameSuffix = "_name"
+	uploadMIMESuffix = "_mime"
+)
+
+func (r UploadRule) allows(mimeType string) bool {
+	mimeType = strings.ToLower(mimeType)
+	for _, accept := range r.Accept {
+		if accept == mimeType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(accept, "*"); ok && mimeType != "" && strings.HasPrefix(mimeType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// pickUpload returns the first attachment of the message that satisfies the
+// rule, or a user-facing explanation of why none does.
+func (s *Service) pickUpload(sess *domain.Session, rule UploadRule, attachments []domain.Attachment) (domain.Attachment, string) {
+	if len(attachments) == 0 {
+		return domain.Attachment{}, s.t(sess.Language,
+			fmt.Sprintf("📎 Прикрепите файл (%s) к сообщению.", s.uploadFormats(sess, rule)),
+			fmt.Sprintf("📎 Please attach a file (%s) to your message.", s.uploadFormats(sess, rule)))
+	}
+	var tooLarge bool
+	for _, att := range attachments {
+		if !rule.allows(att.MIMEType) {
+			continue
+		}
+		if rule.MaxSize > 0 && att.Size > rule.MaxSize {
+			tooLarge = true
+			continue
+		}
+		if att.Location() == "" {
+			continue
+		}
+		return att, ""
+	}
+	if tooLarge {
+		mb := rule.MaxSize >> 20
+		return domain.Attachment{}, s.t(sess.Language,
+			fmt.Sprintf("⚠️ Файл слишком большой. Максимальный размер — %d МБ.", mb),
+			fmt.Sprintf("⚠️ The file is too large. The limit is %d MB.", mb))
+	}
+	return domain.Attachment{}, s.t(sess.Language,
+		fmt.Sprintf("⚠️ Этот тип файла не поддерживается. Допустимые форматы: %s.", s.uploadFormats(sess, rule)),
+		fmt.Sprintf("⚠️ This file type is not supported. Allowed formats: %s.", s.uploadFormats(sess, rule)))
+}
+
+func (s *Service) uploadFormats(sess *domain.Session, rule UploadRule) string {
+	names := make([]string, 0, len(rule.Accept))
+	for _, accept := range rule.Accept {
+		_, sub, _ := strings.Cut(accept, "/")
+		if sub == "*" {
+			names = append(names, s.t(sess.Language, "изображения", "images"))
+			continue
+		}
+		names = append(names, strings.ToUpper(sub))
+	}
+	return strings.Join(names, ", ")
+}
+
+func storeUpload(data map[string]string, key string, att domain.Attachment) {
+	data[key] = att.Location()
+	data[key+uploadNameSuffix] = uploadFileName(att)
+	data[key+uploadMIMESuffix] = att.MIMEType
+}
+
+func uploadFileName(att domain.Attachment) string {
+	if att.FileName != "" {
+		return att.FileName
+	}
+	return "document"
+}
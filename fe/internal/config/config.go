@@ -1,25 +1,89 @@
 package config
 
 import (
+	"errors"
+	"regexp"
 	"time"
 
 	"github.com/caarlos0/env/v6"
 )
 
 type Config struct {
-	MaxBotToken       string        `env:"MAX_BOT_TOKEN,required"`
-	BackendBaseURL    string        `env:"BACKEND_BASE_URL" envDefault:"http://localhost:8001"`
-	HTTPTimeout       time.Duration `env:"HTTP_TIMEOUT" envDefault:"10s"`
-	OTPExpiry         time.Duration `env:"OTP_EXPIRY" envDefault:"5m"`
-	Environment       string        `env:"ENVIRONMENT" envDefault:"local"`
-	LogLevel          string        `env:"LOG_LEVEL" envDefault:"info"`
-	AdmissionsEmail   string        `env:"ADMISSIONS_EMAIL" envDefault:"admissions@univ.ru"`
-	AdmissionsPhone   string        `env:"ADMISSIONS_PHONE" envDefault:"+7 (812) 555-0101"`
-	AdmissionsOffice  string        `env:"ADMISSIONS_OFFICE" envDefault:"Main Campus, Office 204"`
-	DormPaymentURL    string        `env:"DORM_PAYMENT_URL" envDefault:"https://pay.univ.ru/dorm"`
-	TuitionPaymentURL string        `env:"TUITION_PAYMENT_URL" envDefault:"https://pay.univ.ru/tuition"`
-	ELibraryURL       string        `env:"E_LIBRARY_URL" envDefault:"https://library.univ.ru/ebooks"`
-	SupportEmail      string        `env:"SUPPORT_EMAIL" envDefault:"support@univ.ru"`
+	Messenger             string        `env:"MESSENGER" envDefault:"max"`
+	MaxBotToken           string        `env:"MAX_BOT_TOKEN"`
+	MaxMode               string        `env:"MAX_MODE" envDefault:"polling"`
+	MaxAPIURL             string        `env:"MAX_API_URL" envDefault:"https://botapi.max.ru"`
+	MaxAPIVersion         string        `env:"MAX_API_VERSION" envDefault:"1.2.5"`
+	MaxWebhookURL         string        `env:"MAX_WEBHOOK_URL"`
+	MaxWebhookListen      string        `env:"MAX_WEBHOOK_LISTEN" envDefault:":8080"`
+	MaxWebhookSecret      string        `env:"MAX_WEBHOOK_SECRET"`
+	MaxMessageLimit       int           `env:"MAX_MESSAGE_LIMIT" envDefault:"4000"`
+	TelegramBotToken      string        `env:"TELEGRAM_BOT_TOKEN"`
+	TelegramAPIURL        string        `env:"TELEGRAM_API_URL" envDefault:"https://api.telegram.org"`
+	TelegramMode          string        `env:"TELEGRAM_MODE" envDefault:"polling"`
+	TelegramPollTimeout   time.Duration `env:"TELEGRAM_POLL_TIMEOUT" envDefault:"30s"`
+	TelegramWebhookURL    string        `env:"TELEGRAM_WEBHOOK_URL"`
+	TelegramWebhookListen string        `env:"TELEGRAM_WEBHOOK_LISTEN" envDefault:":8443"`
+	TelegramWebhookSecret string        `env:"TELEGRAM_WEBHOOK_SECRET"`
+	TelegramMessageLimit  int           `env:"TELEGRAM_MESSAGE_LIMIT" envDefault:"4096"`
+	BackendBaseURL        string        `env:"BACKEND_BASE_URL" envDefault:"http://localhost:8001"`
+	BackendToken          string        `env:"BACKEND_TOKEN"`
+	HTTPTimeout           time.Duration `env:"HTTP_TIMEOUT" envDefault:"10s"`
+	BackendMaxRetries     int           `env:"BACKEND_MAX_RETRIES" envDefault:"2"`
+	BackendRetryBackoff   time.Duration `env:"BACKEND_RETRY_BACKOFF" envDefault:"200ms"`
+	BackendMaxBackoff     time.Duration `env:"BACKEND_MAX_BACKOFF" envDefault:"2s"`
+	BreakerThreshold      int           `env:"BACKEND_BREAKER_THRESHOLD" envDefault:"5"`
+	BreakerCooldown       time.Duration `env:"BACKEND_BREAKER_COOLDOWN" envDefault:"30s"`
+	OTPExpiry             time.Duration `env:"OTP_EXPIRY" envDefault:"5m"`
+	OTPMaxAttempts        int           `env:"OTP_MAX_ATTEMPTS" envDefault:"5"`
+	OTPLockout            time.Duration `env:"OTP_LOCKOUT" envDefault:"15m"`
+	OTPResendCooldown     time.Duration `env:"OTP_RESEND_COOLDOWN" envDefault:"60s"`
+	OTPSecret             string        `env:"OTP_SECRET"`
+	LoginEmailDomains     []string      `env:"LOGIN_EMAIL_DOMAINS" envDefault:"univ.ru" envSeparator:","`
+	CallbackSecret        string        `env:"CALLBACK_SECRET"`
+	CallbackTTL           time.Duration `env:"CALLBACK_TTL" envDefault:"24h"`
+	Environment           string        `env:"ENVIRONMENT" envDefault:"local"`
+	LogLevel              string        `env:"LOG_LEVEL" envDefault:"info"`
+	AdmissionsEmail       string        `env:"ADMISSIONS_EMAIL" envDefault:"admissions@univ.ru"`
+	AdmissionsPhone       string        `env:"ADMISSIONS_PHONE" envDefault:"+7 (812) 555-0101"`
+	AdmissionsOffice      string        `env:"ADMISSIONS_OFFICE" envDefault:"Main Campus, Office 204"`
+	DormPaymentURL        string        `env:"DORM_PAYMENT_URL" envDefault:"https://pay.univ.ru/dorm"`
+	TuitionPaymentURL     string        `env:"TUITION_PAYMENT_URL" envDefault:"https://pay.univ.ru/tuition"`
+	ELibraryURL           string        `env:"E_LIBRARY_URL" envDefault:"https://library.univ.ru/ebooks"`
+	SupportEmail          string        `env:"SUPPORT_EMAIL" envDefault:"support@univ.ru"`
+	SessionStore          string        `env:"SESSION_STORE" envDefault:"memory"`
+	SessionDBPath         string        `env:"SESSION_DB_PATH" envDefault:"data/sessions.db"`
+	DatabaseURL           string        `env:"DATABASE_URL"`
+	JanitorInterval       time.Duration `env:"SESSION_JANITOR_INTERVAL" envDefault:"1m"`
+	FormTTL               time.Duration `env:"SESSION_FORM_TTL" envDefault:"30m"`
+	GuestSessionTTL       time.Duration `env:"SESSION_GUEST_TTL" envDefault:"72h"`
+	NotifyExpiry          bool          `env:"SESSION_NOTIFY_EXPIRY" envDefault:"true"`
+	UpdateWorkers         int           `env:"UPDATE_WORKERS" envDefault:"8"`
+	UpdateQueueSize       int           `env:"UPDATE_QUEUE_SIZE" envDefault:"64"`
+	HandlerTimeout        time.Duration `env:"UPDATE_HANDLER_TIMEOUT" envDefault:"60s"`
+	CallbackAckAfter      time.Duration `env:"UPDATE_CALLBACK_ACK_AFTER" envDefault:"2s"`
+	MetricsAddr           string        `env:"METRICS_ADDR"`
+	DeliveryGlobalRate    float64       `env:"DELIVERY_GLOBAL_RATE" envDefault:"25"`
+	DeliveryGlobalBurst   int           `env:"DELIVERY_GLOBAL_BURST" envDefault:"25"`
+	DeliveryChatRate      float64       `env:"DELIVERY_CHAT_RATE" envDefault:"1"`
+	DeliveryChatBurst     int           `env:"DELIVERY_CHAT_BURST" envDefault:"5"`
+	DeliveryMaxRetries    int           `env:"DELIVERY_MAX_RETRIES" envDefault:"4"`
+	DeliveryRetryBackoff  time.Duration `env:"DELIVERY_RETRY_BACKOFF" envDefault:"500ms"`
+	DeliveryMaxBackoff    time.Duration `env:"DELIVERY_MAX_BACKOFF" envDefault:"30s"`
+	DeliveryDeadLetters   string        `env:"DELIVERY_DEAD_LETTER_FILE"`
+	BroadcastRate         float64       `env:"BROADCAST_RATE" envDefault:"10"`
+	BroadcastAdmins       []string      `env:"BROADCAST_ADMINS" envSeparator:","`
+	EmailSender           string        `env:"EMAIL_SENDER" envDefault:"log"`
+	SMTPHost              string        `env:"SMTP_HOST"`
+	SMTPPort              int           `env:"SMTP_PORT" envDefault:"587"`
+	SMTPUsername          string        `env:"SMTP_USERNAME"`
+	SMTPPassword          string        `env:"SMTP_PASSWORD"`
+	SMTPFrom              string        `env:"SMTP_FROM"`
+	SMTPStartTLS          bool          `env:"SMTP_STARTTLS" envDefault:"true"`
+	SMTPTimeout           time.Duration `env:"SMTP_TIMEOUT" envDefault:"10s"`
+	SMTPSendTimeout       time.Duration `env:"SMTP_SEND_TIMEOUT" envDefault:"20s"`
+	SMTPMaxRetries        int           `env:"SMTP_MAX_RETRIES" envDefault:"3"`
+	SMTPRetryBackoff      time.Duration `env:"SMTP_RETRY_BACKOFF" envDefault:"1s"`
 }
 
 func Load() (*Config, error) {
@@ -27,5 +91,49 @@ func Load() (*Config, error) {
 	if err := env.Parse(cfg); err != nil {
 		return nil, err
 	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
+
+var (
+	maxWebhookSecret      = regexp.MustCompile(`^[A-Za-z0-9_-]{5,256}$`)
+	telegramWebhookSecret = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+)
+
+// validate rejects settings the bot must not start with. A webhook without a
+// secret would accept forged updates from anyone who finds the URL.
+func (c *Config) validate() error {
+	var errs []error
+	switch c.Messenger {
+	case "", "max":
+		if c.MaxMode == "webhook" {
+			if c.MaxWebhookURL == "" {
+				errs = append(errs, errors.New("MAX_WEBHOOK_URL is required when MAX_MODE=webhook"))
+			}
+			if !maxWebhookSecret.MatchString(c.MaxWebhookSecret) {
+				errs = append(errs, errors.New("MAX_WEBHOOK_SECRET is required when MAX_MODE=webhook: 5-256 characters of A-Z a-z 0-9 _ -"))
+			}
+		}
+	case "telegram":
+		if c.TelegramMode == "webhook" {
+			if c.TelegramWebhookURL == "" {
+				errs = append(errs, errors.New("TELEGRAM_WEBHOOK_URL is required when TELEGRAM_MODE=webhook"))
+			}
+			if !telegramWebhookSecret.MatchString(c.TelegramWebhookSecret) {
+				errs = append(errs, errors.New("TELEGRAM_WEBHOOK_SECRET is required when TELEGRAM_MODE=webhook: 1-256 characters of A-Z a-z 0-9 _ -"))
+			}
+		}
+	}
+	if c.OTPMaxAttempts < 1 {
+		errs = append(errs, errors.New("OTP_MAX_ATTEMPTS must be at least 1"))
+	}
+	if c.SessionStore == "postgres" && c.OTPSecret == "" {
+		errs = append(errs, errors.New("OTP_SECRET is required with SESSION_STORE=postgres: replicas must share the key codes are hashed with"))
+	}
+	if c.SessionStore == "postgres" && c.CallbackSecret == "" {
+		errs = append(errs, errors.New("CALLBACK_SECRET is required with SESSION_STORE=postgres: replicas must share the key buttons are signed with"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,36 @@
+package config
+
+import "testing"
+
+func TestLoadValidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr bool
+	}{
+		{"max polling", map[string]string{"MAX_MODE": "polling"}, false},
+		{"max webhook without secret", map[string]string{"MAX_MODE": "webhook", "MAX_WEBHOOK_URL": "https://bot.example/hook"}, true},
+		{"max webhook with short secret", map[string]string{"MAX_MODE": "webhook", "MAX_WEBHOOK_URL": "https://bot.example/hook", "MAX_WEBHOOK_SECRET": "abc"}, true},
+		{"max webhook without URL", map[string]string{"MAX_MODE": "webhook", "MAX_WEBHOOK_SECRET": "s3cret-value"}, true},
+		{"max webhook", map[string]string{"MAX_MODE": "webhook", "MAX_WEBHOOK_URL": "https://bot.example/hook", "MAX_WEBHOOK_SECRET": "s3cret-value"}, false},
+		{"telegram webhook without secret", map[string]string{"MESSENGER": "telegram", "TELEGRAM_MODE": "webhook", "TELEGRAM_WEBHOOK_URL": "https://bot.example/tg"}, true},
+		{"telegram webhook with bad secret", map[string]string{"MESSENGER": "telegram", "TELEGRAM_MODE": "webhook", "TELEGRAM_WEBHOOK_URL": "https://bot.example/tg", "TELEGRAM_WEBHOOK_SECRET": "has space"}, true},
+		{"telegram webhook", map[string]string{"MESSENGER": "telegram", "TELEGRAM_MODE": "webhook", "TELEGRAM_WEBHOOK_URL": "https://bot.example/tg", "TELEGRAM_WEBHOOK_SECRET": "x"}, false},
+		{"max settings ignored for telegram", map[string]string{"MESSENGER": "telegram", "MAX_MODE": "webhook"}, false},
+		{"no otp attempts", map[string]string{"OTP_MAX_ATTEMPTS": "0"}, true},
+		{"postgres without otp secret", map[string]string{"SESSION_STORE": "postgres", "CALLBACK_SECRET": "s3cret"}, true},
+		{"postgres without callback secret", map[string]string{"SESSION_STORE": "postgres", "OTP_SECRET": "s3cret"}, true},
+		{"postgres with secrets", map[string]string{"SESSION_STORE": "postgres", "OTP_SECRET": "s3cret", "CALLBACK_SECRET": "s3cret"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_, err := Load()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Load error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "context"
+
+// Actor identifies the bot user on whose behalf a backend call is made.
+type Actor struct {
+	UserID int64
+	ChatID int64
+	Role   Role
+	Email  string
+}
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func ActorFrom(ctx context.Context) (Actor, bool) {
+	actor, ok := ctx.Value(actorKey{}).(Actor)
+	return actor, ok
+}
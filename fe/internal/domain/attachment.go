@@ -0,0 +1,50 @@
+package domain
+
+import (
+	"mime"
+	"path"
+	"strings"
+)
+
+type AttachmentKind string
+
+const (
+	AttachmentFile  AttachmentKind = "file"
+	AttachmentImage AttachmentKind = "image"
+	AttachmentAudio AttachmentKind = "audio"
+	AttachmentVideo AttachmentKind = "video"
+)
+
+// Attachment is a media item received with a message. Token is the
+// platform's reusable file reference, URL a direct download link when the
+// platform exposes one.
+type Attachment struct {
+	Kind     AttachmentKind
+	FileName string
+	MIMEType string
+	Size     int64
+	Token    string
+	URL      string
+}
+
+// Location returns the reference stored by the backend for the attachment.
+func (a Attachment) Location() string {
+	if a.URL != "" {
+		return a.URL
+	}
+	return a.Token
+}
+
+// MIMETypeFromName guesses a MIME type from the file extension, for
+// platforms that only report file names.
+func MIMETypeFromName(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == "" {
+		return ""
+	}
+	mt, _, err := mime.ParseMediaType(mime.TypeByExtension(ext))
+	if err != nil {
+		return ""
+	}
+	return mt
+}
@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// Audience selects broadcast recipients among signed-in users. Empty fields
+// match everyone; the ones that are set must all match.
+type Audience struct {
+	Role         Role
+	Faculty      string
+	ForeignOnly  bool
+	DormBuilding string
+}
+
+// Matches reports whether a user belongs to the audience. building is the
+// user's dorm building, which profiles do not carry.
+func (a Audience) Matches(p *UserProfile, building string) bool {
+	switch {
+	case p == nil:
+		return false
+	case a.Role != "" && !p.HasRole(a.Role):
+		return false
+	case a.Faculty != "" && !strings.EqualFold(p.Faculty, a.Faculty):
+		return false
+	case a.ForeignOnly && !p.IsForeign:
+		return false
+	case a.DormBuilding != "" && !strings.EqualFold(building, a.DormBuilding):
+		return false
+	}
+	return true
+}
+
+type RecipientStatus string
+
+const (
+	RecipientPending RecipientStatus = "pending"
+	RecipientSent    RecipientStatus = "sent"
+	RecipientFailed  RecipientStatus = "failed"
+	// RecipientSkipped marks users who turned notifications off or whose chat
+	// stopped the bot.
+	RecipientSkipped RecipientStatus = "skipped"
+)
+
+type BroadcastRecipient struct {
+	ChatID    int64
+	UserID    int64
+	ProfileID int64
+	Email     string
+	Status    RecipientStatus
+	Error     string
+	SentAt    time.Time
+}
+
+// Broadcast is persisted while it runs so another process can resume it.
+// UpdatedAt and Version are maintained by the store: Version guards saves
+// like Session.Version, and a stale UpdatedAt means nobody is running it.
+type Broadcast struct {
+	ID           int64
+	AuthorChatID int64
+	AuthorEmail  string
+	Text         string
+	Audience     Audience
+	Recipients   []BroadcastRecipient
+	CreatedAt    time.Time
+	FinishedAt   time.Time
+	UpdatedAt    time.Time
+	Version      int64
+}
+
+func (b *Broadcast) Clone() *Broadcast {
+	if b == nil {
+		return nil
+	}
+	clone := *b
+	clone.Recipients = append([]BroadcastRecipient(nil), b.Recipients...)
+	return &clone
+}
+
+// Tally counts recipients by status.
+func (b *Broadcast) Tally() map[RecipientStatus]int {
+	counts := make(map[RecipientStatus]int, 4)
+	for _, r := range b.Recipients {
+		counts[r.Status]++
+	}
+	return counts
+}
@@ -0,0 +1,37 @@
+package domain
+
+import "testing"
+
+func TestAudienceMatches(t *testing.T) {
+	student := &UserProfile{ID: 1, Role: RoleStudent, Faculty: "Physics", IsForeign: true}
+	teacher := &UserProfile{ID: 2, Role: RoleEmployee, Roles: []Role{RoleLeadership}, Faculty: "Math"}
+	tests := []struct {
+		name     string
+		aud      Audience
+		profile  *UserProfile
+		building string
+		want     bool
+	}{
+		{"everyone", Audience{}, student, "", true},
+		{"signed out", Audience{}, nil, "", false},
+		{"primary role", Audience{Role: RoleStudent}, student, "", true},
+		{"other role", Audience{Role: RoleEmployee}, student, "", false},
+		{"additional role", Audience{Role: RoleLeadership}, teacher, "", true},
+		{"faculty ignores case", Audience{Faculty: "physics"}, student, "", true},
+		{"other faculty", Audience{Faculty: "Math"}, student, "", false},
+		{"foreign", Audience{ForeignOnly: true}, student, "", true},
+		{"not foreign", Audience{ForeignOnly: true}, teacher, "", false},
+		{"dorm building", Audience{DormBuilding: "B"}, student, "b", true},
+		{"other building", Audience{DormBuilding: "B"}, student, "A", false},
+		{"no dorm", Audience{DormBuilding: "B"}, student, "", false},
+		{"all criteria", Audience{Role: RoleStudent, Faculty: "Physics", ForeignOnly: true, DormBuilding: "B"}, student, "B", true},
+		{"one criterion fails", Audience{Role: RoleStudent, Faculty: "Math", ForeignOnly: true}, student, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.aud.Matches(tt.profile, tt.building); got != tt.want {
+				t.Errorf("Matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ type UserProfile struct {
 	NameRU     string    `json:"full_name_ru"`
 	NameEN     string    `json:"full_name_en"`
 	Role       Role      `json:"role"`
+	Roles      []Role    `json:"roles"`
 	Language   Language  `json:"language"`
 	IsForeign  bool      `json:"is_foreign"`
 	DormRoom   string    `json:"dorm_room"`
@@ -16,6 +17,32 @@ type UserProfile struct {
 	LastActive time.Time `json:"last_active"`
 }
 
+// AvailableRoles returns every role the user may act as, primary role first.
+func (p *UserProfile) AvailableRoles() []Role {
+	if p == nil {
+		return nil
+	}
+	roles := make([]Role, 0, len(p.Roles)+1)
+	seen := make(map[Role]bool, len(p.Roles)+1)
+	for _, r := range append([]Role{p.Role}, p.Roles...) {
+		if r == "" || seen[r] {
+			continue
+		}
+		seen[r] = true
+		roles = append(roles, r)
+	}
+	return roles
+}
+
+func (p *UserProfile) HasRole(role Role) bool {
+	for _, r := range p.AvailableRoles() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 type ScheduleEntry struct {
 	SessionID   int64     `json:"session_id"`
 	SessionType string    `json:"session_type"`
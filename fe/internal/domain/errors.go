@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ErrNotFound is returned by the backend when the requested entity does not exist.
+var ErrNotFound = errors.New("not found")
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	// ErrConflict is returned when the backend rejects a write because of the
+	// entity's current state, e.g. an event that is fully booked.
+	ErrConflict = errors.New("conflict")
+)
+
+// ErrTemporary marks messenger and backend failures worth retrying: network
+// errors and server-side faults.
+var ErrTemporary = errors.New("temporary failure")
+
+// ErrNotSent marks messenger failures that happened before the request
+// reached the platform. Only these are safe to retry for new messages: after
+// a timeout or a server error the message may already have been delivered.
+var ErrNotSent = errors.New("request not sent")
+
+// DialFailed reports whether err happened while connecting, before any of
+// the request was written.
+func DialFailed(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr)
+}
+
+// RateLimitError is returned by messengers when the platform throttles the
+// bot. RetryAfter is the platform's hint and zero when it gave none.
+type RateLimitError struct {
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited (retry after %s): %v", e.RetryAfter, e.Err)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// UnavailableError is returned by the backend client when a backend subsystem
+// keeps failing or its circuit breaker is open. Subsystem is the API section,
+// e.g. "schedule" or "events".
+type UnavailableError struct {
+	Subsystem string
+	Err       error
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s service unavailable: %v", e.Subsystem, e.Err)
+}
+
+func (e *UnavailableError) Unwrap() error {
+	return e.Err
+}
@@ -4,7 +4,16 @@ type OutgoingMessage struct {
 	Text      string
 	ParseMode string
 	Keyboard  *Keyboard
-	Reset     bool
+	// Reset starts the conversation view over: the previous menu message is
+	// removed before this one is sent.
+	Reset bool
+}
+
+// CallbackAnswer is shown to the user for a tapped inline button. An empty
+// answer leaves the platform default; Alert asks for a modal instead of a toast.
+type CallbackAnswer struct {
+	Text  string
+	Alert bool
 }
 
 type Keyboard struct {
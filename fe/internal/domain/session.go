@@ -1,32 +1,115 @@
 package domain
 
-import "time"
+import (
+	"reflect"
+	"time"
+)
 
 type Session struct {
-	ChatID                    int64
-	UserID                    int64
-	Language                  Language
-	Role                      Role
-	Stage                     Stage
-	Email                     string
-	Profile                   *UserProfile
-	CurrentMenu               string
-	PendingAction             *PendingAction
-	PendingOTP                *PendingOTP
-	PendingEventID            int64
-	PendingVisaApplicationID  int64
-	NotificationsEnabled      bool
-	LastActivity              time.Time
+	ChatID                   int64
+	UserID                   int64
+	Language                 Language
+	Role                     Role
+	Stage                    Stage
+	Email                    string
+	Profile                  *UserProfile
+	CurrentMenu              string
+	MenuMessageID            string
+	PendingAction            *PendingAction
+	PendingOTP               *PendingOTP
+	PendingEventID           int64
+	PendingVisaApplicationID int64
+	// AdmissionApplicationID is the application that documents uploaded from
+	// this chat are attached to; it belongs to AdmissionEmail.
+	AdmissionApplicationID int64
+	AdmissionEmail         string
+	// NotificationsDisabled is the user's opt-out; the zero value keeps
+	// notifications on, including for sessions stored before the setting
+	// took effect.
+	NotificationsDisabled bool
+	// Suspended is set while the chat has blocked or removed the bot; nothing
+	// is sent to it until the user comes back.
+	Suspended    bool
+	StartPayload string
+	LoggedInAt   time.Time
+	LastActivity time.Time
+	Version      int64
 }
 
 type PendingOTP struct {
-	Code      string
+	// Email is the address the code was sent to.
+	Email     string
+	CodeHash  string
+	Salt      string
+	Attempts  int
+	SentAt    time.Time
 	ExpiresAt time.Time
 }
 
+// OTPFailures counts failed code entries for one email across all chats and
+// remembers when a code was last sent to it, so the resend cooldown holds no
+// matter which chat asks.
+type OTPFailures struct {
+	Count       int
+	LastFailure time.Time
+	LockedUntil time.Time
+	LastSent    time.Time
+}
+
+func (f OTPFailures) IsZero() bool {
+	return f.Count == 0 && f.LastSent.IsZero()
+}
+
 type PendingAction struct {
 	ID        ActionID
 	Step      int
 	Data      map[string]string
 	StartedAt time.Time
 }
+
+// Clone returns a deep copy so callers can mutate a session without touching
+// the instance held by a store.
+func (s *Session) Clone() *Session {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	if s.Profile != nil {
+		p := *s.Profile
+		p.Roles = append([]Role(nil), s.Profile.Roles...)
+		c.Profile = &p
+	}
+	if s.PendingOTP != nil {
+		otp := *s.PendingOTP
+		c.PendingOTP = &otp
+	}
+	if s.PendingAction != nil {
+		pa := *s.PendingAction
+		if s.PendingAction.Data != nil {
+			pa.Data = make(map[string]string, len(s.PendingAction.Data))
+			for k, v := range s.PendingAction.Data {
+				pa.Data[k] = v
+			}
+		}
+		c.PendingAction = &pa
+	}
+	return &c
+}
+
+// Rebase re-applies onto s the changes that turned base into changed. An
+// update uses it to keep its own edits when someone else stored the session
+// after it was loaded. Version and LastActivity belong to the store and are
+// left alone.
+func (s *Session) Rebase(base, changed *Session) {
+	dst := reflect.ValueOf(s).Elem()
+	from, to := reflect.ValueOf(base).Elem(), reflect.ValueOf(changed).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		switch dst.Type().Field(i).Name {
+		case "Version", "LastActivity":
+			continue
+		}
+		if !reflect.DeepEqual(from.Field(i).Interface(), to.Field(i).Interface()) {
+			dst.Field(i).Set(to.Field(i))
+		}
+	}
+}
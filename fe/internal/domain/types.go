@@ -48,7 +48,13 @@ const (
 	UpdateTypeMessage  UpdateType = "message"
 	UpdateTypeCallback UpdateType = "callback"
 	UpdateTypeContact  UpdateType = "contact"
-	UpdateTypeUnknown  UpdateType = "unknown"
+	// UpdateTypeStarted is the user opening the bot; Payload carries the
+	// deep-link start parameter, if any.
+	UpdateTypeStarted UpdateType = "started"
+	// UpdateTypeStopped means the chat can no longer be written to: the user
+	// blocked the bot or removed it from the chat.
+	UpdateTypeStopped UpdateType = "stopped"
+	UpdateTypeUnknown UpdateType = "unknown"
 )
 
 type ButtonKind string
@@ -57,6 +63,8 @@ const (
 	ButtonKindCallback ButtonKind = "callback"
 	ButtonKindLink     ButtonKind = "link"
 	ButtonKindCommand  ButtonKind = "command"
+	// ButtonKindContact asks the user to share their phone number.
+	ButtonKindContact ButtonKind = "contact"
 )
 
 type ButtonStyle string
@@ -1,12 +1,22 @@
 package domain
 
 type Update struct {
-	Type       UpdateType
-	ChatID     int64
-	UserID     int64
-	Text       string
-	Payload    string
-	MessageID  string
-	Language   Language
-	Raw        any
+	Type        UpdateType
+	ChatID      int64
+	UserID      int64
+	Text        string
+	Payload     string
+	MessageID   string
+	Attachments []Attachment
+	Contact     *Contact
+	Language    Language
+	Raw         any
+}
+
+// Contact is a phone contact shared by the user. UserID is the messenger user
+// the contact belongs to, when the platform reports it.
+type Contact struct {
+	Phone  string
+	Name   string
+	UserID int64
 }
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"io"
 	"os"
 	"strings"
 	"time"
@@ -9,12 +10,17 @@ import (
 )
 
 func New(level string) zerolog.Logger {
+	return NewTo(os.Stdout, level)
+}
+
+// NewTo is New writing to out, e.g. stderr when stdout is taken by the console messenger.
+func NewTo(out io.Writer, level string) zerolog.Logger {
 	lvl, err := zerolog.ParseLevel(strings.ToLower(level))
 	if err != nil {
 		lvl = zerolog.InfoLevel
 	}
 	output := zerolog.ConsoleWriter{
-		Out:        os.Stdout,
+		Out:        out,
 		TimeFormat: time.RFC3339,
 	}
 	log := zerolog.New(output).Level(lvl).With().Timestamp().Logger()
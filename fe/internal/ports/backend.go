@@ -33,7 +33,10 @@ type Backend interface {
 	CreateDeanRequest(ctx context.Context, userID int64, requestType string, payload map[string]any) (int64, error)
 
 	GetDormRoom(ctx context.Context, studentID int64) (*domain.DormRoom, error)
-	CreateDormMaintenance(ctx context.Context, studentID int64, requestType, description string) (int64, error)
+	// ListDormRooms returns the room assignments of the given students;
+	// students without one are left out.
+	ListDormRooms(ctx context.Context, studentIDs []int64) ([]domain.DormRoom, error)
+	CreateDormMaintenance(ctx context.Context, studentID int64, requestType, description, attachmentURL string) (int64, error)
 	SubmitDormPayment(ctx context.Context, studentID int64, amount float64, reference string) (int64, error)
 
 	SearchBooks(ctx context.Context, q string) ([]domain.LibraryBook, error)
@@ -7,6 +7,12 @@ import (
 )
 
 type Messenger interface {
-	Start(ctx context.Context, handler func(context.Context, domain.Update) error) error
-	Send(ctx context.Context, chatID, userID int64, msg domain.OutgoingMessage) error
+	// Start delivers updates to handler. For callback updates the adapter
+	// sends the returned answer back to the platform.
+	Start(ctx context.Context, handler func(context.Context, domain.Update) (domain.CallbackAnswer, error)) error
+	// Send delivers a new message and returns its platform message ID.
+	Send(ctx context.Context, chatID, userID int64, msg domain.OutgoingMessage) (string, error)
+	// Edit replaces the text and keyboard of a message sent earlier by the bot.
+	Edit(ctx context.Context, chatID int64, messageID string, msg domain.OutgoingMessage) error
+	Delete(ctx context.Context, chatID int64, messageID string) error
 }
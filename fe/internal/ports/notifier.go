@@ -1,7 +1,11 @@
 package ports
 
-import "context"
+import (
+	"context"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
 
 type EmailSender interface {
-	SendOTP(ctx context.Context, email, code string) error
+	SendOTP(ctx context.Context, email, code string, lang domain.Language) error
 }
@@ -0,0 +1,300 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+var (
+	sessionsBucket    = []byte("sessions")
+	broadcastsBucket  = []byte("broadcasts")
+	otpFailuresBucket = []byte("otp_failures")
+)
+
+// BoltStore keeps sessions in an embedded BoltDB file so they survive restarts.
+type BoltStore struct {
+	now func() time.Time
+	log zerolog.Logger
+	db  *bolt.DB
+}
+
+var _ Store = (*BoltStore)(nil)
+
+func NewBoltStore(path string, now func() time.Time, log zerolog.Logger) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create session db dir: %w", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open session db: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{sessionsBucket, broadcastsBucket, otpFailuresBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("init session buckets: %w", err)
+	}
+	return &BoltStore{
+		now: now,
+		log: log,
+		db:  db,
+	}, nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *BoltStore) Get(chatID int64) (*domain.Session, bool) {
+	var sess *domain.Session
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(sessionsBucket).Get(idKey(chatID))
+		if raw == nil {
+			return nil
+		}
+		sess = &domain.Session{}
+		return json.Unmarshal(raw, sess)
+	})
+	if err != nil {
+		s.log.Error().Err(err).Int64("chat_id", chatID).Msg("failed to load session")
+		return nil, false
+	}
+	return sess, sess != nil
+}
+
+func (s *BoltStore) Save(session *domain.Session) error {
+	next := session.Clone()
+	next.LastActivity = s.now()
+	next.Version++
+	raw, err := json.Marshal(next)
+	if err != nil {
+		return fmt.Errorf("encode session: %w", err)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+		key := idKey(session.ChatID)
+		var stored int64
+		if current := bucket.Get(key); current != nil {
+			var head struct{ Version int64 }
+			if err := json.Unmarshal(current, &head); err != nil {
+				return fmt.Errorf("decode stored session: %w", err)
+			}
+			stored = head.Version
+		} else if session.Version != 0 {
+			return ErrVersionConflict
+		}
+		if stored != session.Version {
+			return ErrVersionConflict
+		}
+		return bucket.Put(key, raw)
+	})
+	if errors.Is(err, ErrVersionConflict) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("save session: %w", err)
+	}
+	session.LastActivity = next.LastActivity
+	session.Version = next.Version
+	return nil
+}
+
+func (s *BoltStore) Update(chatID int64, fn func(*domain.Session) error) (*domain.Session, error) {
+	return update(s, chatID, fn)
+}
+
+func (s *BoltStore) Delete(chatID int64) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).Delete(idKey(chatID))
+	})
+	if err != nil {
+		s.log.Error().Err(err).Int64("chat_id", chatID).Msg("failed to delete session")
+	}
+}
+
+func (s *BoltStore) DeleteVersion(chatID, version int64) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+		key := idKey(chatID)
+		current := bucket.Get(key)
+		if current == nil {
+			return ErrSessionNotFound
+		}
+		var head struct{ Version int64 }
+		if err := json.Unmarshal(current, &head); err != nil {
+			return fmt.Errorf("decode stored session: %w", err)
+		}
+		if head.Version != version {
+			return ErrVersionConflict
+		}
+		return bucket.Delete(key)
+	})
+	if err != nil && !errors.Is(err, ErrVersionConflict) && !errors.Is(err, ErrSessionNotFound) {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return err
+}
+
+func (s *BoltStore) All() []*domain.Session {
+	var items []*domain.Session
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(sessionsBucket).ForEach(func(k, v []byte) error {
+			sess := &domain.Session{}
+			if err := json.Unmarshal(v, sess); err != nil {
+				s.log.Warn().Err(err).Bytes("key", k).Msg("skipping corrupted session")
+				return nil
+			}
+			items = append(items, sess)
+			return nil
+		})
+	})
+	if err != nil {
+		s.log.Error().Err(err).Msg("failed to list sessions")
+	}
+	return items
+}
+
+func (s *BoltStore) CreateBroadcast(b *domain.Broadcast) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(broadcastsBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		next := b.Clone()
+		next.ID = int64(id)
+		next.UpdatedAt = s.now()
+		next.Version = 1
+		raw, err := json.Marshal(next)
+		if err != nil {
+			return fmt.Errorf("encode broadcast: %w", err)
+		}
+		if err := bucket.Put(idKey(next.ID), raw); err != nil {
+			return err
+		}
+		b.ID, b.UpdatedAt, b.Version = next.ID, next.UpdatedAt, next.Version
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("create broadcast: %w", err)
+	}
+	return nil
+}
+
+func (s *BoltStore) SaveBroadcast(b *domain.Broadcast) error {
+	next := b.Clone()
+	next.UpdatedAt = s.now()
+	next.Version++
+	raw, err := json.Marshal(next)
+	if err != nil {
+		return fmt.Errorf("encode broadcast: %w", err)
+	}
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(broadcastsBucket)
+		key := idKey(b.ID)
+		current := bucket.Get(key)
+		if current == nil {
+			return ErrVersionConflict
+		}
+		var head struct{ Version int64 }
+		if err := json.Unmarshal(current, &head); err != nil {
+			return fmt.Errorf("decode stored broadcast: %w", err)
+		}
+		if head.Version != b.Version {
+			return ErrVersionConflict
+		}
+		return bucket.Put(key, raw)
+	})
+	if errors.Is(err, ErrVersionConflict) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("save broadcast: %w", err)
+	}
+	b.UpdatedAt, b.Version = next.UpdatedAt, next.Version
+	return nil
+}
+
+func (s *BoltStore) UnfinishedBroadcasts() []*domain.Broadcast {
+	var items []*domain.Broadcast
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(broadcastsBucket).ForEach(func(k, v []byte) error {
+			b := &domain.Broadcast{}
+			if err := json.Unmarshal(v, b); err != nil {
+				s.log.Warn().Err(err).Bytes("key", k).Msg("skipping corrupted broadcast")
+				return nil
+			}
+			if b.FinishedAt.IsZero() {
+				items = append(items, b)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		s.log.Error().Err(err).Msg("failed to list broadcasts")
+	}
+	return items
+}
+
+func (s *BoltStore) OTPFailures(email string) (domain.OTPFailures, error) {
+	var f domain.OTPFailures
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(otpFailuresBucket).Get([]byte(email))
+		if raw == nil {
+			return nil
+		}
+		return json.Unmarshal(raw, &f)
+	})
+	if err != nil {
+		return domain.OTPFailures{}, fmt.Errorf("load otp failures: %w", err)
+	}
+	return f, nil
+}
+
+func (s *BoltStore) UpdateOTPFailures(email string, fn func(domain.OTPFailures) domain.OTPFailures) (domain.OTPFailures, error) {
+	var next domain.OTPFailures
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(otpFailuresBucket)
+		var current domain.OTPFailures
+		if raw := bucket.Get([]byte(email)); raw != nil {
+			if err := json.Unmarshal(raw, &current); err != nil {
+				return fmt.Errorf("decode stored otp failures: %w", err)
+			}
+		}
+		next = fn(current)
+		if next.IsZero() {
+			return bucket.Delete([]byte(email))
+		}
+		raw, err := json.Marshal(next)
+		if err != nil {
+			return fmt.Errorf("encode otp failures: %w", err)
+		}
+		return bucket.Put([]byte(email), raw)
+	})
+	if err != nil {
+		return domain.OTPFailures{}, fmt.Errorf("update otp failures: %w", err)
+	}
+	return next, nil
+}
+
+func idKey(id int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
@@ -0,0 +1,153 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// ExpiryReason tells an OnExpire hook what was cleared from a session.
+type ExpiryReason string
+
+const (
+	ExpiredForm ExpiryReason = "form"
+	ExpiredOTP  ExpiryReason = "otp"
+)
+
+type JanitorConfig struct {
+	Interval time.Duration
+	FormTTL  time.Duration
+	GuestTTL time.Duration
+}
+
+// Janitor periodically clears abandoned OTP and form state and drops guest
+// sessions that have been idle for longer than GuestTTL.
+type Janitor struct {
+	store    Store
+	cfg      JanitorConfig
+	now      func() time.Time
+	log      zerolog.Logger
+	onExpire func(ctx context.Context, sess *domain.Session, reasons []ExpiryReason)
+}
+
+func NewJanitor(store Store, cfg JanitorConfig, now func() time.Time, log zerolog.Logger) *Janitor {
+	return &Janitor{
+		store: store,
+		cfg:   cfg,
+		now:   now,
+		log:   log,
+	}
+}
+
+// OnExpire registers a hook called after a session has been cleaned up.
+func (j *Janitor) OnExpire(fn func(ctx context.Context, sess *domain.Session, reasons []ExpiryReason)) {
+	j.onExpire = fn
+}
+
+func (j *Janitor) Run(ctx context.Context) error {
+	if j.cfg.Interval <= 0 {
+		return nil
+	}
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			j.Sweep(ctx)
+		}
+	}
+}
+
+func (j *Janitor) Sweep(ctx context.Context) {
+	now := j.now()
+	var cleaned, dropped int
+	for _, sess := range j.store.All() {
+		if j.idleGuest(sess, now) {
+			if j.dropGuest(sess.ChatID, now) {
+				dropped++
+			}
+			continue
+		}
+
+		if len(j.expire(sess, now)) == 0 {
+			continue
+		}
+		var reasons []ExpiryReason
+		updated, err := j.store.Update(sess.ChatID, func(fresh *domain.Session) error {
+			reasons = j.expire(fresh, now)
+			if len(reasons) == 0 {
+				return errNothingExpired
+			}
+			return nil
+		})
+		if errors.Is(err, errNothingExpired) || errors.Is(err, ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			j.log.Warn().Err(err).Int64("chat_id", sess.ChatID).Msg("janitor failed to save session")
+			continue
+		}
+		cleaned++
+		if j.onExpire != nil {
+			j.onExpire(ctx, updated, reasons)
+		}
+	}
+	if cleaned > 0 || dropped > 0 {
+		j.log.Info().Int("cleaned", cleaned).Int("dropped", dropped).Msg("session janitor sweep")
+	}
+}
+
+var errNothingExpired = errors.New("nothing expired")
+
+func (j *Janitor) idleGuest(sess *domain.Session, now time.Time) bool {
+	return sess.Profile == nil && j.cfg.GuestTTL > 0 && now.Sub(sess.LastActivity) > j.cfg.GuestTTL
+}
+
+// dropGuest deletes an idle guest session. The listing may be stale: the
+// guest may have signed in or written since, so the check is repeated on a
+// fresh copy and the delete only goes through if nothing changed after it.
+func (j *Janitor) dropGuest(chatID int64, now time.Time) bool {
+	fresh, ok := j.store.Get(chatID)
+	if !ok || !j.idleGuest(fresh, now) {
+		return false
+	}
+	err := j.store.DeleteVersion(chatID, fresh.Version)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrVersionConflict), errors.Is(err, ErrSessionNotFound):
+		return false
+	default:
+		j.log.Warn().Err(err).Int64("chat_id", chatID).Msg("janitor failed to delete guest session")
+		return false
+	}
+}
+
+// expire clears stale state on sess and reports what was removed. It runs on
+// a fresh snapshot inside Store.Update so a concurrent handler is never
+// overwritten.
+func (j *Janitor) expire(sess *domain.Session, now time.Time) []ExpiryReason {
+	var reasons []ExpiryReason
+	if sess.PendingOTP != nil && now.After(sess.PendingOTP.ExpiresAt) {
+		sess.PendingOTP = nil
+		if sess.Stage == domain.StageAwaitOTP {
+			sess.Stage = domain.StageCollectEmail
+		}
+		reasons = append(reasons, ExpiredOTP)
+	}
+	idle := now.Sub(sess.LastActivity)
+	if j.cfg.FormTTL > 0 && idle > j.cfg.FormTTL &&
+		(sess.PendingAction != nil || sess.PendingEventID != 0 || sess.PendingVisaApplicationID != 0) {
+		sess.PendingAction = nil
+		sess.PendingEventID = 0
+		sess.PendingVisaApplicationID = 0
+		reasons = append(reasons, ExpiredForm)
+	}
+	return reasons
+}
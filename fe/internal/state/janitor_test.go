@@ -0,0 +1,163 @@
+package state
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// snapshotStore lists the sessions as they were when snapshot was taken, as
+// a sweep that races with handlers sees them.
+type snapshotStore struct {
+	Store
+	snapshot []*domain.Session
+}
+
+func (s *snapshotStore) All() []*domain.Session { return s.snapshot }
+
+func TestJanitorDropsOnlyIdleGuests(t *testing.T) {
+	tests := []struct {
+		name     string
+		meantime func(t *testing.T, store Store)
+		kept     bool
+	}{
+		{"idle guest", func(*testing.T, Store) {}, false},
+		{"signed in meanwhile", func(t *testing.T, store Store) {
+			if _, err := store.Update(1, func(sess *domain.Session) error {
+				sess.Profile = &domain.UserProfile{ID: 1}
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"active meanwhile", func(t *testing.T, store Store) {
+			if _, err := store.Update(1, func(*domain.Session) error { return nil }); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+		{"deleted meanwhile", func(_ *testing.T, store Store) { store.Delete(1) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := time.Now()
+			store := NewMemoryStore(func() time.Time { return clock })
+			if err := store.Save(&domain.Session{ChatID: 1}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.Save(&domain.Session{ChatID: 2, Profile: &domain.UserProfile{ID: 2}}); err != nil {
+				t.Fatal(err)
+			}
+			stale := &snapshotStore{Store: store, snapshot: store.All()}
+
+			clock = clock.Add(2 * time.Hour)
+			tt.meantime(t, store)
+			janitor := NewJanitor(stale, JanitorConfig{GuestTTL: time.Hour}, func() time.Time { return clock.Add(time.Minute) }, zerolog.Nop())
+			janitor.Sweep(context.Background())
+
+			_, kept := store.Get(1)
+			if kept != tt.kept {
+				t.Errorf("guest kept = %v, want %v", kept, tt.kept)
+			}
+			if _, ok := store.Get(2); !ok {
+				t.Errorf("signed-in session dropped")
+			}
+		})
+	}
+}
+
+func TestJanitorExpiresAbandonedState(t *testing.T) {
+	start := time.Now()
+	otp := func(expiresIn time.Duration) *domain.PendingOTP {
+		return &domain.PendingOTP{Email: "anna@univ.ru", CodeHash: "hash", ExpiresAt: start.Add(expiresIn)}
+	}
+	tests := []struct {
+		name        string
+		sess        domain.Session
+		wantReasons []ExpiryReason
+		want        func(t *testing.T, sess *domain.Session)
+	}{
+		{
+			name:        "expired code",
+			sess:        domain.Session{Stage: domain.StageAwaitOTP, PendingOTP: otp(time.Minute)},
+			wantReasons: []ExpiryReason{ExpiredOTP},
+			want: func(t *testing.T, sess *domain.Session) {
+				if sess.PendingOTP != nil || sess.Stage != domain.StageCollectEmail {
+					t.Errorf("otp = %v, stage %q, want no code and stage %q", sess.PendingOTP, sess.Stage, domain.StageCollectEmail)
+				}
+			},
+		},
+		{
+			name: "live code",
+			sess: domain.Session{Stage: domain.StageAwaitOTP, PendingOTP: otp(3 * time.Hour)},
+			want: func(t *testing.T, sess *domain.Session) {
+				if sess.PendingOTP == nil || sess.Stage != domain.StageAwaitOTP {
+					t.Errorf("live code cleared: otp = %v, stage %q", sess.PendingOTP, sess.Stage)
+				}
+			},
+		},
+		{
+			name:        "abandoned form",
+			sess:        domain.Session{PendingAction: &domain.PendingAction{ID: domain.ActionBroadcast, Step: 1}},
+			wantReasons: []ExpiryReason{ExpiredForm},
+			want: func(t *testing.T, sess *domain.Session) {
+				if sess.PendingAction != nil {
+					t.Errorf("abandoned form kept: %+v", sess.PendingAction)
+				}
+			},
+		},
+		{
+			name:        "abandoned event booking",
+			sess:        domain.Session{PendingEventID: 7, PendingVisaApplicationID: 3},
+			wantReasons: []ExpiryReason{ExpiredForm},
+			want: func(t *testing.T, sess *domain.Session) {
+				if sess.PendingEventID != 0 || sess.PendingVisaApplicationID != 0 {
+					t.Errorf("pending IDs kept: event %d, visa %d", sess.PendingEventID, sess.PendingVisaApplicationID)
+				}
+			},
+		},
+		{
+			name:        "code and form",
+			sess:        domain.Session{Stage: domain.StageAwaitOTP, PendingOTP: otp(time.Minute), PendingEventID: 7},
+			wantReasons: []ExpiryReason{ExpiredOTP, ExpiredForm},
+			want: func(t *testing.T, sess *domain.Session) {
+				if sess.PendingOTP != nil || sess.PendingEventID != 0 {
+					t.Errorf("state kept: otp = %v, event %d", sess.PendingOTP, sess.PendingEventID)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := start
+			store := NewMemoryStore(func() time.Time { return clock })
+			sess := tt.sess
+			sess.ChatID = 1
+			sess.Profile = &domain.UserProfile{ID: 1}
+			if err := store.Save(&sess); err != nil {
+				t.Fatal(err)
+			}
+
+			clock = start.Add(2 * time.Hour)
+			janitor := NewJanitor(store, JanitorConfig{FormTTL: time.Hour}, func() time.Time { return clock }, zerolog.Nop())
+			var gotReasons []ExpiryReason
+			janitor.OnExpire(func(_ context.Context, _ *domain.Session, reasons []ExpiryReason) {
+				gotReasons = reasons
+			})
+			janitor.Sweep(context.Background())
+
+			if !slices.Equal(gotReasons, tt.wantReasons) {
+				t.Errorf("expiry reasons = %v, want %v", gotReasons, tt.wantReasons)
+			}
+			got, ok := store.Get(1)
+			if !ok {
+				t.Fatal("session deleted")
+			}
+			tt.want(t, got)
+		})
+	}
+}
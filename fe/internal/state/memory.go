@@ -1,29 +1,98 @@
 package state
 
 import (
+	"errors"
 	"sync"
 	"time"
 
 	"github.com/escalopa/inno-vkode/internal/domain"
 )
 
+var (
+	ErrVersionConflict = errors.New("session was modified concurrently")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// Store hands out session snapshots: mutating a session returned by Get or
+// All never affects the stored copy until it is passed to Save. Save is a
+// compare-and-swap on Session.Version and fails with ErrVersionConflict when
+// the session was written by someone else in the meantime.
 type Store interface {
 	Get(chatID int64) (*domain.Session, bool)
-	Save(session *domain.Session)
+	Save(session *domain.Session) error
+	Update(chatID int64, fn func(*domain.Session) error) (*domain.Session, error)
 	Delete(chatID int64)
+	// DeleteVersion deletes the session only while it is still at version,
+	// so a decision taken on a snapshot cannot remove a session written
+	// since. It fails with ErrVersionConflict or ErrSessionNotFound.
+	DeleteVersion(chatID, version int64) error
 	All() []*domain.Session
+	BroadcastStore
+	OTPFailureStore
+}
+
+// BroadcastStore keeps broadcasts next to the sessions they are addressed to,
+// so one interrupted by a restart can be resumed. CreateBroadcast assigns the
+// ID; SaveBroadcast is a compare-and-swap on Broadcast.Version like Save.
+type BroadcastStore interface {
+	CreateBroadcast(b *domain.Broadcast) error
+	SaveBroadcast(b *domain.Broadcast) error
+	UnfinishedBroadcasts() []*domain.Broadcast
+}
+
+// OTPFailureStore keeps failed login attempts per email in the shared store,
+// so all replicas enforce one budget. UpdateOTPFailures applies fn to the
+// stored record atomically, starting from the zero record; a zero result
+// removes it.
+type OTPFailureStore interface {
+	OTPFailures(email string) (domain.OTPFailures, error)
+	UpdateOTPFailures(email string, fn func(domain.OTPFailures) domain.OTPFailures) (domain.OTPFailures, error)
+}
+
+const maxUpdateAttempts = 5
+
+// update implements Store.Update on top of Get and a CAS Save, retrying when
+// a concurrent writer wins the race.
+func update(s Store, chatID int64, fn func(*domain.Session) error) (*domain.Session, error) {
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		sess, ok := s.Get(chatID)
+		if !ok {
+			return nil, ErrSessionNotFound
+		}
+		if err := fn(sess); err != nil {
+			return nil, err
+		}
+		err := s.Save(sess)
+		if errors.Is(err, ErrVersionConflict) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return sess, nil
+	}
+	return nil, ErrVersionConflict
 }
 
 type MemoryStore struct {
 	now func() time.Time
 	mu  sync.RWMutex
 	db  map[int64]*domain.Session
+
+	broadcasts   map[int64]*domain.Broadcast
+	broadcastSeq int64
+
+	otpFailures map[string]domain.OTPFailures
 }
 
+var _ Store = (*MemoryStore)(nil)
+
 func NewMemoryStore(now func() time.Time) *MemoryStore {
 	return &MemoryStore{
-		now: now,
-		db:  make(map[int64]*domain.Session),
+		now:         now,
+		db:          make(map[int64]*domain.Session),
+		broadcasts:  make(map[int64]*domain.Broadcast),
+		otpFailures: make(map[string]domain.OTPFailures),
 	}
 }
 
@@ -31,16 +100,26 @@ func (s *MemoryStore) Get(chatID int64) (*domain.Session, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if sess, ok := s.db[chatID]; ok {
-		return sess, true
+		return sess.Clone(), true
 	}
 	return nil, false
 }
 
-func (s *MemoryStore) Save(session *domain.Session) {
+func (s *MemoryStore) Save(session *domain.Session) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	current, ok := s.db[session.ChatID]
+	if (ok && current.Version != session.Version) || (!ok && session.Version != 0) {
+		return ErrVersionConflict
+	}
 	session.LastActivity = s.now()
-	s.db[session.ChatID] = session
+	session.Version++
+	s.db[session.ChatID] = session.Clone()
+	return nil
+}
+
+func (s *MemoryStore) Update(chatID int64, fn func(*domain.Session) error) (*domain.Session, error) {
+	return update(s, chatID, fn)
 }
 
 func (s *MemoryStore) Delete(chatID int64) {
@@ -49,12 +128,80 @@ func (s *MemoryStore) Delete(chatID int64) {
 	delete(s.db, chatID)
 }
 
+func (s *MemoryStore) DeleteVersion(chatID, version int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.db[chatID]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if current.Version != version {
+		return ErrVersionConflict
+	}
+	delete(s.db, chatID)
+	return nil
+}
+
 func (s *MemoryStore) All() []*domain.Session {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	items := make([]*domain.Session, 0, len(s.db))
 	for _, sess := range s.db {
-		items = append(items, sess)
+		items = append(items, sess.Clone())
 	}
 	return items
 }
+
+func (s *MemoryStore) CreateBroadcast(b *domain.Broadcast) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broadcastSeq++
+	b.ID = s.broadcastSeq
+	b.UpdatedAt = s.now()
+	b.Version = 1
+	s.broadcasts[b.ID] = b.Clone()
+	return nil
+}
+
+func (s *MemoryStore) SaveBroadcast(b *domain.Broadcast) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.broadcasts[b.ID]
+	if !ok || current.Version != b.Version {
+		return ErrVersionConflict
+	}
+	b.UpdatedAt = s.now()
+	b.Version++
+	s.broadcasts[b.ID] = b.Clone()
+	return nil
+}
+
+func (s *MemoryStore) UnfinishedBroadcasts() []*domain.Broadcast {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var items []*domain.Broadcast
+	for _, b := range s.broadcasts {
+		if b.FinishedAt.IsZero() {
+			items = append(items, b.Clone())
+		}
+	}
+	return items
+}
+
+func (s *MemoryStore) OTPFailures(email string) (domain.OTPFailures, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.otpFailures[email], nil
+}
+
+func (s *MemoryStore) UpdateOTPFailures(email string, fn func(domain.OTPFailures) domain.OTPFailures) (domain.OTPFailures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := fn(s.otpFailures[email])
+	if next.IsZero() {
+		delete(s.otpFailures, email)
+	} else {
+		s.otpFailures[email] = next
+	}
+	return next, nil
+}
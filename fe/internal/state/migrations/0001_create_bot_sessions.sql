@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS bot_sessions (
+    chat_id       BIGINT PRIMARY KEY,
+    data          JSONB       NOT NULL,
+    version       BIGINT      NOT NULL,
+    last_activity TIMESTAMPTZ NOT NULL,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS bot_sessions_last_activity_idx ON bot_sessions (last_activity);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS bot_broadcasts (
+    id         BIGSERIAL PRIMARY KEY,
+    data       JSONB       NOT NULL,
+    version    BIGINT      NOT NULL,
+    finished   BOOLEAN     NOT NULL DEFAULT false,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS bot_broadcasts_unfinished_idx ON bot_broadcasts (id) WHERE NOT finished;
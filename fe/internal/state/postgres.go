@@ -0,0 +1,376 @@
+package state
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// PostgresStore shares sessions between bot replicas. Writes use optimistic
+// versioning: Save only succeeds when the stored version matches the one the
+// caller loaded, otherwise ErrVersionConflict is returned.
+type PostgresStore struct {
+	now     func() time.Time
+	log     zerolog.Logger
+	pool    *pgxpool.Pool
+	timeout time.Duration
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+func NewPostgresStore(ctx context.Context, dsn string, timeout time.Duration, now func() time.Time, log zerolog.Logger) (*PostgresStore, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("connect session db: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("ping session db: %w", err)
+	}
+	s := &PostgresStore{
+		now:     now,
+		log:     log,
+		pool:    pool,
+		timeout: timeout,
+	}
+	if err := s.migrate(ctx); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *PostgresStore) Close() {
+	s.pool.Close()
+}
+
+func (s *PostgresStore) migrate(ctx context.Context) error {
+	_, err := s.pool.Exec(ctx, `CREATE TABLE IF NOT EXISTS bot_schema_migrations (
+		name       TEXT PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return fmt.Errorf("list migrations: %w", err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		raw, err := migrations.ReadFile(name)
+		if err != nil {
+			return fmt.Errorf("read migration %s: %w", name, err)
+		}
+		err = pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+			tag, err := tx.Exec(ctx, `INSERT INTO bot_schema_migrations (name) VALUES ($1) ON CONFLICT DO NOTHING`, name)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				return nil
+			}
+			s.log.Info().Str("migration", name).Msg("applying session store migration")
+			_, err = tx.Exec(ctx, string(raw))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("apply migration %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (s *PostgresStore) Get(chatID int64) (*domain.Session, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var (
+		raw     []byte
+		version int64
+	)
+	err := s.pool.QueryRow(ctx, `SELECT data, version FROM bot_sessions WHERE chat_id = $1`, chatID).Scan(&raw, &version)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			s.log.Error().Err(err).Int64("chat_id", chatID).Msg("failed to load session")
+		}
+		return nil, false
+	}
+	sess, err := decodeSession(raw, version)
+	if err != nil {
+		s.log.Error().Err(err).Int64("chat_id", chatID).Msg("failed to decode session")
+		return nil, false
+	}
+	return sess, true
+}
+
+func (s *PostgresStore) Save(session *domain.Session) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	prevActivity := session.LastActivity
+	session.LastActivity = s.now()
+	raw, err := json.Marshal(session)
+	if err != nil {
+		session.LastActivity = prevActivity
+		return fmt.Errorf("encode session: %w", err)
+	}
+
+	var query string
+	args := []any{session.ChatID, raw, session.LastActivity}
+	if session.Version == 0 {
+		query = `INSERT INTO bot_sessions (chat_id, data, version, last_activity)
+			VALUES ($1, $2, 1, $3)
+			ON CONFLICT (chat_id) DO NOTHING`
+	} else {
+		query = `UPDATE bot_sessions
+			SET data = $2, version = version + 1, last_activity = $3, updated_at = now()
+			WHERE chat_id = $1 AND version = $4`
+		args = append(args, session.Version)
+	}
+	tag, err := s.pool.Exec(ctx, query, args...)
+	if err != nil {
+		session.LastActivity = prevActivity
+		return fmt.Errorf("save session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		session.LastActivity = prevActivity
+		return ErrVersionConflict
+	}
+	session.Version++
+	return nil
+}
+
+func (s *PostgresStore) Update(chatID int64, fn func(*domain.Session) error) (*domain.Session, error) {
+	return update(s, chatID, fn)
+}
+
+func (s *PostgresStore) Delete(chatID int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	if _, err := s.pool.Exec(ctx, `DELETE FROM bot_sessions WHERE chat_id = $1`, chatID); err != nil {
+		s.log.Error().Err(err).Int64("chat_id", chatID).Msg("failed to delete session")
+	}
+}
+
+func (s *PostgresStore) DeleteVersion(chatID, version int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	tag, err := s.pool.Exec(ctx, `DELETE FROM bot_sessions WHERE chat_id = $1 AND version = $2`, chatID, version)
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+	var exists bool
+	if err := s.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM bot_sessions WHERE chat_id = $1)`, chatID).Scan(&exists); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	if !exists {
+		return ErrSessionNotFound
+	}
+	return ErrVersionConflict
+}
+
+func (s *PostgresStore) All() []*domain.Session {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `SELECT chat_id, data, version FROM bot_sessions`)
+	if err != nil {
+		s.log.Error().Err(err).Msg("failed to list sessions")
+		return nil
+	}
+	defer rows.Close()
+
+	var items []*domain.Session
+	for rows.Next() {
+		var (
+			chatID  int64
+			raw     []byte
+			version int64
+		)
+		if err := rows.Scan(&chatID, &raw, &version); err != nil {
+			s.log.Error().Err(err).Msg("failed to scan session")
+			continue
+		}
+		sess, err := decodeSession(raw, version)
+		if err != nil {
+			s.log.Warn().Err(err).Int64("chat_id", chatID).Msg("skipping corrupted session")
+			continue
+		}
+		items = append(items, sess)
+	}
+	if err := rows.Err(); err != nil {
+		s.log.Error().Err(err).Msg("failed to iterate sessions")
+	}
+	return items
+}
+
+func (s *PostgresStore) CreateBroadcast(b *domain.Broadcast) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	next := b.Clone()
+	next.UpdatedAt = s.now()
+	next.Version = 1
+	raw, err := json.Marshal(next)
+	if err != nil {
+		return fmt.Errorf("encode broadcast: %w", err)
+	}
+	var id int64
+	err = s.pool.QueryRow(ctx, `INSERT INTO bot_broadcasts (data, version, updated_at)
+		VALUES ($1, 1, $2)
+		RETURNING id`, raw, next.UpdatedAt).Scan(&id)
+	if err != nil {
+		return fmt.Errorf("create broadcast: %w", err)
+	}
+	b.ID, b.UpdatedAt, b.Version = id, next.UpdatedAt, next.Version
+	return nil
+}
+
+func (s *PostgresStore) SaveBroadcast(b *domain.Broadcast) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	next := b.Clone()
+	next.UpdatedAt = s.now()
+	next.Version++
+	raw, err := json.Marshal(next)
+	if err != nil {
+		return fmt.Errorf("encode broadcast: %w", err)
+	}
+	tag, err := s.pool.Exec(ctx, `UPDATE bot_broadcasts
+		SET data = $2, version = version + 1, finished = $3, updated_at = $4
+		WHERE id = $1 AND version = $5`,
+		b.ID, raw, !next.FinishedAt.IsZero(), next.UpdatedAt, b.Version)
+	if err != nil {
+		return fmt.Errorf("save broadcast: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrVersionConflict
+	}
+	b.UpdatedAt, b.Version = next.UpdatedAt, next.Version
+	return nil
+}
+
+func (s *PostgresStore) UnfinishedBroadcasts() []*domain.Broadcast {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	rows, err := s.pool.Query(ctx, `SELECT id, data, version FROM bot_broadcasts WHERE NOT finished ORDER BY id`)
+	if err != nil {
+		s.log.Error().Err(err).Msg("failed to list broadcasts")
+		return nil
+	}
+	defer rows.Close()
+
+	var items []*domain.Broadcast
+	for rows.Next() {
+		var (
+			id      int64
+			raw     []byte
+			version int64
+		)
+		if err := rows.Scan(&id, &raw, &version); err != nil {
+			s.log.Error().Err(err).Msg("failed to scan broadcast")
+			continue
+		}
+		b := &domain.Broadcast{}
+		if err := json.Unmarshal(raw, b); err != nil {
+			s.log.Warn().Err(err).Int64("broadcast_id", id).Msg("skipping corrupted broadcast")
+			continue
+		}
+		b.ID, b.Version = id, version
+		items = append(items, b)
+	}
+	if err := rows.Err(); err != nil {
+		s.log.Error().Err(err).Msg("failed to iterate broadcasts")
+	}
+	return items
+}
+
+func (s *PostgresStore) OTPFailures(email string) (domain.OTPFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var raw []byte
+	err := s.pool.QueryRow(ctx, `SELECT data FROM bot_otp_failures WHERE email = $1`, email).Scan(&raw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return domain.OTPFailures{}, nil
+	}
+	if err != nil {
+		return domain.OTPFailures{}, fmt.Errorf("load otp failures: %w", err)
+	}
+	var f domain.OTPFailures
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return domain.OTPFailures{}, fmt.Errorf("decode otp failures: %w", err)
+	}
+	return f, nil
+}
+
+// UpdateOTPFailures locks the email's row for the duration of fn, inserting
+// an empty one first so concurrent first failures serialize too.
+func (s *PostgresStore) UpdateOTPFailures(email string, fn func(domain.OTPFailures) domain.OTPFailures) (domain.OTPFailures, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var next domain.OTPFailures
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `INSERT INTO bot_otp_failures (email, data, updated_at)
+			VALUES ($1, '{}', now())
+			ON CONFLICT (email) DO NOTHING`, email)
+		if err != nil {
+			return err
+		}
+		var raw []byte
+		if err := tx.QueryRow(ctx, `SELECT data FROM bot_otp_failures WHERE email = $1 FOR UPDATE`, email).Scan(&raw); err != nil {
+			return err
+		}
+		var current domain.OTPFailures
+		if err := json.Unmarshal(raw, &current); err != nil {
+			return fmt.Errorf("decode stored otp failures: %w", err)
+		}
+		next = fn(current)
+		if next.IsZero() {
+			_, err = tx.Exec(ctx, `DELETE FROM bot_otp_failures WHERE email = $1`, email)
+			return err
+		}
+		raw, err = json.Marshal(next)
+		if err != nil {
+			return fmt.Errorf("encode otp failures: %w", err)
+		}
+		_, err = tx.Exec(ctx, `UPDATE bot_otp_failures SET data = $2, updated_at = now() WHERE email = $1`, email, raw)
+		return err
+	})
+	if err != nil {
+		return domain.OTPFailures{}, fmt.Errorf("update otp failures: %w", err)
+	}
+	return next, nil
+}
+
+func decodeSession(raw []byte, version int64) (*domain.Session, error) {
+	sess := &domain.Session{}
+	if err := json.Unmarshal(raw, sess); err != nil {
+		return nil, err
+	}
+	sess.Version = version
+	return sess, nil
+}
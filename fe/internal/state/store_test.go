@@ -0,0 +1,272 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/escalopa/inno-vkode/internal/domain"
+)
+
+// stores returns every store implementation available in the test
+// environment. Postgres runs only when TEST_DATABASE_URL is set.
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+	bolt, err := NewBoltStore(filepath.Join(t.TempDir(), "sessions.db"), time.Now, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("open bolt store: %v", err)
+	}
+	t.Cleanup(func() { _ = bolt.Close() })
+	all := map[string]Store{
+		"memory": NewMemoryStore(time.Now),
+		"bolt":   bolt,
+	}
+	if dsn := os.Getenv("TEST_DATABASE_URL"); dsn != "" {
+		pg, err := NewPostgresStore(context.Background(), dsn, 5*time.Second, time.Now, zerolog.Nop())
+		if err != nil {
+			t.Fatalf("open postgres store: %v", err)
+		}
+		t.Cleanup(pg.Close)
+		all["postgres"] = pg
+	}
+	return all
+}
+
+func TestStoreSaveIsCompareAndSwap(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			const chatID = 101
+			store.Delete(chatID)
+			if err := store.Save(&domain.Session{ChatID: chatID}); err != nil {
+				t.Fatalf("insert: %v", err)
+			}
+			if err := store.Save(&domain.Session{ChatID: chatID}); !errors.Is(err, ErrVersionConflict) {
+				t.Fatalf("second insert: got %v, want ErrVersionConflict", err)
+			}
+
+			first, _ := store.Get(chatID)
+			second, _ := store.Get(chatID)
+			first.Email = "first@univ.ru"
+			if err := store.Save(first); err != nil {
+				t.Fatalf("save first snapshot: %v", err)
+			}
+			second.Email = "second@univ.ru"
+			if err := store.Save(second); !errors.Is(err, ErrVersionConflict) {
+				t.Fatalf("save stale snapshot: got %v, want ErrVersionConflict", err)
+			}
+			got, _ := store.Get(chatID)
+			if got.Email != "first@univ.ru" || got.Version != first.Version {
+				t.Fatalf("stored email %q version %d, want %q version %d", got.Email, got.Version, "first@univ.ru", first.Version)
+			}
+		})
+	}
+}
+
+func TestStoreGetReturnsSnapshot(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			const chatID = 102
+			store.Delete(chatID)
+			sess := &domain.Session{ChatID: chatID, PendingAction: &domain.PendingAction{Data: map[string]string{"k": "v"}}}
+			if err := store.Save(sess); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+			got, _ := store.Get(chatID)
+			got.PendingAction.Data["k"] = "changed"
+			again, _ := store.Get(chatID)
+			if again.PendingAction.Data["k"] != "v" {
+				t.Fatalf("mutating a snapshot changed the stored session")
+			}
+		})
+	}
+}
+
+func TestStoreConcurrentUpdates(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			const (
+				chatID  = 103
+				writers = 8
+				rounds  = 10
+			)
+			store.Delete(chatID)
+			if err := store.Save(&domain.Session{ChatID: chatID}); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+			var (
+				wg     sync.WaitGroup
+				mu     sync.Mutex
+				failed int
+			)
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for r := 0; r < rounds; r++ {
+						_, err := store.Update(chatID, func(sess *domain.Session) error {
+							sess.PendingEventID++
+							return nil
+						})
+						if err != nil {
+							mu.Lock()
+							failed++
+							mu.Unlock()
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			got, _ := store.Get(chatID)
+			// Update gives up after a few lost races; every increment that
+			// reported success must be there and no other.
+			if want := int64(writers*rounds - failed); got.PendingEventID != want {
+				t.Fatalf("PendingEventID = %d, want %d (%d updates gave up)", got.PendingEventID, want, failed)
+			}
+			if failed > writers*rounds/2 {
+				t.Fatalf("%d of %d updates gave up", failed, writers*rounds)
+			}
+		})
+	}
+}
+
+func TestStoreUpdateMissingSession(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			store.Delete(104)
+			_, err := store.Update(104, func(*domain.Session) error { return nil })
+			if !errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("got %v, want ErrSessionNotFound", err)
+			}
+		})
+	}
+}
+
+func TestStoreBroadcasts(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			first := &domain.Broadcast{Text: "first", Recipients: []domain.BroadcastRecipient{{ChatID: 1, Status: domain.RecipientPending}}}
+			second := &domain.Broadcast{Text: "second"}
+			for _, b := range []*domain.Broadcast{first, second} {
+				if err := store.CreateBroadcast(b); err != nil {
+					t.Fatalf("create: %v", err)
+				}
+			}
+			if first.ID == 0 || second.ID == first.ID || first.Version != 1 {
+				t.Fatalf("ids %d and %d, version %d", first.ID, second.ID, first.Version)
+			}
+
+			// Two processes load the broadcast; only the first save wins.
+			mine, theirs := loadBroadcast(t, store, first.ID), loadBroadcast(t, store, first.ID)
+			mine.Recipients[0].Status = domain.RecipientSent
+			if err := store.SaveBroadcast(mine); err != nil {
+				t.Fatalf("save: %v", err)
+			}
+			if err := store.SaveBroadcast(theirs); !errors.Is(err, ErrVersionConflict) {
+				t.Fatalf("stale save: got %v, want ErrVersionConflict", err)
+			}
+			if got := loadBroadcast(t, store, first.ID); got.Recipients[0].Status != domain.RecipientSent || got.Version != mine.Version {
+				t.Fatalf("stored %+v, want the first save", got)
+			}
+
+			mine.FinishedAt = time.Now()
+			if err := store.SaveBroadcast(mine); err != nil {
+				t.Fatalf("finish: %v", err)
+			}
+			for _, b := range store.UnfinishedBroadcasts() {
+				if b.ID == first.ID {
+					t.Fatalf("finished broadcast still listed")
+				}
+			}
+		})
+	}
+}
+
+func loadBroadcast(t *testing.T, store Store, id int64) *domain.Broadcast {
+	t.Helper()
+	for _, b := range store.UnfinishedBroadcasts() {
+		if b.ID == id {
+			return b
+		}
+	}
+	t.Fatalf("broadcast %d not listed as unfinished", id)
+	return nil
+}
+
+func TestStoreDeleteVersion(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			const chatID = 105
+			store.Delete(chatID)
+			if err := store.DeleteVersion(chatID, 0); !errors.Is(err, ErrSessionNotFound) {
+				t.Fatalf("missing session: got %v, want ErrSessionNotFound", err)
+			}
+			sess := &domain.Session{ChatID: chatID}
+			if err := store.Save(sess); err != nil {
+				t.Fatal(err)
+			}
+			stale := sess.Version
+			if err := store.Save(sess); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.DeleteVersion(chatID, stale); !errors.Is(err, ErrVersionConflict) {
+				t.Fatalf("stale version: got %v, want ErrVersionConflict", err)
+			}
+			if _, ok := store.Get(chatID); !ok {
+				t.Fatalf("session deleted on a stale version")
+			}
+			if err := store.DeleteVersion(chatID, sess.Version); err != nil {
+				t.Fatalf("current version: %v", err)
+			}
+			if _, ok := store.Get(chatID); ok {
+				t.Fatalf("session still stored")
+			}
+		})
+	}
+}
+
+func TestStoreOTPFailures(t *testing.T) {
+	for name, store := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			const (
+				email   = "otp@univ.ru"
+				writers = 8
+			)
+			reset := func(domain.OTPFailures) domain.OTPFailures { return domain.OTPFailures{} }
+			if _, err := store.UpdateOTPFailures(email, reset); err != nil {
+				t.Fatalf("reset: %v", err)
+			}
+			var wg sync.WaitGroup
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := store.UpdateOTPFailures(email, func(f domain.OTPFailures) domain.OTPFailures {
+						f.Count++
+						return f
+					})
+					if err != nil {
+						t.Errorf("update: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+			got, err := store.OTPFailures(email)
+			if err != nil || got.Count != writers {
+				t.Fatalf("OTPFailures = %+v, %v; want %d failures", got, err, writers)
+			}
+
+			if _, err := store.UpdateOTPFailures(email, reset); err != nil {
+				t.Fatalf("reset: %v", err)
+			}
+			if got, err := store.OTPFailures(email); err != nil || got.Count != 0 {
+				t.Fatalf("after reset OTPFailures = %+v, %v", got, err)
+			}
+		})
+	}
+}
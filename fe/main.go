@@ -3,41 +3,48 @@ package main
 import (
 	"context"
 	"errors"
+	_ "expvar"
+	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
 	maxbot "github.com/max-messenger/max-bot-api-client-go"
+	"github.com/rs/zerolog"
 
 	"github.com/escalopa/inno-vkode/internal/adapters/backend/httpclient"
+	"github.com/escalopa/inno-vkode/internal/adapters/messenger/console"
+	"github.com/escalopa/inno-vkode/internal/adapters/messenger/delivery"
+	"github.com/escalopa/inno-vkode/internal/adapters/messenger/dispatch"
 	maxadapter "github.com/escalopa/inno-vkode/internal/adapters/messenger/max"
+	"github.com/escalopa/inno-vkode/internal/adapters/messenger/split"
+	"github.com/escalopa/inno-vkode/internal/adapters/messenger/telegram"
 	"github.com/escalopa/inno-vkode/internal/adapters/notifier/email"
 	"github.com/escalopa/inno-vkode/internal/app/bot"
 	"github.com/escalopa/inno-vkode/internal/config"
 	"github.com/escalopa/inno-vkode/internal/logger"
+	"github.com/escalopa/inno-vkode/internal/ports"
 	"github.com/escalopa/inno-vkode/internal/state"
 )
 
 func main() {
+	consoleMode := flag.Bool("console", false, "chat with the bot in the terminal instead of a messenger")
+	flag.Parse()
+
 	ctx := context.Background()
 	cfg, err := config.Load()
 	if err != nil {
 		panic(err)
 	}
 	log := logger.New(cfg.LogLevel)
-
-	api, err := maxbot.New(cfg.MaxBotToken)
-	if err != nil {
-		log.Fatal().Err(err).Msg("unable to init MAX bot API")
-	}
-
-	info, err := api.Bots.GetBot(ctx)
-	if err != nil {
-		panic(err)
+	if *consoleMode {
+		// stdout belongs to the conversation.
+		log = logger.NewTo(os.Stderr, cfg.LogLevel)
+		cfg.Messenger = "console"
 	}
-	fmt.Printf("%+v", info)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -50,10 +57,46 @@ func main() {
 		cancel()
 	}()
 
-	backend := httpclient.New(cfg.BackendBaseURL, cfg.HTTPTimeout, log)
-	messenger := maxadapter.New(api, log)
-	emailSender := email.NewLogSender(log)
-	store := state.NewMemoryStore(time.Now)
+	if cfg.MetricsAddr != "" {
+		go func() {
+			log.Info().Str("addr", cfg.MetricsAddr).Msg("serving metrics on /debug/vars")
+			if err := http.ListenAndServe(cfg.MetricsAddr, nil); err != nil {
+				log.Error().Err(err).Msg("metrics server stopped")
+			}
+		}()
+	}
+
+	backend := httpclient.New(cfg.BackendBaseURL, cfg.BackendToken, cfg.HTTPTimeout, httpclient.Policy{
+		MaxRetries:       cfg.BackendMaxRetries,
+		RetryBackoff:     cfg.BackendRetryBackoff,
+		MaxBackoff:       cfg.BackendMaxBackoff,
+		BreakerThreshold: cfg.BreakerThreshold,
+		BreakerCooldown:  cfg.BreakerCooldown,
+	}, log)
+	messenger, err := newMessenger(ctx, cfg, log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to init messenger")
+	}
+	messenger = delivery.New(messenger, delivery.Config{
+		GlobalRate:     cfg.DeliveryGlobalRate,
+		GlobalBurst:    cfg.DeliveryGlobalBurst,
+		ChatRate:       cfg.DeliveryChatRate,
+		ChatBurst:      cfg.DeliveryChatBurst,
+		MaxRetries:     cfg.DeliveryMaxRetries,
+		RetryBackoff:   cfg.DeliveryRetryBackoff,
+		MaxBackoff:     cfg.DeliveryMaxBackoff,
+		DeadLetterPath: cfg.DeliveryDeadLetters,
+	}, log)
+	messenger = split.New(messenger, messageLimit(cfg))
+	emailSender, err := newEmailSender(cfg, log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to init email sender")
+	}
+	store, closeStore, err := newSessionStore(ctx, cfg, log)
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to init session store")
+	}
+	defer closeStore()
 
 	service := bot.New(cfg, log, backend, messenger, emailSender, store)
 
@@ -62,3 +105,121 @@ func main() {
 	}
 	log.Info().Msg("bot service stopped")
 }
+
+func newMessenger(ctx context.Context, cfg *config.Config, log zerolog.Logger) (ports.Messenger, error) {
+	dispatchCfg := dispatch.Config{
+		Workers:          cfg.UpdateWorkers,
+		QueueSize:        cfg.UpdateQueueSize,
+		HandlerTimeout:   cfg.HandlerTimeout,
+		CallbackAckAfter: cfg.CallbackAckAfter,
+	}
+	switch cfg.Messenger {
+	case "console":
+		return console.New(os.Stdin, os.Stdout, log), nil
+	case "", "max":
+		if cfg.MaxBotToken == "" {
+			return nil, errors.New("MAX_BOT_TOKEN is required for the max messenger")
+		}
+		api, err := maxbot.NewWithConfig(maxadapter.APIConfig{
+			Token:   cfg.MaxBotToken,
+			URL:     cfg.MaxAPIURL,
+			Version: cfg.MaxAPIVersion,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("init MAX bot API: %w", err)
+		}
+		info, err := api.Bots.GetBot(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("get MAX bot info: %w", err)
+		}
+		fmt.Printf("%+v", info)
+		return maxadapter.New(api, maxadapter.Config{
+			Token:         cfg.MaxBotToken,
+			APIURL:        cfg.MaxAPIURL,
+			APIVersion:    cfg.MaxAPIVersion,
+			Mode:          cfg.MaxMode,
+			WebhookURL:    cfg.MaxWebhookURL,
+			WebhookListen: cfg.MaxWebhookListen,
+			WebhookSecret: cfg.MaxWebhookSecret,
+		}, log, dispatchCfg), nil
+	case "telegram":
+		if cfg.TelegramBotToken == "" {
+			return nil, errors.New("TELEGRAM_BOT_TOKEN is required for the telegram messenger")
+		}
+		return telegram.New(telegram.Config{
+			Token:         cfg.TelegramBotToken,
+			APIURL:        cfg.TelegramAPIURL,
+			Mode:          cfg.TelegramMode,
+			PollTimeout:   cfg.TelegramPollTimeout,
+			WebhookURL:    cfg.TelegramWebhookURL,
+			WebhookListen: cfg.TelegramWebhookListen,
+			WebhookSecret: cfg.TelegramWebhookSecret,
+		}, log, dispatchCfg), nil
+	default:
+		return nil, fmt.Errorf("unknown messenger %q", cfg.Messenger)
+	}
+}
+
+// messageLimit is the longest text the configured messenger accepts in one
+// message; the console has no limit.
+func messageLimit(cfg *config.Config) int {
+	switch cfg.Messenger {
+	case "telegram":
+		return cfg.TelegramMessageLimit
+	case "console":
+		return 0
+	default:
+		return cfg.MaxMessageLimit
+	}
+}
+
+func newEmailSender(cfg *config.Config, log zerolog.Logger) (ports.EmailSender, error) {
+	switch cfg.EmailSender {
+	case "", "log":
+		return email.NewLogSender(log), nil
+	case "smtp":
+		return email.NewSMTPSender(email.SMTPConfig{
+			Host:         cfg.SMTPHost,
+			Port:         cfg.SMTPPort,
+			Username:     cfg.SMTPUsername,
+			Password:     cfg.SMTPPassword,
+			From:         cfg.SMTPFrom,
+			StartTLS:     cfg.SMTPStartTLS,
+			Timeout:      cfg.SMTPTimeout,
+			SendTimeout:  cfg.SMTPSendTimeout,
+			MaxRetries:   cfg.SMTPMaxRetries,
+			RetryBackoff: cfg.SMTPRetryBackoff,
+			CodeTTL:      cfg.OTPExpiry,
+		}, log)
+	default:
+		return nil, fmt.Errorf("unknown email sender %q", cfg.EmailSender)
+	}
+}
+
+func newSessionStore(ctx context.Context, cfg *config.Config, log zerolog.Logger) (state.Store, func(), error) {
+	switch cfg.SessionStore {
+	case "", "memory":
+		return state.NewMemoryStore(time.Now), func() {}, nil
+	case "bolt":
+		store, err := state.NewBoltStore(cfg.SessionDBPath, time.Now, log)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, func() {
+			if err := store.Close(); err != nil {
+				log.Error().Err(err).Msg("failed to close session store")
+			}
+		}, nil
+	case "postgres":
+		if cfg.DatabaseURL == "" {
+			return nil, nil, errors.New("DATABASE_URL is required for postgres session store")
+		}
+		store, err := state.NewPostgresStore(ctx, cfg.DatabaseURL, cfg.HTTPTimeout, time.Now, log)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown session store %q", cfg.SessionStore)
+	}
+}